@@ -97,6 +97,9 @@ exports.handler = async (event) => {
                 email: decodedToken.email || '',
                 phone_number: decodedToken.phone_number || '',
                 uid: decodedToken.uid,
+                tenant_id: decodedToken.tenant_id || '',
+                role: decodedToken.role || '',
+                role_tenant: decodedToken.role_tenant || '',
                 studentUid: studentUid ?? null
             }
         };
@@ -0,0 +1,112 @@
+// Command dev-token mints Firebase-style ID tokens signed with a local test
+// key, for the local dev server and the in-process verifier:
+//
+//	dev-token -project demo -uid u1 [-email a@b.c] [-tenant id] [-role admin] [-ttl 1h]
+//
+// The key is read from -key, or generated there on first use, and its JWKS is
+// written to -jwks; point FIREBASE_JWKS_URL at that file. Tokens signed this
+// way are only accepted by a verifier configured with the local JWKS.
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go-upload-excel/handlers"
+)
+
+const keyID = "dev-key"
+
+func main() {
+	keyFile := flag.String("key", "dev-key.pem", "PEM file holding the test signing key")
+	jwksFile := flag.String("jwks", "dev-jwks.json", "where to write the test JWKS")
+	projectID := flag.String("project", "", "Firebase project ID (audience)")
+	uid := flag.String("uid", "", "user ID (sub)")
+	email := flag.String("email", "", "email claim")
+	tenantID := flag.String("tenant", "", "tenant_id custom claim")
+	role := flag.String("role", "", "role custom claim, granted in the -tenant tenant")
+	ttl := flag.Duration("ttl", time.Hour, "token lifetime")
+	flag.Parse()
+
+	if *projectID == "" || *uid == "" {
+		log.Fatalf("❌ -project and -uid are required")
+	}
+
+	key, err := loadOrCreateKey(*keyFile)
+	if err != nil {
+		log.Fatalf("❌ Loading key failed: %v", err)
+	}
+	jwks, _ := json.MarshalIndent(map[string]interface{}{
+		"keys": []handlers.JSONWebKey{handlers.NewJSONWebKey(keyID, &key.PublicKey)},
+	}, "", "  ")
+	if err := os.WriteFile(*jwksFile, jwks, 0644); err != nil {
+		log.Fatalf("❌ Writing JWKS failed: %v", err)
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":       "https://securetoken.google.com/" + *projectID,
+		"aud":       *projectID,
+		"sub":       *uid,
+		"user_id":   *uid,
+		"auth_time": now.Unix(),
+		"iat":       now.Unix(),
+		"exp":       now.Add(*ttl).Unix(),
+	}
+	if *email != "" {
+		claims["email"] = *email
+		claims["email_verified"] = true
+	}
+	if *tenantID != "" {
+		claims["tenant_id"] = *tenantID
+	}
+	if *role != "" {
+		claims["role"] = *role
+		claims["role_tenant"] = *tenantID
+		if *tenantID == "" {
+			claims["role_tenant"] = handlers.DefaultTenantID
+		}
+	}
+
+	token, err := handlers.SignJWT(key, keyID, claims)
+	if err != nil {
+		log.Fatalf("❌ Signing token failed: %v", err)
+	}
+	fmt.Println(token)
+}
+
+// loadOrCreateKey reads a PKCS#1 PEM key, generating it when the file does
+// not exist yet
+func loadOrCreateKey(path string) (*rsa.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}
+		if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+			return nil, err
+		}
+		log.Printf("📌 Generated test key %s", path)
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM key", path)
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Items are dumped in the DynamoDB JSON format, {"S": "..."}, {"N": "1"} and
+// so on, so that sets and number precision survive a round trip
+
+func encodeItem(item map[string]*dynamodb.AttributeValue) map[string]interface{} {
+	encoded := make(map[string]interface{}, len(item))
+	for name, value := range item {
+		encoded[name] = encodeAttribute(value)
+	}
+	return encoded
+}
+
+func encodeAttribute(av *dynamodb.AttributeValue) map[string]interface{} {
+	switch {
+	case av.S != nil:
+		return map[string]interface{}{"S": *av.S}
+	case av.N != nil:
+		return map[string]interface{}{"N": *av.N}
+	case av.B != nil:
+		return map[string]interface{}{"B": av.B}
+	case av.BOOL != nil:
+		return map[string]interface{}{"BOOL": *av.BOOL}
+	case av.NULL != nil:
+		return map[string]interface{}{"NULL": *av.NULL}
+	case av.SS != nil:
+		return map[string]interface{}{"SS": av.SS}
+	case av.NS != nil:
+		return map[string]interface{}{"NS": av.NS}
+	case av.BS != nil:
+		return map[string]interface{}{"BS": av.BS}
+	case av.L != nil:
+		list := make([]interface{}, len(av.L))
+		for i, value := range av.L {
+			list[i] = encodeAttribute(value)
+		}
+		return map[string]interface{}{"L": list}
+	default:
+		return map[string]interface{}{"M": encodeItem(av.M)}
+	}
+}
+
+func decodeItem(raw map[string]json.RawMessage) (map[string]*dynamodb.AttributeValue, error) {
+	item := make(map[string]*dynamodb.AttributeValue, len(raw))
+	for name, value := range raw {
+		av, err := decodeAttribute(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		item[name] = av
+	}
+	return item, nil
+}
+
+func decodeAttribute(raw json.RawMessage) (*dynamodb.AttributeValue, error) {
+	var typed map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &typed); err != nil {
+		return nil, err
+	}
+	if len(typed) != 1 {
+		return nil, fmt.Errorf("expected one type, got %d", len(typed))
+	}
+
+	av := &dynamodb.AttributeValue{}
+	for kind, value := range typed {
+		var err error
+		switch kind {
+		case "S":
+			err = json.Unmarshal(value, &av.S)
+		case "N":
+			err = json.Unmarshal(value, &av.N)
+		case "B":
+			err = json.Unmarshal(value, &av.B)
+		case "BOOL":
+			err = json.Unmarshal(value, &av.BOOL)
+		case "NULL":
+			err = json.Unmarshal(value, &av.NULL)
+		case "SS":
+			err = json.Unmarshal(value, &av.SS)
+		case "NS":
+			err = json.Unmarshal(value, &av.NS)
+		case "BS":
+			err = json.Unmarshal(value, &av.BS)
+		case "L":
+			var list []json.RawMessage
+			if err = json.Unmarshal(value, &list); err == nil {
+				av.L = make([]*dynamodb.AttributeValue, len(list))
+				for i, element := range list {
+					if av.L[i], err = decodeAttribute(element); err != nil {
+						break
+					}
+				}
+			}
+		case "M":
+			var m map[string]json.RawMessage
+			if err = json.Unmarshal(value, &m); err == nil {
+				av.M, err = decodeItem(m)
+			}
+		default:
+			err = fmt.Errorf("unknown type %s", kind)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return av, nil
+}
@@ -0,0 +1,349 @@
+// Command dynamo-backup exports the main v2 tables to newline-delimited JSON
+// and restores them from such a dump:
+//
+//	dynamo-backup export -out backup.ndjson.gz [-tables ...] [-class CLS10] [-tenant id]
+//	dynamo-backup restore -in backup.ndjson.gz [-conflict skip|overwrite] [-tables ...] [-class CLS10] [-tenant id]
+//
+// Every line holds one item, {"table": ..., "item": ...}, in the DynamoDB
+// JSON format. Dumps are gzipped with -gzip or when the file name ends in
+// .gz; restore detects gzip by itself. On restore, -conflict skip keeps items
+// already in the table and overwrite replaces them. Set DYNAMODB_ENDPOINT to
+// run against DynamoDB Local.
+//
+// All v2 tables are covered except data derived from attempts, which is
+// rebuilt as students take quizzes (leaderboards, quiz_item_stats), and the
+// v1 tables (students, class_subjects). Items without tenant_id, such as
+// plans and coupons, count as the default tenant for -tenant.
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"go-upload-excel/handlers"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Largest dump line read back; DynamoDB items are at most 400 KB, and the
+// JSON format adds to that
+const maxLineBytes = 16 << 20
+
+type backupTable struct {
+	name string
+	// Partition key, used to detect existing items
+	key string
+	// Attribute holding the item's class, if any; tables without one are
+	// kept whole when filtering by class
+	classAttribute string
+}
+
+var backupTables = []backupTable{
+	{name: "quiz_questions", key: "quiz_name", classAttribute: "class_name"},
+	{name: "students_info", key: "uid", classAttribute: "student_class"},
+	{name: "student_quiz_attempts_v2", key: "uid", classAttribute: "class_name"},
+	{name: "taxonomy_nodes", key: "node_id"},
+	{name: "attempt_history", key: "uid", classAttribute: "class_name"},
+	{name: "class_upgrades", key: "uid", classAttribute: "old_class"},
+	{name: "attempt_log", key: "uid", classAttribute: "class_name"},
+	{name: "question_bank", key: "question_id", classAttribute: "class_name"},
+	{name: "review_queue", key: "uid", classAttribute: "class_name"},
+	{name: "adaptive_sessions", key: "uid", classAttribute: "class_name"},
+	{name: "batches", key: "batch_id", classAttribute: "class_name"},
+	{name: "assignments", key: "batch_id", classAttribute: "class_name"},
+	{name: "tenants", key: "tenant_id"},
+	{name: "subscription_plans", key: "plan_id"},
+	{name: "student_payments", key: "uid"},
+	{name: "payment_orders", key: "order_id"},
+	{name: "coupons", key: "code"},
+	{name: "coupon_redemptions", key: "code"},
+}
+
+type dumpLine struct {
+	Table string          `json:"table"`
+	Item  json.RawMessage `json:"item"`
+}
+
+// Restricts export and restore to one class and/or one tenant
+type itemFilter struct {
+	className string
+	tenantID  string
+}
+
+func (f itemFilter) matches(table backupTable, item map[string]*dynamodb.AttributeValue) bool {
+	tenantID := stringAttribute(item, "tenant_id")
+	if tenantID == "" {
+		tenantID = handlers.DefaultTenantID
+	}
+	if f.tenantID != "" && tenantID != f.tenantID {
+		return false
+	}
+	if f.className != "" && table.classAttribute != "" {
+		className := strings.TrimPrefix(stringAttribute(item, table.classAttribute), tenantID+"#")
+		return className == f.className
+	}
+	return true
+}
+
+func stringAttribute(item map[string]*dynamodb.AttributeValue, name string) string {
+	if value, ok := item[name]; ok && value.S != nil {
+		return *value.S
+	}
+	return ""
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: dynamo-backup export|restore [flags]")
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = runExport(os.Args[2:])
+	case "restore":
+		err = runRestore(os.Args[2:])
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q, want export or restore\n", os.Args[1])
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatalf("❌ %s failed: %v", os.Args[1], err)
+	}
+}
+
+// commonFlags adds the flags shared by export and restore
+func commonFlags(flags *flag.FlagSet) (*string, *itemFilter) {
+	filter := &itemFilter{}
+	tables := flags.String("tables", "", "comma-separated tables (default all)")
+	flags.StringVar(&filter.className, "class", "", "only items of this class")
+	flags.StringVar(&filter.tenantID, "tenant", "", "only items of this tenant")
+	return tables, filter
+}
+
+// selectTables returns the tables named in a comma-separated list, or all
+func selectTables(list string) ([]backupTable, error) {
+	if list == "" {
+		return backupTables, nil
+	}
+	var selected []backupTable
+	for _, name := range strings.Split(list, ",") {
+		table, ok := findTable(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("unknown table %q", name)
+		}
+		selected = append(selected, table)
+	}
+	return selected, nil
+}
+
+func findTable(name string) (backupTable, bool) {
+	for _, table := range backupTables {
+		if table.name == name {
+			return table, true
+		}
+	}
+	return backupTable{}, false
+}
+
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	out := flags.String("out", "", "dump file (required)")
+	gzipped := flags.Bool("gzip", false, "gzip the dump (implied by a .gz file name)")
+	tableList, filter := commonFlags(flags)
+	flags.Parse(args)
+
+	if *out == "" {
+		flags.Usage()
+		os.Exit(2)
+	}
+	tables, err := selectTables(*tableList)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var writer io.Writer = file
+	var zipper *gzip.Writer
+	if *gzipped || strings.HasSuffix(*out, ".gz") {
+		zipper = gzip.NewWriter(file)
+		writer = zipper
+	}
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+
+	for _, table := range tables {
+		count := 0
+		err := handlers.ScanTable(table.name, func(items []map[string]*dynamodb.AttributeValue) error {
+			for _, item := range items {
+				if !filter.matches(table, item) {
+					continue
+				}
+				line := map[string]interface{}{"table": table.name, "item": encodeItem(item)}
+				if err := encoder.Encode(line); err != nil {
+					return err
+				}
+				count++
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("exporting %s: %v", table.name, err)
+		}
+		log.Printf("📌 %s: %d items exported", table.name, count)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if zipper != nil {
+		if err := zipper.Close(); err != nil {
+			return err
+		}
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	log.Printf("✅ Export written to %s", *out)
+	return nil
+}
+
+type restoreCounts struct {
+	restored int
+	existing int
+	filtered int
+}
+
+func runRestore(args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := flags.String("in", "", "dump file (required)")
+	conflict := flags.String("conflict", "skip", "existing items: skip or overwrite")
+	tableList, filter := commonFlags(flags)
+	flags.Parse(args)
+
+	if *in == "" || (*conflict != "skip" && *conflict != "overwrite") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	tables, err := selectTables(*tableList)
+	if err != nil {
+		return err
+	}
+	selected := make(map[string]bool)
+	for _, table := range tables {
+		selected[table.name] = true
+	}
+
+	file, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var source io.Reader = reader
+	if magic, err := reader.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipper, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer unzipper.Close()
+		source = unzipper
+	}
+
+	counts := make(map[string]*restoreCounts)
+	// Overwritten items are written in batches per table
+	pending := make(map[string][]map[string]*dynamodb.AttributeValue)
+	flush := func(tableName string) error {
+		if err := handlers.BatchPutItems(tableName, pending[tableName]); err != nil {
+			return fmt.Errorf("restoring %s: %v", tableName, err)
+		}
+		counts[tableName].restored += len(pending[tableName])
+		pending[tableName] = nil
+		return nil
+	}
+
+	scanner := bufio.NewScanner(source)
+	scanner.Buffer(make([]byte, 64*1024), maxLineBytes)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var line dumpLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		table, ok := findTable(line.Table)
+		if !ok {
+			return fmt.Errorf("line %d: unknown table %q", lineNo, line.Table)
+		}
+		if !selected[table.name] {
+			continue
+		}
+		if counts[table.name] == nil {
+			counts[table.name] = &restoreCounts{}
+		}
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal(line.Item, &raw); err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		item, err := decodeItem(raw)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", lineNo, err)
+		}
+		if !filter.matches(table, item) {
+			counts[table.name].filtered++
+			continue
+		}
+
+		if *conflict == "skip" {
+			written, err := handlers.PutItemIfAbsent(table.name, table.key, item)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", lineNo, err)
+			}
+			if written {
+				counts[table.name].restored++
+			} else {
+				counts[table.name].existing++
+			}
+			continue
+		}
+
+		pending[table.name] = append(pending[table.name], item)
+		if len(pending[table.name]) >= 100 {
+			if err := flush(table.name); err != nil {
+				return err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for tableName := range pending {
+		if err := flush(tableName); err != nil {
+			return err
+		}
+	}
+
+	for _, table := range tables {
+		if c := counts[table.name]; c != nil {
+			log.Printf("📌 %s: %d restored, %d already present, %d filtered out", table.name, c.restored, c.existing, c.filtered)
+		}
+	}
+	log.Printf("✅ Restore from %s finished", *in)
+	return nil
+}
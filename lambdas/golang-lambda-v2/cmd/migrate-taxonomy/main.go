@@ -0,0 +1,100 @@
+// Command migrate-taxonomy copies the classes, subjects and topics stored in
+// the old class_subjects table, including its _CLASS_PLACEHOLDER rows, into
+// taxonomy_nodes:
+//
+//	migrate-taxonomy [-dry-run]
+//
+// Classes and subjects get a sort order by name and topics keep their list
+// order. Nodes that already exist are left alone, so the command can be run
+// again. Set DYNAMODB_ENDPOINT to run against DynamoDB Local.
+package main
+
+import (
+	"flag"
+	"log"
+	"sort"
+	"strings"
+
+	"go-upload-excel/handlers"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+const classPlaceholder = "_CLASS_PLACEHOLDER"
+
+// Row of the old class_subjects table; class_name is scoped to the tenant
+type classSubjectRow struct {
+	ClassName   string   `dynamodbav:"class_name"`
+	SubjectName string   `dynamodbav:"subject_name"`
+	Topics      []string `dynamodbav:"topics"`
+	TenantID    string   `dynamodbav:"tenant_id"`
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report what would be copied")
+	flag.Parse()
+
+	var rows []classSubjectRow
+	err := handlers.ScanTable("class_subjects", func(items []map[string]*dynamodb.AttributeValue) error {
+		var page []classSubjectRow
+		if err := dynamodbattribute.UnmarshalListOfMaps(items, &page); err != nil {
+			return err
+		}
+		rows = append(rows, page...)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("❌ Reading class_subjects failed: %v", err)
+	}
+
+	for i := range rows {
+		if rows[i].TenantID == "" {
+			rows[i].TenantID = handlers.DefaultTenantID
+		}
+		rows[i].ClassName = strings.TrimPrefix(rows[i].ClassName, rows[i].TenantID+"#")
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		a, b := rows[i], rows[j]
+		if a.TenantID != b.TenantID {
+			return a.TenantID < b.TenantID
+		}
+		if a.ClassName != b.ClassName {
+			return a.ClassName < b.ClassName
+		}
+		return a.SubjectName < b.SubjectName
+	})
+
+	var classes, subjects, topics int
+	for _, row := range rows {
+		if row.SubjectName == classPlaceholder {
+			classes++
+			if !*dryRun {
+				err = handlers.InsertClass(row.TenantID, row.ClassName)
+			}
+		} else {
+			subjects++
+			if !*dryRun {
+				err = handlers.InsertSubject(row.TenantID, row.ClassName, row.SubjectName)
+			}
+			for _, topic := range row.Topics {
+				if err != nil {
+					break
+				}
+				topics++
+				if !*dryRun {
+					err = handlers.InsertTopic(row.TenantID, row.ClassName, row.SubjectName, topic)
+				}
+			}
+		}
+		if err != nil {
+			log.Fatalf("❌ Copying %s/%s of tenant %s failed: %v", row.ClassName, row.SubjectName, row.TenantID, err)
+		}
+	}
+
+	if *dryRun {
+		log.Printf("📌 Would copy %d classes, %d subjects and %d topics", classes, subjects, topics)
+		return
+	}
+	log.Printf("✅ Copied %d classes, %d subjects and %d topics", classes, subjects, topics)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+// Problem found in a v1 row. Skipped rows were not migrated; the others were
+// migrated as they are.
+type Mismatch struct {
+	Table   string `json:"table"`
+	Key     string `json:"key"`
+	Problem string `json:"problem"`
+	Skipped bool   `json:"skipped,omitempty"`
+}
+
+// Progress of one v1 table. LastKey is the key of the last row written, rows
+// are read in key order.
+type TableProgress struct {
+	LastKey  string         `json:"lastKey"`
+	Read     int            `json:"read"`
+	Migrated int            `json:"migrated"`
+	Skipped  map[string]int `json:"skipped"`
+	Done     bool           `json:"done"`
+}
+
+// Checkpoint is saved after every page written, so an interrupted run resumes
+// after the last page and its counts cover all runs
+type Checkpoint struct {
+	Tables     map[string]*TableProgress `json:"tables"`
+	Mismatches []Mismatch                `json:"mismatches"`
+}
+
+func loadCheckpoint(path string) (*Checkpoint, error) {
+	checkpoint := &Checkpoint{Tables: make(map[string]*TableProgress)}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return checkpoint, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, checkpoint); err != nil {
+		return nil, err
+	}
+	if checkpoint.Tables == nil {
+		checkpoint.Tables = make(map[string]*TableProgress)
+	}
+	return checkpoint, nil
+}
+
+func (c *Checkpoint) progress(table string) *TableProgress {
+	progress, ok := c.Tables[table]
+	if !ok {
+		progress = &TableProgress{}
+		c.Tables[table] = progress
+	}
+	if progress.Skipped == nil {
+		progress.Skipped = make(map[string]int)
+	}
+	return progress
+}
+
+// save writes the checkpoint through a temporary file so that a crash never
+// leaves it half written
+func (c *Checkpoint) save(path string) error {
+	content, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path+".tmp", content, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
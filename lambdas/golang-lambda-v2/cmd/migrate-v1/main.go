@@ -0,0 +1,371 @@
+// Command migrate-v1 copies the v1 Postgres data (see sql/init.sql) into the
+// v2 DynamoDB tables:
+//
+//	students              -> students_info
+//	quiz_questions        -> quiz_questions (and question_bank)
+//	student_quizzes       -> student_quizzes_v2
+//	student_quiz_attempts -> student_quiz_attempts_v2
+//
+// v1 keys students by email and v2 by Firebase uid, so a CSV file of
+// email,uid rows is required. Categories such as CLS10-MATHS are split into
+// class and subject; v1 has no topics, so every quiz gets -topic. Items go to
+// the default tenant and overwrite v2 items with the same key, so run it
+// before students start using v2. Item statistics and leaderboards are not
+// backfilled.
+//
+// The Postgres connection uses the DB_* variables of the lambda, and
+// DYNAMODB_ENDPOINT may point at DynamoDB Local. Progress is saved to the
+// checkpoint file after every page, and running again resumes from it.
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"go-upload-excel/handlers"
+
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+type migrator struct {
+	db             *sql.DB
+	uids           map[string]string
+	topic          string
+	pageSize       int
+	dryRun         bool
+	checkpoint     *Checkpoint
+	checkpointPath string
+	// Reference data for conversion and reconciliation
+	knownCategories map[string]bool
+	knownClasses    map[string]bool
+	quizCategories  map[string]string
+}
+
+type TableReport struct {
+	Source     string         `json:"source"`
+	Target     string         `json:"target"`
+	SourceRows int            `json:"sourceRows"`
+	Read       int            `json:"read"`
+	Migrated   int            `json:"migrated"`
+	Skipped    map[string]int `json:"skipped"`
+	Complete   bool           `json:"complete"`
+}
+
+type Report struct {
+	GeneratedAt string        `json:"generatedAt"`
+	DryRun      bool          `json:"dryRun"`
+	Tables      []TableReport `json:"tables"`
+	Mismatches  []Mismatch    `json:"mismatches"`
+}
+
+func main() {
+	mappingPath := flag.String("mapping", "", "CSV file of email,uid rows (required)")
+	schemaPath := flag.String("schema", "../../sql/init.sql", "v1 schema file")
+	checkpointPath := flag.String("checkpoint", "migrate-v1.checkpoint.json", "checkpoint file")
+	reportPath := flag.String("report", "migrate-v1.report.json", "reconciliation report file")
+	topic := flag.String("topic", "GENERAL", "topic given to migrated quizzes")
+	pageSize := flag.Int("page-size", 100, "rows read per page")
+	dryRun := flag.Bool("dry-run", false, "convert and report without writing to DynamoDB")
+	flag.Parse()
+
+	if *mappingPath == "" || *topic == "" || *pageSize <= 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*mappingPath, *schemaPath, *checkpointPath, *reportPath, *topic, *pageSize, *dryRun); err != nil {
+		log.Fatalf("❌ Migration failed: %v", err)
+	}
+}
+
+func run(mappingPath, schemaPath, checkpointPath, reportPath, topic string, pageSize int, dryRun bool) error {
+	uids, err := loadUIDMapping(mappingPath)
+	if err != nil {
+		return fmt.Errorf("reading mapping file: %v", err)
+	}
+	schema, err := parseSchema(schemaPath)
+	if err != nil {
+		return fmt.Errorf("reading schema file: %v", err)
+	}
+
+	db, err := handlers.ConnectDB()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := checkSchema(db, schema); err != nil {
+		return err
+	}
+
+	checkpoint := &Checkpoint{Tables: make(map[string]*TableProgress)}
+	if !dryRun {
+		if checkpoint, err = loadCheckpoint(checkpointPath); err != nil {
+			return fmt.Errorf("reading checkpoint: %v", err)
+		}
+	}
+
+	m := &migrator{
+		db:              db,
+		uids:            uids,
+		topic:           topic,
+		pageSize:        pageSize,
+		dryRun:          dryRun,
+		checkpoint:      checkpoint,
+		checkpointPath:  checkpointPath,
+		knownCategories: make(map[string]bool),
+		knownClasses:    make(map[string]bool),
+	}
+	for _, category := range handlers.VALID_CATEGORIES {
+		m.knownCategories[category] = true
+		if className, _, ok := handlers.SplitCategory(category); ok {
+			m.knownClasses[className] = true
+		}
+	}
+	if m.quizCategories, err = loadQuizCategories(db); err != nil {
+		return err
+	}
+
+	for _, table := range tableMigrations {
+		if err := m.migrate(table); err != nil {
+			return fmt.Errorf("migrating %s: %v", table.source, err)
+		}
+	}
+
+	report, err := m.reconcile()
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(reportPath, content, 0o644); err != nil {
+		return err
+	}
+
+	for _, table := range report.Tables {
+		log.Printf("📌 %s -> %s: %d rows, %d migrated, %d skipped", table.Source, table.Target, table.SourceRows, table.Migrated, table.Read-table.Migrated)
+	}
+	log.Printf("✅ Migration finished with %d mismatches, report written to %s", len(report.Mismatches), reportPath)
+	return nil
+}
+
+// migrate copies a table page by page, resuming after the last checkpointed
+// key. A page is counted only once it is written.
+func (m *migrator) migrate(table tableMigration) error {
+	progress := m.checkpoint.progress(table.source)
+	if progress.Done {
+		log.Printf("📌 %s already migrated, skipping", table.source)
+		return nil
+	}
+
+	for {
+		lastKey := progress.LastKey
+		if lastKey == "" {
+			lastKey = table.start
+		}
+		rows, err := m.db.Query(table.query, lastKey, m.pageSize)
+		if err != nil {
+			return err
+		}
+
+		items := []map[string]*dynamodb.AttributeValue{}
+		var page []record
+		for rows.Next() {
+			rec, err := table.convert(m, rows)
+			if err != nil {
+				rows.Close()
+				return err
+			}
+			if rec.item != nil {
+				av, err := dynamodbattribute.MarshalMap(rec.item)
+				if err != nil {
+					rows.Close()
+					return err
+				}
+				items = append(items, av)
+			}
+			page = append(page, rec)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(page) == 0 {
+			progress.Done = true
+			if err := m.addTaxonomy(table); err != nil {
+				return err
+			}
+			return m.saveCheckpoint()
+		}
+
+		if !m.dryRun {
+			if err := handlers.BatchPutItems(table.target, items); err != nil {
+				return err
+			}
+		}
+
+		for _, rec := range page {
+			progress.Read++
+			if rec.skip != "" {
+				progress.Skipped[skipReason(rec.skip)]++
+				m.checkpoint.Mismatches = append(m.checkpoint.Mismatches, Mismatch{Table: table.source, Key: rec.key, Problem: rec.skip, Skipped: true})
+				continue
+			}
+			progress.Migrated++
+			for _, problem := range rec.problems {
+				m.checkpoint.Mismatches = append(m.checkpoint.Mismatches, Mismatch{Table: table.source, Key: rec.key, Problem: problem})
+			}
+		}
+		progress.LastKey = page[len(page)-1].key
+		log.Printf("📌 %s: %d rows read, last key %s", table.source, progress.Read, progress.LastKey)
+
+		if err := m.saveCheckpoint(); err != nil {
+			return err
+		}
+	}
+}
+
+// addTaxonomy adds the class, subject and topic of every quiz to the
+// taxonomy once the quizzes are written
+func (m *migrator) addTaxonomy(table tableMigration) error {
+	if table.source != "quiz_questions" || m.dryRun {
+		return nil
+	}
+	subjects := make(map[[2]string]bool)
+	for _, category := range m.quizCategories {
+		if className, subjectName, ok := handlers.SplitCategory(category); ok {
+			subjects[[2]string{className, subjectName}] = true
+		}
+	}
+
+	// InsertTopic creates the class and subject if needed and keeps existing
+	// topics
+	for subject := range subjects {
+		if err := handlers.InsertTopic(handlers.DefaultTenantID, subject[0], subject[1], m.topic); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migrator) saveCheckpoint() error {
+	if m.dryRun {
+		return nil
+	}
+	return m.checkpoint.save(m.checkpointPath)
+}
+
+func (m *migrator) uid(email string) (string, bool) {
+	uid, ok := m.uids[strings.ToLower(strings.TrimSpace(email))]
+	return uid, ok
+}
+
+// reconcile compares the rows in Postgres with what was read and migrated
+func (m *migrator) reconcile() (*Report, error) {
+	report := &Report{
+		GeneratedAt: time.Now().UTC().Format(v2TimeLayout),
+		DryRun:      m.dryRun,
+		Mismatches:  m.checkpoint.Mismatches,
+	}
+	for _, table := range tableMigrations {
+		var count int
+		if err := m.db.QueryRow("SELECT COUNT(*) FROM " + table.source).Scan(&count); err != nil {
+			return nil, err
+		}
+
+		progress := m.checkpoint.progress(table.source)
+		report.Tables = append(report.Tables, TableReport{
+			Source:     table.source,
+			Target:     table.target,
+			SourceRows: count,
+			Read:       progress.Read,
+			Migrated:   progress.Migrated,
+			Skipped:    progress.Skipped,
+			Complete:   progress.Done,
+		})
+		if progress.Done && count != progress.Read {
+			report.Mismatches = append(report.Mismatches, Mismatch{
+				Table:   table.source,
+				Problem: fmt.Sprintf("%d rows in Postgres but %d read; rows changed during the migration", count, progress.Read),
+			})
+		}
+	}
+	return report, nil
+}
+
+// skipReason groups skipped rows by reason without the row's own values
+func skipReason(skip string) string {
+	for _, prefix := range []string{"no uid for", "bad category"} {
+		if strings.HasPrefix(skip, prefix) {
+			return prefix
+		}
+	}
+	return skip
+}
+
+// loadUIDMapping reads email,uid rows; a header row is allowed
+func loadUIDMapping(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	uids := make(map[string]string)
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	for line := 1; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		email := strings.ToLower(strings.TrimSpace(row[0]))
+		uid := strings.TrimSpace(row[1])
+		if line == 1 && email == "email" {
+			continue
+		}
+		if email == "" || uid == "" {
+			return nil, fmt.Errorf("line %d: empty email or uid", line)
+		}
+		if existing, ok := uids[email]; ok && existing != uid {
+			return nil, fmt.Errorf("line %d: %s maps to both %s and %s", line, email, existing, uid)
+		}
+		uids[email] = uid
+	}
+	return uids, nil
+}
+
+func loadQuizCategories(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query(`SELECT quiz_name, category FROM quiz_questions`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := make(map[string]string)
+	for rows.Next() {
+		var quizName, category string
+		if err := rows.Scan(&quizName, &category); err != nil {
+			return nil, err
+		}
+		categories[quizName] = category
+	}
+	return categories, rows.Err()
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// v1 columns the migration reads, per table
+var v1Columns = map[string][]string{
+	"students":              {"id", "email", "phone_number", "name", "student_class", "payment_time", "updated_by", "sub_exp_date", "amount", "role"},
+	"quiz_questions":        {"id", "quiz_name", "duration", "category", "questions"},
+	"student_quizzes":       {"email", "quiz_names"},
+	"student_quiz_attempts": {"id", "email", "quiz_name", "category", "correct_count", "wrong_count", "skipped_count", "total_count", "percentage", "attempt_number", "attempted_at", "results"},
+}
+
+var createTablePattern = regexp.MustCompile(`(?is)CREATE TABLE(?:\s+IF NOT EXISTS)?\s+(\w+)\s*\((.*?)\n\);`)
+
+// Lines of a CREATE TABLE body that declare constraints, not columns
+var constraintKeywords = []string{"CONSTRAINT", "UNIQUE", "PRIMARY", "FOREIGN", "REFERENCES", "CHECK", "ON"}
+
+// parseSchema returns the columns of every table created in a schema file
+func parseSchema(path string) (map[string][]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make(map[string][]string)
+	for _, match := range createTablePattern.FindAllStringSubmatch(string(content), -1) {
+		table := strings.ToLower(match[1])
+		for _, line := range strings.Split(match[2], "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 0 || strings.HasPrefix(fields[0], "--") {
+				continue
+			}
+			// UNIQUE(email, quiz_name) has no space before its columns
+			word := strings.SplitN(fields[0], "(", 2)[0]
+			if isConstraint(word) {
+				continue
+			}
+			tables[table] = append(tables[table], strings.ToLower(word))
+		}
+	}
+	return tables, nil
+}
+
+func isConstraint(word string) bool {
+	for _, keyword := range constraintKeywords {
+		if strings.EqualFold(word, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkSchema makes sure every column the migration reads is declared in the
+// schema file and present in the database
+func checkSchema(db *sql.DB, schema map[string][]string) error {
+	for table, columns := range v1Columns {
+		declared, ok := schema[table]
+		if !ok {
+			return fmt.Errorf("table %s is not in the schema file", table)
+		}
+
+		live := make(map[string]bool)
+		rows, err := db.Query(`SELECT column_name FROM information_schema.columns WHERE table_name = $1`, table)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var column string
+			if err := rows.Scan(&column); err != nil {
+				rows.Close()
+				return err
+			}
+			live[strings.ToLower(column)] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		for _, column := range columns {
+			if !containsColumn(declared, column) {
+				return fmt.Errorf("column %s.%s is not in the schema file", table, column)
+			}
+			if !live[column] {
+				return fmt.Errorf("column %s.%s is missing from the database", table, column)
+			}
+		}
+	}
+	return nil
+}
+
+func containsColumn(columns []string, column string) bool {
+	for _, c := range columns {
+		if c == column {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go-upload-excel/handlers"
+)
+
+// Layout of timestamps in v2 items
+const v2TimeLayout = "2006-01-02T15:04:05Z"
+
+// Row of a v1 table converted to a v2 item. A row with skip set is not
+// migrated; problems are reported but do not stop the row.
+type record struct {
+	key      string
+	item     interface{}
+	skip     string
+	problems []string
+}
+
+// Maps one v1 table to one v2 table. The query takes the last key read, or
+// start on the first page, and the page size, and returns rows in key order.
+type tableMigration struct {
+	source  string
+	target  string
+	query   string
+	start   string
+	convert func(m *migrator, rows *sql.Rows) (record, error)
+}
+
+var tableMigrations = []tableMigration{
+	{
+		source: "students",
+		target: "students_info",
+		query: `SELECT id, email, COALESCE(phone_number, ''), COALESCE(name, ''), student_class, payment_time, updated_by, sub_exp_date, amount, role
+			FROM students WHERE id > $1 ORDER BY id LIMIT $2`,
+		start:   "0",
+		convert: convertStudent,
+	},
+	{
+		source:  "quiz_questions",
+		target:  "quiz_questions",
+		query:   `SELECT id, quiz_name, duration, category, questions FROM quiz_questions WHERE id > $1 ORDER BY id LIMIT $2`,
+		start:   "0",
+		convert: convertQuiz,
+	},
+	{
+		source:  "student_quizzes",
+		target:  "student_quizzes_v2",
+		query:   `SELECT email, quiz_names FROM student_quizzes WHERE email > $1 ORDER BY email LIMIT $2`,
+		convert: convertStudentQuizzes,
+	},
+	{
+		source: "student_quiz_attempts",
+		target: "student_quiz_attempts_v2",
+		query: `SELECT id, email, quiz_name, category, correct_count, wrong_count, skipped_count, total_count, percentage, attempt_number, attempted_at, results
+			FROM student_quiz_attempts WHERE id > $1 ORDER BY id LIMIT $2`,
+		start:   "0",
+		convert: convertAttempt,
+	},
+}
+
+// Item of the student_quizzes_v2 table
+type StudentQuizzesItem struct {
+	UID       string   `json:"uid" dynamodbav:"uid"`
+	QuizNames []string `json:"quiz_names" dynamodbav:"quiz_names"`
+	TenantID  string   `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+func convertStudent(m *migrator, rows *sql.Rows) (record, error) {
+	var (
+		id                        int64
+		email, phone, name, class string
+		paymentTime, subExpDate   sql.NullTime
+		updatedBy, role           sql.NullString
+		amount                    sql.NullFloat64
+	)
+	if err := rows.Scan(&id, &email, &phone, &name, &class, &paymentTime, &updatedBy, &subExpDate, &amount, &role); err != nil {
+		return record{}, err
+	}
+
+	rec := record{key: fmt.Sprint(id)}
+	uid, ok := m.uid(email)
+	if !ok {
+		rec.skip = "no uid for " + email
+		return rec, nil
+	}
+	if class != "DEMO" && !m.knownClasses[class] {
+		rec.problems = append(rec.problems, "unknown class "+class)
+	}
+
+	student := handlers.StudentInfoItem{
+		UID:          uid,
+		Email:        strings.ToLower(email),
+		Name:         name,
+		StudentClass: class,
+		PhoneNumber:  phone,
+		TenantID:     handlers.DefaultTenantID,
+	}
+	if subExpDate.Valid {
+		student.SubExpDate = subExpDate.Time.Format("2006-01-02")
+	}
+	if paymentTime.Valid {
+		student.PaymentTime = paymentTime.Time.UTC().Format(v2TimeLayout)
+	}
+	if updatedBy.Valid {
+		student.UpdatedBy = updatedBy.String
+	}
+	if amount.Valid {
+		student.Amount = amount.Float64
+	}
+	if role.Valid && role.String != "" {
+		student.Role = role.String
+	}
+	rec.item = student
+	return rec, nil
+}
+
+func convertQuiz(m *migrator, rows *sql.Rows) (record, error) {
+	var (
+		id                 int64
+		quizName, category string
+		duration           int
+		questionsJSON      []byte
+	)
+	if err := rows.Scan(&id, &quizName, &duration, &category, &questionsJSON); err != nil {
+		return record{}, err
+	}
+
+	rec := record{key: fmt.Sprint(id)}
+	className, subjectName, ok := handlers.SplitCategory(category)
+	if !ok {
+		rec.skip = "bad category " + category
+		return rec, nil
+	}
+	if !m.knownCategories[category] {
+		rec.problems = append(rec.problems, "unknown category "+category)
+	}
+
+	var questions []handlers.Question
+	if err := json.Unmarshal(questionsJSON, &questions); err != nil {
+		rec.skip = "unreadable questions"
+		return rec, nil
+	}
+	if len(questions) == 0 {
+		rec.problems = append(rec.problems, "no questions")
+	}
+
+	quiz := handlers.QuizData{
+		QuizName:    quizName,
+		Duration:    duration,
+		ClassName:   className,
+		SubjectName: subjectName,
+		Topic:       m.topic,
+		Questions:   questions,
+	}
+	if !m.dryRun {
+		// Same as an upload, so migrated quizzes share bank questions
+		ids, _, err := handlers.AddQuestionsToBank(handlers.DefaultTenantID, quiz, time.Now())
+		if err != nil {
+			return record{}, fmt.Errorf("adding questions of %s to the bank: %v", quizName, err)
+		}
+		quiz.QuestionIDs = ids
+	}
+	rec.item = handlers.QuizItem{
+		QuizName:    quiz.QuizName,
+		Duration:    quiz.Duration,
+		ClassName:   quiz.ClassName,
+		SubjectName: quiz.SubjectName,
+		Topic:       quiz.Topic,
+		Questions:   quiz.Questions,
+		QuestionIDs: quiz.QuestionIDs,
+		Version:     1,
+		TenantID:    handlers.DefaultTenantID,
+	}
+	return rec, nil
+}
+
+func convertStudentQuizzes(m *migrator, rows *sql.Rows) (record, error) {
+	var (
+		email         string
+		quizNamesJSON []byte
+	)
+	if err := rows.Scan(&email, &quizNamesJSON); err != nil {
+		return record{}, err
+	}
+
+	rec := record{key: email}
+	uid, ok := m.uid(email)
+	if !ok {
+		rec.skip = "no uid for " + email
+		return rec, nil
+	}
+
+	quizNames := []string{}
+	if err := json.Unmarshal(quizNamesJSON, &quizNames); err != nil {
+		rec.skip = "unreadable quiz_names"
+		return rec, nil
+	}
+	for _, quizName := range quizNames {
+		if _, ok := m.quizCategories[quizName]; !ok {
+			rec.problems = append(rec.problems, "unknown quiz "+quizName)
+		}
+	}
+
+	rec.item = StudentQuizzesItem{UID: uid, QuizNames: quizNames, TenantID: handlers.DefaultTenantID}
+	return rec, nil
+}
+
+func convertAttempt(m *migrator, rows *sql.Rows) (record, error) {
+	var (
+		id                                        int64
+		email, quizName, category                 string
+		correct, wrong, skipped, total, attemptNo int
+		percentage                                float64
+		attemptedAt                               time.Time
+		resultsJSON                               []byte
+	)
+	if err := rows.Scan(&id, &email, &quizName, &category, &correct, &wrong, &skipped, &total, &percentage, &attemptNo, &attemptedAt, &resultsJSON); err != nil {
+		return record{}, err
+	}
+
+	rec := record{key: fmt.Sprint(id)}
+	uid, ok := m.uid(email)
+	if !ok {
+		rec.skip = "no uid for " + email
+		return rec, nil
+	}
+	className, subjectName, ok := handlers.SplitCategory(category)
+	if !ok {
+		rec.skip = "bad category " + category
+		return rec, nil
+	}
+
+	results := []handlers.QuestionResult{}
+	if len(resultsJSON) > 0 {
+		if err := json.Unmarshal(resultsJSON, &results); err != nil {
+			rec.skip = "unreadable results"
+			return rec, nil
+		}
+	}
+
+	if quizCategory, ok := m.quizCategories[quizName]; !ok {
+		rec.problems = append(rec.problems, "unknown quiz "+quizName)
+	} else if quizCategory != category {
+		rec.problems = append(rec.problems, fmt.Sprintf("category %s differs from quiz category %s", category, quizCategory))
+	}
+	if correct+wrong+skipped != total {
+		rec.problems = append(rec.problems, fmt.Sprintf("counts %d+%d+%d do not add up to %d", correct, wrong, skipped, total))
+	}
+	if len(results) > 0 && len(results) != total {
+		rec.problems = append(rec.problems, fmt.Sprintf("%d results for %d questions", len(results), total))
+	}
+
+	rec.item = handlers.AttemptItem{
+		UID:           uid,
+		QuizName:      quizName,
+		ClassName:     className,
+		Category:      subjectName,
+		Topic:         m.topic,
+		CorrectCount:  correct,
+		WrongCount:    wrong,
+		SkippedCount:  skipped,
+		TotalCount:    total,
+		Percentage:    percentage,
+		AttemptNumber: attemptNo,
+		AttemptedAt:   attemptedAt.UTC().Format(v2TimeLayout),
+		Results:       results,
+		TenantID:      handlers.DefaultTenantID,
+	}
+	return rec, nil
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Adaptive sessions serve questions one at a time under a 1PL (Rasch) model.
+// Item difficulties are calibrated from quiz_item_stats when the session
+// starts; the ability estimate is the posterior mean (EAP) under a standard
+// normal prior and its SE the posterior standard deviation. The finished
+// session is stored as an attempt named after the session.
+const AdaptiveTopic = "ADAPTIVE"
+
+// Adaptive session statuses
+const (
+	AdaptiveActive    = "ACTIVE"
+	AdaptiveCompleted = "COMPLETED"
+)
+
+const (
+	defaultAdaptiveQuestions   = 20
+	maxAdaptiveQuestions       = 50
+	defaultAdaptiveSEThreshold = 0.4
+	// The SE rule only applies after this many answers
+	minAdaptiveQuestions = 5
+	// Items kept per session; the session row must stay under 400 KB
+	maxAdaptivePool = 1000
+	// Difficulties and abilities are clamped to this many logits
+	adaptiveLogitRange = 4.0
+	adaptiveSessionTTL = 24 * time.Hour
+)
+
+var errAdaptiveConflict = errors.New("adaptive session changed concurrently")
+
+// Calibrated question of the session pool
+type AdaptiveItem struct {
+	QuizName    string  `json:"quiz_name" dynamodbav:"quiz_name"`
+	ClassName   string  `json:"class_name" dynamodbav:"class_name"`
+	SubjectName string  `json:"subject_name" dynamodbav:"subject_name"`
+	Topic       string  `json:"topic" dynamodbav:"topic"`
+	Qno         int     `json:"qno" dynamodbav:"qno"`
+	Difficulty  float64 `json:"difficulty" dynamodbav:"difficulty"`
+}
+
+type AdaptiveResponse struct {
+	Item    AdaptiveItem   `json:"item" dynamodbav:"item"`
+	Correct bool           `json:"correct" dynamodbav:"correct"`
+	Result  QuestionResult `json:"result" dynamodbav:"result"`
+}
+
+// Adaptive session item structure, keyed by student and session
+type AdaptiveSession struct {
+	UID          string             `json:"uid" dynamodbav:"uid"`
+	SessionID    string             `json:"session_id" dynamodbav:"session_id"`
+	ClassName    string             `json:"class_name" dynamodbav:"class_name"`
+	SubjectName  string             `json:"subject_name" dynamodbav:"subject_name"`
+	Topics       []string           `json:"topics,omitempty" dynamodbav:"topics,omitempty"`
+	MaxQuestions int                `json:"max_questions" dynamodbav:"max_questions"`
+	SEThreshold  float64            `json:"se_threshold" dynamodbav:"se_threshold"`
+	Pool         []AdaptiveItem     `json:"pool" dynamodbav:"pool"`
+	Current      *AdaptiveItem      `json:"current,omitempty" dynamodbav:"current,omitempty"`
+	Responses    []AdaptiveResponse `json:"responses" dynamodbav:"responses"`
+	Answered     int                `json:"answered" dynamodbav:"answered"`
+	Theta        float64            `json:"theta" dynamodbav:"theta"`
+	SE           float64            `json:"se" dynamodbav:"se"`
+	Status       string             `json:"status" dynamodbav:"status"`
+	StartedAt    string             `json:"started_at" dynamodbav:"started_at"`
+	CompletedAt  string             `json:"completed_at,omitempty" dynamodbav:"completed_at,omitempty"`
+	ExpiresAt    int64              `json:"expires_at" dynamodbav:"expires_at"`
+	TenantID     string             `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+func adaptiveItemKey(item AdaptiveItem) string {
+	return questionKey(item.QuizName, item.Qno)
+}
+
+func clampLogit(value float64) float64 {
+	return math.Max(-adaptiveLogitRange, math.Min(adaptiveLogitRange, value))
+}
+
+// raschProbability is the chance of a correct answer at ability theta on an
+// item of difficulty b
+func raschProbability(theta, b float64) float64 {
+	return 1 / (1 + math.Exp(b-theta))
+}
+
+// calibrateDifficulty turns item counters into a Rasch difficulty. The p-value
+// is smoothed so that unseen items sit at 0 and perfect items stay finite.
+func calibrateDifficulty(counters map[string]int) float64 {
+	pValue := (float64(counters["correct"]) + 0.5) / (float64(counters["attempts"]) + 1)
+	return roundTo(clampLogit(math.Log((1-pValue)/pValue)), 3)
+}
+
+// EstimateAbility returns the EAP ability and its standard error, computed on
+// a grid over the logit range. With no responses it returns the prior.
+func EstimateAbility(responses []AdaptiveResponse) (float64, float64) {
+	const steps = 80
+	points := make([]float64, steps+1)
+	logPosterior := make([]float64, steps+1)
+	maxLog := math.Inf(-1)
+	for i := range points {
+		theta := -adaptiveLogitRange + 2*adaptiveLogitRange*float64(i)/steps
+		logDensity := -theta * theta / 2
+		for _, response := range responses {
+			p := raschProbability(theta, response.Item.Difficulty)
+			if response.Correct {
+				logDensity += math.Log(p)
+			} else {
+				logDensity += math.Log(1 - p)
+			}
+		}
+		points[i] = theta
+		logPosterior[i] = logDensity
+		maxLog = math.Max(maxLog, logDensity)
+	}
+
+	var weightSum, mean float64
+	weights := make([]float64, len(points))
+	for i := range points {
+		weights[i] = math.Exp(logPosterior[i] - maxLog)
+		weightSum += weights[i]
+		mean += weights[i] * points[i]
+	}
+	mean /= weightSum
+
+	var variance float64
+	for i := range points {
+		variance += weights[i] * (points[i] - mean) * (points[i] - mean)
+	}
+	variance /= weightSum
+
+	mean = roundTo(mean, 3)
+	if mean == 0 {
+		mean = 0 // drops the sign of -0
+	}
+	return mean, roundTo(math.Sqrt(variance), 3)
+}
+
+// BuildAdaptivePool calibrates the questions of the given quizzes, keeping a
+// random sample of at most maxAdaptivePool
+func BuildAdaptivePool(tenantID string, quizzes []QuizItem, topics []string) ([]AdaptiveItem, error) {
+	pool := []AdaptiveItem{}
+	for _, quiz := range quizzes {
+		if len(topics) > 0 && !containsString(topics, quiz.Topic) {
+			continue
+		}
+		// Adaptive answers show the correct option
+		if answersHidden(&quiz, time.Now()) {
+			continue
+		}
+		stats, err := FetchItemStats(tenantID, quiz.QuizName)
+		if err != nil {
+			return nil, err
+		}
+		for i := range quiz.Questions {
+			qno := i + 1
+			pool = append(pool, AdaptiveItem{
+				QuizName:    quiz.QuizName,
+				ClassName:   quiz.ClassName,
+				SubjectName: quiz.SubjectName,
+				Topic:       quiz.Topic,
+				Qno:         qno,
+				Difficulty:  calibrateDifficulty(stats[qno]),
+			})
+		}
+	}
+
+	rand.Shuffle(len(pool), func(i, j int) {
+		pool[i], pool[j] = pool[j], pool[i]
+	})
+	if len(pool) > maxAdaptivePool {
+		pool = pool[:maxAdaptivePool]
+	}
+	return pool, nil
+}
+
+// NextAdaptiveItem picks the unused item with the most information at the
+// current ability, which under Rasch is the one closest in difficulty. The
+// pool is shuffled, so ties go to a random item.
+func NextAdaptiveItem(session *AdaptiveSession) *AdaptiveItem {
+	used := make(map[string]bool)
+	for _, response := range session.Responses {
+		used[adaptiveItemKey(response.Item)] = true
+	}
+
+	var next *AdaptiveItem
+	for i := range session.Pool {
+		item := &session.Pool[i]
+		if used[adaptiveItemKey(*item)] {
+			continue
+		}
+		if next == nil || math.Abs(item.Difficulty-session.Theta) < math.Abs(next.Difficulty-session.Theta) {
+			next = item
+		}
+	}
+	if next == nil {
+		return nil
+	}
+	item := *next
+	return &item
+}
+
+// adaptiveStopReached applies the stopping rule: the question limit, or the
+// SE threshold once enough questions were answered
+func adaptiveStopReached(session *AdaptiveSession) bool {
+	if session.Answered >= session.MaxQuestions {
+		return true
+	}
+	return session.Answered >= minAdaptiveQuestions && session.SE <= session.SEThreshold
+}
+
+// RecordAdaptiveAnswer grades an answer to the current item, updates the
+// ability estimate and moves on to the next item or finishes the session
+func RecordAdaptiveAnswer(session *AdaptiveSession, question Question, options []string, now time.Time) AdaptiveResponse {
+	result := QuestionResult{
+		Qno:             session.Answered + 1,
+		Question:        question.Question,
+		Status:          "skipped",
+		StudentAnswer:   optionsText(question, options),
+		CorrectAnswer:   correctAnswerText(question),
+		Explanation:     question.Explanation,
+		SelectedOptions: []string{},
+	}
+	correct := false
+	if len(options) > 0 {
+		correct = isAnswerCorrect(question, options)
+		result.Status = "wrong"
+		if correct {
+			result.Status = "correct"
+		}
+		for _, option := range options {
+			result.SelectedOptions = append(result.SelectedOptions, strings.ToUpper(strings.TrimSpace(option)))
+		}
+	}
+
+	response := AdaptiveResponse{Item: *session.Current, Correct: correct, Result: result}
+	session.Responses = append(session.Responses, response)
+	session.Answered++
+	session.Theta, session.SE = EstimateAbility(session.Responses)
+
+	session.Current = nil
+	if !adaptiveStopReached(session) {
+		session.Current = NextAdaptiveItem(session)
+	}
+	if session.Current == nil {
+		session.Status = AdaptiveCompleted
+		session.CompletedAt = now.UTC().Format(subExpDateLayout)
+	}
+	return response
+}
+
+// AdaptiveAttempt turns a finished session into an attempt
+func AdaptiveAttempt(session *AdaptiveSession) AttemptItem {
+	attempt := AttemptItem{
+		UID:           session.UID,
+		QuizName:      session.SessionID,
+		ClassName:     session.ClassName,
+		Category:      session.SubjectName,
+		Topic:         AdaptiveTopic,
+		TotalCount:    len(session.Responses),
+		AttemptNumber: 1,
+		AttemptedAt:   session.CompletedAt,
+		Results:       []QuestionResult{},
+		Ability:       &session.Theta,
+		AbilitySE:     &session.SE,
+	}
+	for _, response := range session.Responses {
+		switch response.Result.Status {
+		case "correct":
+			attempt.CorrectCount++
+		case "wrong":
+			attempt.WrongCount++
+		default:
+			attempt.SkippedCount++
+		}
+		attempt.Results = append(attempt.Results, response.Result)
+	}
+	percentage := 0.0
+	if attempt.TotalCount > 0 {
+		percentage = float64(attempt.CorrectCount) / float64(attempt.TotalCount) * 100
+	}
+	attempt.Percentage = percentage
+	return attempt
+}
+
+// adaptiveSourceQuiz describes the session's questions as a quiz whose
+// sources are the original questions, so wrong answers can be queued for
+// review under the quiz they came from
+func adaptiveSourceQuiz(session *AdaptiveSession) *QuizItem {
+	quiz := &QuizItem{QuizName: session.SessionID, Sources: []QuestionSource{}}
+	for _, response := range session.Responses {
+		quiz.Sources = append(quiz.Sources, QuestionSource{
+			QuizName:    response.Item.QuizName,
+			ClassName:   response.Item.ClassName,
+			SubjectName: response.Item.SubjectName,
+			Topic:       response.Item.Topic,
+			Qno:         response.Item.Qno,
+		})
+	}
+	return quiz
+}
+
+// Save an adaptive session. A new session must not exist yet; an update only
+// succeeds if no answer was recorded since previousAnswered.
+func SaveAdaptiveSession(tenantID string, session AdaptiveSession, previousAnswered *int) error {
+	session.TenantID = normalizeTenantID(tenantID)
+	av, err := dynamodbattribute.MarshalMap(session)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String("adaptive_sessions"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(session_id)"),
+	}
+	if previousAnswered != nil {
+		input.ConditionExpression = aws.String("answered = :answered")
+		input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+			":answered": {N: aws.String(strconv.Itoa(*previousAnswered))},
+		}
+	}
+
+	_, err = dynamoClient.PutItem(input)
+	if isConditionFailure(err) {
+		return errAdaptiveConflict
+	}
+	return err
+}
+
+// Get a student's adaptive session within a tenant
+func GetAdaptiveSession(tenantID, uid, sessionID string) (*AdaptiveSession, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("adaptive_sessions"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid":        {S: aws.String(uid)},
+			"session_id": {S: aws.String(sessionID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var session AdaptiveSession
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &session); err != nil {
+		return nil, err
+	}
+	if !belongsToTenant(session.TenantID, tenantID) {
+		return nil, nil
+	}
+	return &session, nil
+}
@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type AdaptiveStartRequest struct {
+	SubjectName  string   `json:"subjectName"`
+	Topics       []string `json:"topics,omitempty"`
+	MaxQuestions int      `json:"maxQuestions,omitempty"`
+	SEThreshold  float64  `json:"seThreshold,omitempty"`
+}
+
+type AdaptiveAnswerRequest struct {
+	SessionID string   `json:"sessionId"`
+	Options   []string `json:"options"`
+}
+
+// adaptiveQuestion loads the session's current question. Items whose quiz was
+// deleted or shortened are dropped from the pool and the next item is tried;
+// the session completes if none is left. changed reports whether the session
+// needs saving.
+func adaptiveQuestion(tenantID string, session *AdaptiveSession, now time.Time) (question *Question, changed bool, err error) {
+	for session.Current != nil {
+		item := *session.Current
+		quiz, err := GetQuizByName(tenantID, item.QuizName)
+		if err != nil {
+			return nil, changed, err
+		}
+		if quiz != nil && item.Qno >= 1 && item.Qno <= len(quiz.Questions) {
+			return &quiz.Questions[item.Qno-1], changed, nil
+		}
+
+		pool := []AdaptiveItem{}
+		for _, poolItem := range session.Pool {
+			if adaptiveItemKey(poolItem) != adaptiveItemKey(item) {
+				pool = append(pool, poolItem)
+			}
+		}
+		session.Pool = pool
+		session.Current = NextAdaptiveItem(session)
+		changed = true
+	}
+
+	if session.Status != AdaptiveCompleted {
+		session.Status = AdaptiveCompleted
+		session.CompletedAt = now.UTC().Format(subExpDateLayout)
+		changed = true
+	}
+	return nil, changed, nil
+}
+
+// adaptiveState is the part of a session shown to the student
+func adaptiveState(session *AdaptiveSession, question *Question) map[string]interface{} {
+	state := map[string]interface{}{
+		"sessionId":    session.SessionID,
+		"subjectName":  session.SubjectName,
+		"status":       session.Status,
+		"answered":     session.Answered,
+		"maxQuestions": session.MaxQuestions,
+		"ability":      session.Theta,
+		"abilitySE":    session.SE,
+	}
+	if question != nil && session.Current != nil {
+		state["question"] = map[string]interface{}{
+			"qno":        session.Answered + 1,
+			"topic":      session.Current.Topic,
+			"question":   question.Question,
+			"allAnswers": question.AllAnswers,
+		}
+	}
+	if session.Status == AdaptiveCompleted {
+		// The attempt can be viewed with the regular result endpoint
+		state["result"] = map[string]interface{}{
+			"quizName":    session.SessionID,
+			"className":   session.ClassName,
+			"subjectName": session.SubjectName,
+			"topic":       AdaptiveTopic,
+		}
+	}
+	return state
+}
+
+// saveAdaptiveProgress saves a session changed since previousAnswered answers.
+// When it completes, its attempt is stored first: the attempt is keyed by the
+// session ID, so a retry after a failed session save rewrites the same
+// attempt, while a session saved as completed without its attempt could not
+// be finished again.
+func saveAdaptiveProgress(tenantID string, session *AdaptiveSession, previousAnswered int, wasCompleted bool, now time.Time) error {
+	completing := session.Status == AdaptiveCompleted && !wasCompleted
+	var attempt AttemptItem
+	if completing {
+		attempt = AdaptiveAttempt(session)
+		if err := SaveAttemptToDynamoDB(tenantID, attempt); err != nil {
+			return err
+		}
+	}
+	if err := SaveAdaptiveSession(tenantID, *session, &previousAnswered); err != nil {
+		return err
+	}
+	if completing {
+		if err := QueueWrongAnswers(tenantID, adaptiveSourceQuiz(session), attempt, now); err != nil {
+			log.Printf("⚠️ Error queueing reviews for %s: %v", session.SessionID, err)
+		}
+	}
+	return nil
+}
+
+func adaptiveJSONResponse(statusCode int, body map[string]interface{}) events.APIGatewayProxyResponse {
+	responseJSON, _ := json.Marshal(body)
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}
+}
+
+// HandleAdaptiveStart starts an adaptive session for the caller over the
+// quizzes of their class in a subject and returns the first question
+func HandleAdaptiveStart(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req AdaptiveStartRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.SubjectName == "" {
+		return CreateErrorResponse(400, "Missing 'subjectName' parameter"), nil
+	}
+	if req.MaxQuestions == 0 {
+		req.MaxQuestions = defaultAdaptiveQuestions
+	}
+	if req.MaxQuestions < minAdaptiveQuestions || req.MaxQuestions > maxAdaptiveQuestions {
+		return CreateErrorResponse(400, fmt.Sprintf("'maxQuestions' must be between %d and %d", minAdaptiveQuestions, maxAdaptiveQuestions)), nil
+	}
+	if req.SEThreshold == 0 {
+		req.SEThreshold = defaultAdaptiveSEThreshold
+	}
+	if req.SEThreshold < 0 || req.SEThreshold >= 1 {
+		return CreateErrorResponse(400, "'seThreshold' must be between 0 and 1"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+	if resp, denied := subscriptionDeniedResponse(student, student.StudentClass, req.SubjectName); denied {
+		return resp, nil
+	}
+
+	quizzes, err := ListQuizzes(tenantID, student.StudentClass, req.SubjectName, "")
+	if err != nil {
+		log.Printf("❌ Error listing quizzes: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	pool, err := BuildAdaptivePool(tenantID, quizzes, req.Topics)
+	if err != nil {
+		log.Printf("❌ Error calibrating questions: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if len(pool) == 0 {
+		return CreateErrorResponse(404, "No questions match the filters"), nil
+	}
+
+	now := time.Now()
+	session := &AdaptiveSession{
+		UID:          uid,
+		SessionID:    fmt.Sprintf("adaptive_%d", now.UnixNano()),
+		ClassName:    student.StudentClass,
+		SubjectName:  req.SubjectName,
+		Topics:       req.Topics,
+		MaxQuestions: req.MaxQuestions,
+		SEThreshold:  req.SEThreshold,
+		Pool:         pool,
+		Responses:    []AdaptiveResponse{},
+		Status:       AdaptiveActive,
+		StartedAt:    now.UTC().Format(subExpDateLayout),
+		ExpiresAt:    now.Add(adaptiveSessionTTL).Unix(),
+	}
+	session.Theta, session.SE = EstimateAbility(nil)
+	session.Current = NextAdaptiveItem(session)
+
+	question, _, err := adaptiveQuestion(tenantID, session, now)
+	if err != nil {
+		log.Printf("❌ Error fetching question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if question == nil {
+		return CreateErrorResponse(404, "No questions match the filters"), nil
+	}
+
+	if err := SaveAdaptiveSession(tenantID, *session, nil); err != nil {
+		log.Printf("❌ Error saving adaptive session: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	log.Printf("📌 Adaptive session %s started for %s with %d items", session.SessionID, uid, len(pool))
+	return adaptiveJSONResponse(201, adaptiveState(session, question)), nil
+}
+
+// HandleAdaptiveNext returns the session's pending question, or its final
+// state once completed. Calling it again serves the same question.
+func HandleAdaptiveNext(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	sessionID := request.QueryStringParameters["sessionId"]
+	if sessionID == "" {
+		return CreateErrorResponse(400, "Missing 'sessionId' parameter"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	session, err := GetAdaptiveSession(tenantID, uid, sessionID)
+	if err != nil {
+		log.Printf("❌ Error fetching adaptive session: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if session == nil {
+		return CreateErrorResponse(404, "Session not found"), nil
+	}
+
+	now := time.Now()
+	wasCompleted := session.Status == AdaptiveCompleted
+	question, changed, err := adaptiveQuestion(tenantID, session, now)
+	if err != nil {
+		log.Printf("❌ Error fetching question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if changed {
+		err := saveAdaptiveProgress(tenantID, session, session.Answered, wasCompleted, now)
+		if errors.Is(err, errAdaptiveConflict) {
+			return CreateErrorResponse(409, "Session was updated, please retry"), nil
+		}
+		if err != nil {
+			log.Printf("❌ Error saving adaptive session: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+	}
+
+	return adaptiveJSONResponse(200, adaptiveState(session, question)), nil
+}
+
+// HandleAdaptiveAnswer grades the answer to the pending question, updates the
+// ability estimate and returns the next question or the final result. Empty
+// options skip the question, which counts as wrong for the estimate.
+func HandleAdaptiveAnswer(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req AdaptiveAnswerRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.SessionID == "" {
+		return CreateErrorResponse(400, "Missing 'sessionId' parameter"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	session, err := GetAdaptiveSession(tenantID, uid, req.SessionID)
+	if err != nil {
+		log.Printf("❌ Error fetching adaptive session: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if session == nil {
+		return CreateErrorResponse(404, "Session not found"), nil
+	}
+	if session.Status == AdaptiveCompleted {
+		return CreateErrorResponse(409, "Session already completed"), nil
+	}
+
+	now := time.Now()
+	previousAnswered := session.Answered
+	question, _, err := adaptiveQuestion(tenantID, session, now)
+	if err != nil {
+		log.Printf("❌ Error fetching question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var answer *AdaptiveResponse
+	if question != nil {
+		response := RecordAdaptiveAnswer(session, *question, req.Options, now)
+		answer = &response
+		question, _, err = adaptiveQuestion(tenantID, session, now)
+		if err != nil {
+			log.Printf("❌ Error fetching question: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+	}
+
+	err = saveAdaptiveProgress(tenantID, session, previousAnswered, false, now)
+	if errors.Is(err, errAdaptiveConflict) {
+		return CreateErrorResponse(409, "Question was already answered"), nil
+	}
+	if err != nil {
+		log.Printf("❌ Error saving adaptive session: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	state := adaptiveState(session, question)
+	if answer != nil {
+		state["answer"] = map[string]interface{}{
+			"qno":           answer.Result.Qno,
+			"status":        answer.Result.Status,
+			"correctAnswer": answer.Result.CorrectAnswer,
+			"explanation":   answer.Result.Explanation,
+		}
+	}
+	return adaptiveJSONResponse(200, state), nil
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCalibrateDifficulty(t *testing.T) {
+	tests := []struct {
+		name     string
+		counters map[string]int
+		want     float64
+	}{
+		{"unseen item", map[string]int{}, 0},
+		{"half correct", map[string]int{"attempts": 10, "correct": 5}, 0},
+		{"all correct", map[string]int{"attempts": 10, "correct": 10}, -3.045},
+		{"all wrong", map[string]int{"attempts": 10, "correct": 0}, 3.045},
+		{"mostly correct", map[string]int{"attempts": 100, "correct": 80}, -1.368},
+		{"clamped when hard", map[string]int{"attempts": 1000, "correct": 0}, adaptiveLogitRange},
+		{"clamped when easy", map[string]int{"attempts": 1000, "correct": 1000}, -adaptiveLogitRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := calibrateDifficulty(tt.counters); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// adaptiveResponses answers items of the given difficulties, correct or not
+func adaptiveResponses(correct bool, difficulties ...float64) []AdaptiveResponse {
+	responses := []AdaptiveResponse{}
+	for _, b := range difficulties {
+		responses = append(responses, AdaptiveResponse{Item: AdaptiveItem{Difficulty: b}, Correct: correct})
+	}
+	return responses
+}
+
+func TestEstimateAbility(t *testing.T) {
+	tests := []struct {
+		name      string
+		responses []AdaptiveResponse
+		// Bounds on the estimate and its standard error
+		minTheta, maxTheta float64
+		minSE, maxSE       float64
+	}{
+		{"prior", nil, 0, 0, 0.95, 1},
+		{"one correct", adaptiveResponses(true, 0), 0.2, 0.6, 0.8, 0.95},
+		{"one wrong", adaptiveResponses(false, 0), -0.6, -0.2, 0.8, 0.95},
+		{"all correct", adaptiveResponses(true, -1, 0, 1, 1, 2), 1, 3, 0, 0.9},
+		{"all wrong", adaptiveResponses(false, -2, -1, -1, 0, 1), -3, -1, 0, 0.9},
+		{"mixed around zero", append(adaptiveResponses(true, -1, 0, 0, 1), adaptiveResponses(false, -1, 0, 0, 1)...), -0.01, 0.01, 0, 0.7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			theta, se := EstimateAbility(tt.responses)
+			if theta < tt.minTheta || theta > tt.maxTheta {
+				t.Errorf("got ability %v, want between %v and %v", theta, tt.minTheta, tt.maxTheta)
+			}
+			if se < tt.minSE || se > tt.maxSE {
+				t.Errorf("got SE %v, want between %v and %v", se, tt.minSE, tt.maxSE)
+			}
+		})
+	}
+}
+
+func TestEstimateAbilityIsSymmetric(t *testing.T) {
+	difficulties := []float64{-1.5, -0.3, 0.4, 2}
+	right, rightSE := EstimateAbility(adaptiveResponses(true, difficulties...))
+	for i := range difficulties {
+		difficulties[i] = -difficulties[i]
+	}
+	wrong, wrongSE := EstimateAbility(adaptiveResponses(false, difficulties...))
+	if math.Abs(right+wrong) > 0.001 || math.Abs(rightSE-wrongSE) > 0.001 {
+		t.Errorf("got %v (SE %v) and %v (SE %v), want mirrored estimates", right, rightSE, wrong, wrongSE)
+	}
+}
+
+func TestEstimateAbilityNarrowsWithAnswers(t *testing.T) {
+	var responses []AdaptiveResponse
+	previousSE := math.Inf(1)
+	for i := 0; i < 10; i++ {
+		responses = append(responses, AdaptiveResponse{Item: AdaptiveItem{Difficulty: 0}, Correct: i%2 == 0})
+		_, se := EstimateAbility(responses)
+		if se >= previousSE {
+			t.Fatalf("SE rose from %v to %v after %d answers", previousSE, se, i+1)
+		}
+		previousSE = se
+	}
+}
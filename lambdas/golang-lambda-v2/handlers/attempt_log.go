@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Every saved attempt, kept in attempt_log after a retake replaces it in
+// student_quiz_attempts_v2. attempt_key is "<attempted_at>#<quiz_name>".
+type AttemptLogItem struct {
+	AttemptItem
+	AttemptKey string `json:"attempt_key" dynamodbav:"attempt_key"`
+}
+
+func attemptLogKey(attempt AttemptItem) string {
+	return attempt.AttemptedAt + "#" + attempt.QuizName
+}
+
+// attemptLogPut logs an attempt next to its save in student_quiz_attempts_v2
+func attemptLogPut(attempt AttemptItem) (*dynamodb.TransactWriteItem, error) {
+	av, err := dynamodbattribute.MarshalMap(AttemptLogItem{
+		AttemptItem: attempt,
+		AttemptKey:  attemptLogKey(attempt),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			TableName: aws.String("attempt_log"),
+			Item:      av,
+		},
+	}, nil
+}
+
+// GetAttemptHistory returns every attempt of a student. Attempts saved before
+// the log existed are only in student_quiz_attempts_v2 and are added from there.
+func GetAttemptHistory(tenantID, uid string) ([]AttemptItem, error) {
+	logged, err := queryAttempts("attempt_log", &dynamodb.QueryInput{
+		KeyConditionExpression: aws.String("uid = :uid"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+		},
+	}, tenantID, "")
+	if err != nil {
+		return nil, err
+	}
+	latest, err := GetStudentAttempts(tenantID, uid)
+	if err != nil {
+		return nil, err
+	}
+	return mergeAttemptLog(logged, latest), nil
+}
+
+// FetchClassSubjectAttempts returns every attempt of a class in a subject
+// since a time, using the category GSIs of the log and of
+// student_quiz_attempts_v2 for attempts saved before the log existed
+func FetchClassSubjectAttempts(tenantID, className, subjectName string, since time.Time) ([]AttemptItem, error) {
+	query := func(tableName string) ([]AttemptItem, error) {
+		return queryAttempts(tableName, &dynamodb.QueryInput{
+			IndexName:              aws.String("category-index"),
+			KeyConditionExpression: aws.String("category = :category AND attempted_at >= :since"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":category":  {S: aws.String(subjectName)},
+				":since":     {S: aws.String(since.UTC().Format(subExpDateLayout))},
+				":className": {S: aws.String(className)},
+			},
+		}, tenantID, "class_name = :className")
+	}
+
+	logged, err := query("attempt_log")
+	if err != nil {
+		return nil, err
+	}
+	latest, err := query("student_quiz_attempts_v2")
+	if err != nil {
+		return nil, err
+	}
+	return withoutPracticeAttempts(mergeAttemptLog(logged, latest)), nil
+}
+
+// queryAttempts pages through a query of attempts, keeping the tenant's
+// items that also match filter
+func queryAttempts(tableName string, input *dynamodb.QueryInput, tenantID, filter string) ([]AttemptItem, error) {
+	condition := tenantCondition(tenantID, input.ExpressionAttributeValues)
+	if filter != "" {
+		condition = filter + " AND " + condition
+	}
+	input.TableName = aws.String(tableName)
+	input.FilterExpression = aws.String(condition)
+
+	attempts := []AttemptItem{}
+	var unmarshalErr error
+	err := dynamoClient.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageAttempts []AttemptItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageAttempts); unmarshalErr != nil {
+			return false
+		}
+		attempts = append(attempts, pageAttempts...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attempts, unmarshalErr
+}
+
+// mergeAttemptLog adds the latest attempts missing from the log to it
+func mergeAttemptLog(logged, latest []AttemptItem) []AttemptItem {
+	seen := make(map[string]bool)
+	for _, attempt := range logged {
+		seen[attempt.UID+"#"+attemptLogKey(attempt)] = true
+	}
+	for _, attempt := range latest {
+		if !seen[attempt.UID+"#"+attemptLogKey(attempt)] {
+			logged = append(logged, attempt)
+		}
+	}
+	return logged
+}
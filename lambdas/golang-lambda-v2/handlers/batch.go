@@ -0,0 +1,302 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var ErrStudentNotInTenant = errors.New("student not found in tenant")
+
+// Batch (section) item structure. batch_id is scoped to the tenant.
+type BatchItem struct {
+	BatchID     string   `json:"batch_id" dynamodbav:"batch_id"`
+	Name        string   `json:"name" dynamodbav:"name"`
+	ClassName   string   `json:"class_name" dynamodbav:"class_name"`
+	TeacherUIDs []string `json:"teacher_uids" dynamodbav:"teacher_uids"`
+	TenantID    string   `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+// Assignment item structure, keyed by batch and assignment
+type AssignmentItem struct {
+	BatchID      string `json:"batch_id" dynamodbav:"batch_id"`
+	AssignmentID string `json:"assignment_id" dynamodbav:"assignment_id"`
+	QuizName     string `json:"quiz_name" dynamodbav:"quiz_name"`
+	ClassName    string `json:"class_name" dynamodbav:"class_name"`
+	Category     string `json:"category" dynamodbav:"category"`
+	Topic        string `json:"topic" dynamodbav:"topic"`
+	OpenAt       string `json:"open_at" dynamodbav:"open_at"`
+	DueAt        string `json:"due_at" dynamodbav:"due_at"`
+	CreatedBy    string `json:"created_by" dynamodbav:"created_by"`
+	CreatedAt    string `json:"created_at" dynamodbav:"created_at"`
+	TenantID     string `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+// Assignment statuses as seen by a student
+const (
+	AssignmentUpcoming  = "UPCOMING"
+	AssignmentPending   = "PENDING"
+	AssignmentOverdue   = "OVERDUE"
+	AssignmentCompleted = "COMPLETED"
+)
+
+// Save batch to DynamoDB, refusing to overwrite another tenant's batch
+func SaveBatchToDynamoDB(tenantID string, batch BatchItem) error {
+	batch.TenantID = normalizeTenantID(tenantID)
+	batch.BatchID = scopedKey(tenantID, batch.BatchID)
+	av, err := dynamodbattribute.MarshalMap(batch)
+	if err != nil {
+		return err
+	}
+
+	values := map[string]*dynamodb.AttributeValue{}
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName:                 aws.String("batches"),
+		Item:                      av,
+		ConditionExpression:       aws.String("attribute_not_exists(batch_id) OR " + tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	})
+	return err
+}
+
+// Get batch by ID within a tenant
+func GetBatch(tenantID, batchID string) (*BatchItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("batches"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"batch_id": {S: aws.String(scopedKey(tenantID, batchID))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var batch BatchItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &batch); err != nil {
+		return nil, err
+	}
+	if !belongsToTenant(batch.TenantID, tenantID) {
+		return nil, nil
+	}
+	batch.BatchID = unscopedKey(tenantID, batch.BatchID)
+	return &batch, nil
+}
+
+// Fetch all batches of a tenant
+func FetchBatches(tenantID string) ([]BatchItem, error) {
+	values := map[string]*dynamodb.AttributeValue{}
+	batches := []BatchItem{}
+	var unmarshalErr error
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("batches"),
+		FilterExpression:          aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageBatches []BatchItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageBatches); unmarshalErr != nil {
+			return false
+		}
+		for _, batch := range pageBatches {
+			batch.BatchID = unscopedKey(tenantID, batch.BatchID)
+			batches = append(batches, batch)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return batches, unmarshalErr
+}
+
+// isBatchTeacher reports whether uid teaches the batch
+func isBatchTeacher(batch *BatchItem, uid string) bool {
+	return containsString(batch.TeacherUIDs, uid)
+}
+
+// SetBatchMembership adds or removes a batch on a student's batch_ids set.
+// Both operations are idempotent.
+func SetBatchMembership(tenantID, uid, batchID string, member bool) error {
+	action := "DELETE"
+	if member {
+		action = "ADD"
+	}
+
+	values := map[string]*dynamodb.AttributeValue{
+		":batch": {SS: []*string{aws.String(batchID)}},
+	}
+	condition := "attribute_exists(uid) AND " + tenantCondition(tenantID, values)
+
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("students_info"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {S: aws.String(uid)},
+		},
+		UpdateExpression:          aws.String(action + " batch_ids :batch"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
+	})
+	if isConditionFailure(err) {
+		return ErrStudentNotInTenant
+	}
+	return err
+}
+
+// Fetch the students of a batch within a tenant
+func FetchBatchStudents(tenantID, batchID string) ([]StudentInfoItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":batchId": {S: aws.String(batchID)},
+	}
+
+	students := []StudentInfoItem{}
+	var unmarshalErr error
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("students_info"),
+		FilterExpression:          aws.String("contains(batch_ids, :batchId) AND " + tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageStudents []StudentInfoItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageStudents); unmarshalErr != nil {
+			return false
+		}
+		students = append(students, pageStudents...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return students, unmarshalErr
+}
+
+// Save assignment to DynamoDB
+func SaveAssignmentToDynamoDB(tenantID string, assignment AssignmentItem) error {
+	assignment.TenantID = normalizeTenantID(tenantID)
+	assignment.BatchID = scopedKey(tenantID, assignment.BatchID)
+	av, err := dynamodbattribute.MarshalMap(assignment)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("assignments"),
+		Item:      av,
+	})
+	return err
+}
+
+// Get assignment by batch and ID
+func GetAssignment(tenantID, batchID, assignmentID string) (*AssignmentItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("assignments"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"batch_id":      {S: aws.String(scopedKey(tenantID, batchID))},
+			"assignment_id": {S: aws.String(assignmentID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var assignment AssignmentItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &assignment); err != nil {
+		return nil, err
+	}
+	assignment.BatchID = batchID
+	return &assignment, nil
+}
+
+// Fetch all assignments of a batch
+func FetchBatchAssignments(tenantID, batchID string) ([]AssignmentItem, error) {
+	result, err := dynamoClient.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("assignments"),
+		KeyConditionExpression: aws.String("batch_id = :batchId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":batchId": {S: aws.String(scopedKey(tenantID, batchID))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	assignments := []AssignmentItem{}
+	if err := dynamodbattribute.UnmarshalListOfMaps(result.Items, &assignments); err != nil {
+		return nil, err
+	}
+	for i := range assignments {
+		assignments[i].BatchID = batchID
+	}
+	return assignments, nil
+}
+
+// Delete an assignment
+func DeleteAssignment(tenantID, batchID, assignmentID string) error {
+	_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("assignments"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"batch_id":      {S: aws.String(scopedKey(tenantID, batchID))},
+			"assignment_id": {S: aws.String(assignmentID)},
+		},
+	})
+	return err
+}
+
+// parseDueDate treats a plain date as the end of that day
+func parseDueDate(value string) (time.Time, bool) {
+	due, ok := parseSubExpDate(value)
+	if ok && len(value) == len("2006-01-02") {
+		due = due.Add(24*time.Hour - time.Second)
+	}
+	return due, ok
+}
+
+// assignmentAttempt returns the attempt if it counts towards the assignment.
+// Attempts made before the assignment opened, e.g. when an old quiz is
+// assigned again, do not.
+func assignmentAttempt(assignment AssignmentItem, attempt *AttemptItem) *AttemptItem {
+	if attempt == nil {
+		return nil
+	}
+	open, ok := parseSubExpDate(assignment.OpenAt)
+	if !ok {
+		return attempt
+	}
+	attemptedAt, ok := parseSubExpDate(attempt.AttemptedAt)
+	if !ok || attemptedAt.Before(open) {
+		return nil
+	}
+	return attempt
+}
+
+// AssignmentStatus works out a student's status from their attempt, if any
+func AssignmentStatus(assignment AssignmentItem, attempt *AttemptItem, now time.Time) string {
+	if assignmentAttempt(assignment, attempt) != nil {
+		return AssignmentCompleted
+	}
+	if open, ok := parseSubExpDate(assignment.OpenAt); ok && now.Before(open) {
+		return AssignmentUpcoming
+	}
+	if due, ok := parseDueDate(assignment.DueAt); ok && now.After(due) {
+		return AssignmentOverdue
+	}
+	return AssignmentPending
+}
+
+// isLateSubmission reports whether the attempt came in after the due date
+func isLateSubmission(assignment AssignmentItem, attempt *AttemptItem) bool {
+	if attempt == nil {
+		return false
+	}
+	due, ok := parseDueDate(assignment.DueAt)
+	attemptedAt, attemptedOK := parseSubExpDate(attempt.AttemptedAt)
+	return ok && attemptedOK && attemptedAt.After(due)
+}
@@ -0,0 +1,549 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type BatchRequest struct {
+	BatchID     string   `json:"batchId"`
+	Name        string   `json:"name"`
+	ClassName   string   `json:"className"`
+	TeacherUIDs []string `json:"teacherUids"`
+}
+
+type BatchMembersRequest struct {
+	BatchID string   `json:"batchId"`
+	UIDs    []string `json:"uids"`
+	Action  string   `json:"action"` // "add" or "remove"
+}
+
+type AssignmentRequest struct {
+	BatchID     string `json:"batchId"`
+	QuizName    string `json:"quizName"`
+	ClassName   string `json:"className"`
+	SubjectName string `json:"subjectName"`
+	Topic       string `json:"topic"`
+	OpenAt      string `json:"openAt"`
+	DueAt       string `json:"dueAt"`
+}
+
+type AssignmentDeleteRequest struct {
+	BatchID      string `json:"batchId"`
+	AssignmentID string `json:"assignmentId"`
+}
+
+type StudentAssignment struct {
+	AssignmentID string  `json:"assignmentId"`
+	BatchID      string  `json:"batchId"`
+	BatchName    string  `json:"batchName"`
+	QuizName     string  `json:"quizName"`
+	ClassName    string  `json:"className"`
+	SubjectName  string  `json:"subjectName"`
+	Topic        string  `json:"topic"`
+	OpenAt       string  `json:"openAt"`
+	DueAt        string  `json:"dueAt"`
+	Status       string  `json:"status"`
+	Late         bool    `json:"late"`
+	Percentage   float64 `json:"percentage,omitempty"`
+	AttemptedAt  string  `json:"attemptedAt,omitempty"`
+}
+
+type AssignmentStudentReport struct {
+	UID           string  `json:"uid"`
+	Name          string  `json:"name"`
+	Email         string  `json:"email"`
+	Status        string  `json:"status"`
+	Late          bool    `json:"late"`
+	CorrectCount  int     `json:"correctCount"`
+	TotalCount    int     `json:"totalCount"`
+	Percentage    float64 `json:"percentage"`
+	AttemptNumber int     `json:"attemptNumber"`
+	AttemptedAt   string  `json:"attemptedAt,omitempty"`
+}
+
+// Batch APIs
+func HandleBatchUpsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var req BatchRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+
+	if req.BatchID == "" || req.Name == "" || req.ClassName == "" {
+		return CreateErrorResponse(400, "Missing 'batchId', 'name' or 'className' parameter"), nil
+	}
+
+	classes, err := FetchClasses(tenantID)
+	if err != nil {
+		log.Printf("Failed to fetch classes: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if !containsString(classes, req.ClassName) {
+		return CreateErrorResponse(400, "Unknown class"), nil
+	}
+
+	batch := BatchItem{
+		BatchID:     req.BatchID,
+		Name:        req.Name,
+		ClassName:   req.ClassName,
+		TeacherUIDs: req.TeacherUIDs,
+	}
+	if batch.TeacherUIDs == nil {
+		batch.TeacherUIDs = []string{}
+	}
+
+	if err := SaveBatchToDynamoDB(tenantID, batch); err != nil {
+		log.Printf("Failed to save batch: %v", err)
+		return CreateErrorResponse(500, "Failed to save batch"), nil
+	}
+
+	return CreateSuccessResponse("Batch saved successfully"), nil
+}
+
+// HandleBatchFetch lists all batches for admins and the caller's own batches for teachers
+func HandleBatchFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userRole, err := CheckTeacherRole(request)
+	if err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	userUID, _ := GetUserUIDFromContext(request)
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	batches, err := FetchBatches(tenantID)
+	if err != nil {
+		log.Printf("Failed to fetch batches: %v", err)
+		return CreateErrorResponse(500, "Failed to fetch batches"), nil
+	}
+
+	if userRole == "teacher" {
+		ownBatches := []BatchItem{}
+		for _, batch := range batches {
+			if isBatchTeacher(&batch, userUID) {
+				ownBatches = append(ownBatches, batch)
+			}
+		}
+		batches = ownBatches
+	}
+
+	response, _ := json.Marshal(batches)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(response),
+	}, nil
+}
+
+func HandleBatchMembers(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req BatchMembersRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.BatchID == "" || len(req.UIDs) == 0 {
+		return CreateErrorResponse(400, "Missing 'batchId' or 'uids' parameter"), nil
+	}
+	if req.Action != "add" && req.Action != "remove" {
+		return CreateErrorResponse(400, "'action' must be 'add' or 'remove'"), nil
+	}
+
+	batch, errResp, ok := authorizeBatch(request, req.BatchID)
+	if !ok {
+		return errResp, nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	updated := []string{}
+	failed := map[string]string{}
+	for _, uid := range req.UIDs {
+		if req.Action == "add" {
+			student, err := GetStudentInfoByUID(tenantID, uid)
+			if err != nil {
+				log.Printf("❌ Error fetching student %s: %v", uid, err)
+				failed[uid] = "lookup failed"
+				continue
+			}
+			if student == nil {
+				failed[uid] = "student not found"
+				continue
+			}
+			if student.StudentClass != batch.ClassName {
+				failed[uid] = "student is not in class " + batch.ClassName
+				continue
+			}
+		}
+
+		err := SetBatchMembership(tenantID, uid, batch.BatchID, req.Action == "add")
+		if errors.Is(err, ErrStudentNotInTenant) {
+			failed[uid] = "student not found"
+			continue
+		}
+		if err != nil {
+			log.Printf("❌ Error updating batch membership for %s: %v", uid, err)
+			failed[uid] = "update failed"
+			continue
+		}
+		updated = append(updated, uid)
+	}
+
+	response := map[string]interface{}{
+		"message": "Batch membership updated",
+		"batchId": batch.BatchID,
+		"updated": updated,
+		"failed":  failed,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// Assignment APIs
+func HandleAssignmentCreate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req AssignmentRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.BatchID == "" || req.QuizName == "" || req.ClassName == "" || req.SubjectName == "" || req.Topic == "" {
+		return CreateErrorResponse(400, "Missing 'batchId', 'quizName', 'className', 'subjectName' or 'topic' parameter"), nil
+	}
+
+	now := time.Now().UTC()
+	openAt := now
+	if req.OpenAt != "" {
+		var ok bool
+		if openAt, ok = parseSubExpDate(req.OpenAt); !ok {
+			return CreateErrorResponse(400, "Invalid 'openAt' date format"), nil
+		}
+	}
+	dueAt, ok := parseDueDate(req.DueAt)
+	if !ok {
+		return CreateErrorResponse(400, "Missing or invalid 'dueAt' date"), nil
+	}
+	if !dueAt.After(openAt) {
+		return CreateErrorResponse(400, "'dueAt' must be after 'openAt'"), nil
+	}
+
+	batch, errResp, ok := authorizeBatch(request, req.BatchID)
+	if !ok {
+		return errResp, nil
+	}
+	if req.ClassName != batch.ClassName {
+		return CreateErrorResponse(400, "Quiz class does not match batch class"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	quiz, err := GetQuizFromDynamoDB(tenantID, req.QuizName, req.ClassName, req.SubjectName, req.Topic)
+	if err != nil {
+		log.Printf("❌ Error fetching quiz: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if quiz == nil {
+		return CreateErrorResponse(404, "Quiz not found"), nil
+	}
+
+	userUID, _ := GetUserUIDFromContext(request)
+	assignment := AssignmentItem{
+		BatchID:      batch.BatchID,
+		AssignmentID: fmt.Sprintf("asg_%d", now.UnixNano()),
+		QuizName:     quiz.QuizName,
+		ClassName:    quiz.ClassName,
+		Category:     quiz.SubjectName,
+		Topic:        quiz.Topic,
+		OpenAt:       openAt.Format(subExpDateLayout),
+		DueAt:        dueAt.Format(subExpDateLayout),
+		CreatedBy:    userUID,
+		CreatedAt:    now.Format(subExpDateLayout),
+	}
+
+	if err := SaveAssignmentToDynamoDB(tenantID, assignment); err != nil {
+		log.Printf("Failed to save assignment: %v", err)
+		return CreateErrorResponse(500, "Failed to save assignment"), nil
+	}
+
+	response := map[string]interface{}{
+		"message":    "Assignment created successfully",
+		"assignment": assignment,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 201,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+func HandleAssignmentDelete(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	var req AssignmentDeleteRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.BatchID == "" || req.AssignmentID == "" {
+		return CreateErrorResponse(400, "Missing 'batchId' or 'assignmentId' parameter"), nil
+	}
+
+	if _, errResp, ok := authorizeBatch(request, req.BatchID); !ok {
+		return errResp, nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if err := DeleteAssignment(tenantID, req.BatchID, req.AssignmentID); err != nil {
+		log.Printf("Failed to delete assignment: %v", err)
+		return CreateErrorResponse(500, "Failed to delete assignment"), nil
+	}
+
+	return CreateSuccessResponse("Assignment deleted successfully"), nil
+}
+
+// HandleStudentAssignments lists the caller's assignments across their batches.
+// An optional ?status= filters by UPCOMING, PENDING, OVERDUE or COMPLETED.
+func HandleStudentAssignments(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	attempts, err := GetStudentAttempts(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error querying attempts: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	attemptsByQuiz := make(map[string]*AttemptItem)
+	for i := range attempts {
+		attemptsByQuiz[attempts[i].QuizName] = &attempts[i]
+	}
+
+	statusFilter := request.QueryStringParameters["status"]
+	now := time.Now()
+	assignments := []StudentAssignment{}
+	for _, batchID := range student.BatchIDs {
+		batch, err := GetBatch(tenantID, batchID)
+		if err != nil {
+			log.Printf("❌ Error fetching batch %s: %v", batchID, err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		if batch == nil {
+			continue
+		}
+
+		batchAssignments, err := FetchBatchAssignments(tenantID, batchID)
+		if err != nil {
+			log.Printf("❌ Error fetching assignments for %s: %v", batchID, err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+
+		for _, assignment := range batchAssignments {
+			attempt := assignmentAttempt(assignment, attemptsByQuiz[assignment.QuizName])
+			status := AssignmentStatus(assignment, attempt, now)
+			if statusFilter != "" && status != statusFilter {
+				continue
+			}
+
+			item := StudentAssignment{
+				AssignmentID: assignment.AssignmentID,
+				BatchID:      batch.BatchID,
+				BatchName:    batch.Name,
+				QuizName:     assignment.QuizName,
+				ClassName:    assignment.ClassName,
+				SubjectName:  assignment.Category,
+				Topic:        assignment.Topic,
+				OpenAt:       assignment.OpenAt,
+				DueAt:        assignment.DueAt,
+				Status:       status,
+				Late:         isLateSubmission(assignment, attempt),
+			}
+			if attempt != nil {
+				item.Percentage = attemptPercentage(*attempt)
+				item.AttemptedAt = attempt.AttemptedAt
+			}
+			assignments = append(assignments, item)
+		}
+	}
+
+	// Soonest due first
+	sort.Slice(assignments, func(i, j int) bool {
+		return assignments[i].DueAt < assignments[j].DueAt
+	})
+
+	response := map[string]interface{}{
+		"uid":         uid,
+		"assignments": assignments,
+		"count":       len(assignments),
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleAssignmentReport shows per-student completion and scores for an assignment
+func HandleAssignmentReport(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	batchID := request.QueryStringParameters["batchId"]
+	assignmentID := request.QueryStringParameters["assignmentId"]
+	if batchID == "" || assignmentID == "" {
+		return CreateErrorResponse(400, "Missing 'batchId' or 'assignmentId' parameter"), nil
+	}
+
+	batch, errResp, ok := authorizeBatch(request, batchID)
+	if !ok {
+		return errResp, nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	assignment, err := GetAssignment(tenantID, batchID, assignmentID)
+	if err != nil {
+		log.Printf("❌ Error fetching assignment: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if assignment == nil {
+		return CreateErrorResponse(404, "Assignment not found"), nil
+	}
+
+	students, err := FetchBatchStudents(tenantID, batchID)
+	if err != nil {
+		log.Printf("❌ Error fetching batch students: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	now := time.Now()
+	reports := []AssignmentStudentReport{}
+	completed := 0
+	var percentageSum float64
+	for _, student := range students {
+		attempt, err := GetAttempt(tenantID, student.UID, assignment.QuizName)
+		if err != nil {
+			log.Printf("❌ Error fetching attempt for %s: %v", student.UID, err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		attempt = assignmentAttempt(*assignment, attempt)
+
+		report := AssignmentStudentReport{
+			UID:    student.UID,
+			Name:   student.Name,
+			Email:  student.Email,
+			Status: AssignmentStatus(*assignment, attempt, now),
+			Late:   isLateSubmission(*assignment, attempt),
+		}
+		if attempt != nil {
+			report.CorrectCount = attempt.CorrectCount
+			report.TotalCount = attempt.TotalCount
+			report.Percentage = attemptPercentage(*attempt)
+			report.AttemptNumber = attempt.AttemptNumber
+			report.AttemptedAt = attempt.AttemptedAt
+			completed++
+			percentageSum += report.Percentage
+		}
+		reports = append(reports, report)
+	}
+
+	sort.Slice(reports, func(i, j int) bool {
+		return reports[i].Name < reports[j].Name
+	})
+
+	var averagePercentage float64
+	if completed > 0 {
+		averagePercentage = float64(int(percentageSum/float64(completed)*10+0.5)) / 10
+	}
+
+	response := map[string]interface{}{
+		"batchId":           batch.BatchID,
+		"batchName":         batch.Name,
+		"assignment":        assignment,
+		"students":          reports,
+		"totalStudents":     len(reports),
+		"completed":         completed,
+		"averagePercentage": averagePercentage,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// authorizeBatch loads a batch of the caller's tenant and checks that the caller
+// is an admin or one of the batch's teachers
+func authorizeBatch(request events.APIGatewayProxyRequest, batchID string) (*BatchItem, events.APIGatewayProxyResponse, bool) {
+	userRole, err := CheckTeacherRole(request)
+	if err != nil {
+		return nil, CreateErrorResponse(403, err.Error()), false
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return nil, CreateErrorResponse(500, "Internal Server Error"), false
+	}
+	batch, err := GetBatch(tenantID, batchID)
+	if err != nil {
+		log.Printf("❌ Error fetching batch: %v", err)
+		return nil, CreateErrorResponse(500, "Internal Server Error"), false
+	}
+	if batch == nil {
+		return nil, CreateErrorResponse(404, "Batch not found"), false
+	}
+
+	if userRole == "teacher" {
+		userUID, _ := GetUserUIDFromContext(request)
+		if !isBatchTeacher(batch, userUID) {
+			return nil, CreateErrorResponse(403, "Not a teacher of this batch"), false
+		}
+	}
+	return batch, events.APIGatewayProxyResponse{}, true
+}
@@ -2,34 +2,79 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 )
 
 type ClassRequest struct {
 	ClassName string `json:"className"`
+	TaxonomyChangeOptions
 }
 
 type SubjectRequest struct {
 	ClassName   string `json:"className"`
 	SubjectName string `json:"subjectName"`
+	TaxonomyChangeOptions
 }
 
 type TopicRequest struct {
 	ClassName   string `json:"className"`
 	SubjectName string `json:"subjectName"`
 	Topic       string `json:"topic"`
+	TaxonomyChangeOptions
 }
 
+// TaxonomyChangeOptions control deletes and renames of a class, subject or
+// topic that quizzes, attempts or students still refer to
+type TaxonomyChangeOptions struct {
+	// cascade or archive; without it a delete with dependents is refused
+	Mode string `json:"mode"`
+	// Report the dependents without changing anything
+	Preview bool `json:"preview"`
+	// Optional version the change is based on, from the expectedVersion
+	// query parameter; see version.go
+	ExpectedVersion *int `json:"-"`
+}
+
+type TaxonomyRenameRequest struct {
+	ClassName   string `json:"className"`
+	SubjectName string `json:"subjectName"`
+	Topic       string `json:"topic"`
+	NewName     string `json:"newName"`
+	Preview     bool   `json:"preview"`
+	// Continue a rename that left dependents under the old name
+	Resume bool `json:"resume"`
+	// Optional version the rename is based on, from the expectedVersion
+	// query parameter; see version.go
+	ExpectedVersion *int `json:"-"`
+}
+
+// Time a long-running admin request such as a rename spends writing before
+// it answers with what is left, well within API Gateway's 29 second limit
+const requestTimeBudget = 20 * time.Second
+
 // Class APIs
 func HandleClassInsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
 	var req ClassRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return CreateErrorResponse(400, "Invalid request body"), nil
 	}
 
-	if err := InsertClass(req.ClassName); err != nil {
+	if err := InsertClass(tenantID, req.ClassName); err != nil {
 		log.Printf("Failed to insert class: %v", err)
 		return CreateErrorResponse(500, "Failed to insert class"), nil
 	}
@@ -38,12 +83,34 @@ func HandleClassInsert(request events.APIGatewayProxyRequest) (events.APIGateway
 }
 
 func HandleClassDelete(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
 	var req ClassRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return CreateErrorResponse(400, "Invalid request body"), nil
 	}
 
-	if err := DeleteClass(req.ClassName); err != nil {
+	if req.ExpectedVersion, err = parseExpectedVersion(request); err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+	node := TaxonomyNode{ClassName: req.ClassName}
+	if resp, done := prepareTaxonomyDelete(tenantID, node, req.TaxonomyChangeOptions); done {
+		return resp, nil
+	}
+
+	err = DeleteTaxonomyNode(tenantID, node, req.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse("class"), nil
+	}
+	if err != nil {
 		log.Printf("Failed to delete class: %v", err)
 		return CreateErrorResponse(500, "Failed to delete class"), nil
 	}
@@ -52,7 +119,12 @@ func HandleClassDelete(request events.APIGatewayProxyRequest) (events.APIGateway
 }
 
 func HandleClassFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	classes, err := FetchClasses()
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	classes, err := FetchClasses(tenantID)
 	if err != nil {
 		log.Printf("Failed to fetch classes: %v", err)
 		return CreateErrorResponse(500, "Failed to fetch classes"), nil
@@ -68,12 +140,22 @@ func HandleClassFetch(request events.APIGatewayProxyRequest) (events.APIGatewayP
 
 // Subject APIs
 func HandleSubjectInsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
 	var req SubjectRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return CreateErrorResponse(400, "Invalid request body"), nil
 	}
 
-	if err := InsertSubject(req.ClassName, req.SubjectName); err != nil {
+	if err := InsertSubject(tenantID, req.ClassName, req.SubjectName); err != nil {
 		log.Printf("Failed to insert subject: %v", err)
 		return CreateErrorResponse(500, "Failed to insert subject"), nil
 	}
@@ -82,12 +164,34 @@ func HandleSubjectInsert(request events.APIGatewayProxyRequest) (events.APIGatew
 }
 
 func HandleSubjectDelete(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
 	var req SubjectRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return CreateErrorResponse(400, "Invalid request body"), nil
 	}
 
-	if err := DeleteSubject(req.ClassName, req.SubjectName); err != nil {
+	if req.ExpectedVersion, err = parseExpectedVersion(request); err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+	node := TaxonomyNode{ClassName: req.ClassName, SubjectName: req.SubjectName}
+	if resp, done := prepareTaxonomyDelete(tenantID, node, req.TaxonomyChangeOptions); done {
+		return resp, nil
+	}
+
+	err = DeleteTaxonomyNode(tenantID, node, req.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse("subject"), nil
+	}
+	if err != nil {
 		log.Printf("Failed to delete subject: %v", err)
 		return CreateErrorResponse(500, "Failed to delete subject"), nil
 	}
@@ -96,12 +200,17 @@ func HandleSubjectDelete(request events.APIGatewayProxyRequest) (events.APIGatew
 }
 
 func HandleSubjectFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
 	className := request.QueryStringParameters["className"]
 	if className == "" {
 		return CreateErrorResponse(400, "className parameter required"), nil
 	}
 
-	subjects, err := FetchSubjects(className)
+	subjects, err := FetchSubjects(tenantID, className)
 	if err != nil {
 		log.Printf("Failed to fetch subjects: %v", err)
 		return CreateErrorResponse(500, "Failed to fetch subjects"), nil
@@ -117,12 +226,22 @@ func HandleSubjectFetch(request events.APIGatewayProxyRequest) (events.APIGatewa
 
 // Topic APIs
 func HandleTopicInsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
 	var req TopicRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return CreateErrorResponse(400, "Invalid request body"), nil
 	}
 
-	if err := InsertTopic(req.ClassName, req.SubjectName, req.Topic); err != nil {
+	if err := InsertTopic(tenantID, req.ClassName, req.SubjectName, req.Topic); err != nil {
 		log.Printf("Failed to insert topic: %v", err)
 		return CreateErrorResponse(500, "Failed to insert topic"), nil
 	}
@@ -131,12 +250,34 @@ func HandleTopicInsert(request events.APIGatewayProxyRequest) (events.APIGateway
 }
 
 func HandleTopicDelete(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
 	var req TopicRequest
 	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
 		return CreateErrorResponse(400, "Invalid request body"), nil
 	}
 
-	if err := DeleteTopic(req.ClassName, req.SubjectName, req.Topic); err != nil {
+	if req.ExpectedVersion, err = parseExpectedVersion(request); err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+	node := TaxonomyNode{ClassName: req.ClassName, SubjectName: req.SubjectName, Topic: req.Topic}
+	if resp, done := prepareTaxonomyDelete(tenantID, node, req.TaxonomyChangeOptions); done {
+		return resp, nil
+	}
+
+	err = DeleteTaxonomyNode(tenantID, node, req.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse("topic"), nil
+	}
+	if err != nil {
 		log.Printf("Failed to delete topic: %v", err)
 		return CreateErrorResponse(500, "Failed to delete topic"), nil
 	}
@@ -145,6 +286,11 @@ func HandleTopicDelete(request events.APIGatewayProxyRequest) (events.APIGateway
 }
 
 func HandleTopicFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
 	className := request.QueryStringParameters["className"]
 	subjectName := request.QueryStringParameters["subjectName"]
 	
@@ -152,7 +298,7 @@ func HandleTopicFetch(request events.APIGatewayProxyRequest) (events.APIGatewayP
 		return CreateErrorResponse(400, "className and subjectName parameters required"), nil
 	}
 
-	topics, err := FetchTopics(className, subjectName)
+	topics, err := FetchTopics(tenantID, className, subjectName)
 	if err != nil {
 		log.Printf("Failed to fetch topics: %v", err)
 		return CreateErrorResponse(500, "Failed to fetch topics"), nil
@@ -164,4 +310,231 @@ func HandleTopicFetch(request events.APIGatewayProxyRequest) (events.APIGatewayP
 		Headers:    GetCORSHeaders(),
 		Body:       string(response),
 	}, nil
-}
\ No newline at end of file
+}
+// prepareTaxonomyDelete handles the dependents of a class, subject or topic
+// about to be deleted: it reports them for a preview, refuses the delete
+// when there are any and no mode was given, and otherwise cascades or
+// archives them. done is set when resp should be returned instead.
+func prepareTaxonomyDelete(tenantID string, node TaxonomyNode, options TaxonomyChangeOptions) (resp events.APIGatewayProxyResponse, done bool) {
+	if options.Mode != "" && options.Mode != TaxonomyCascade && options.Mode != TaxonomyArchive {
+		return CreateErrorResponse(400, "Invalid 'mode', expected cascade or archive"), true
+	}
+
+	// Refuse an outdated delete before cascading or archiving anything
+	err := CheckTaxonomyVersion(tenantID, node, options.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse(node.level()), true
+	}
+	if err != nil && !errors.Is(err, ErrTaxonomyNodeNotFound) {
+		log.Printf("❌ Error checking %s version: %v", node.level(), err)
+		return CreateErrorResponse(500, "Internal Server Error"), true
+	}
+
+	dependents, err := FindTaxonomyDependents(tenantID, node)
+	if err != nil {
+		log.Printf("❌ Error finding %s dependents: %v", node.level(), err)
+		return CreateErrorResponse(500, "Internal Server Error"), true
+	}
+
+	if options.Preview {
+		return taxonomyDependentsResponse(200, "", dependents), true
+	}
+	if options.Mode == "" && !dependents.empty() {
+		message := fmt.Sprintf("The %s still has quizzes, attempts or students; delete with mode cascade or archive", node.level())
+		return taxonomyDependentsResponse(409, message, dependents), true
+	}
+
+	switch options.Mode {
+	case TaxonomyCascade:
+		err = CascadeDeleteDependents(tenantID, dependents)
+	case TaxonomyArchive:
+		err = ArchiveDependents(tenantID, dependents, time.Now())
+	}
+	if err != nil {
+		log.Printf("❌ Error removing %s dependents: %v", node.level(), err)
+		return CreateErrorResponse(500, "Internal Server Error"), true
+	}
+	return events.APIGatewayProxyResponse{}, false
+}
+
+func taxonomyDependentsResponse(statusCode int, message string, dependents *TaxonomyDependents) events.APIGatewayProxyResponse {
+	response := map[string]interface{}{
+		"dependents": dependents,
+	}
+	if message != "" {
+		response["error"] = message
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}
+}
+
+// Rename APIs
+func HandleClassRename(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handleTaxonomyRename(request, LevelClass)
+}
+
+func HandleSubjectRename(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handleTaxonomyRename(request, LevelSubject)
+}
+
+func HandleTopicRename(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return handleTaxonomyRename(request, LevelTopic)
+}
+
+// handleTaxonomyRename renames a class, subject or topic and rewrites what
+// refers to it, see RenameTaxonomyNode
+func handleTaxonomyRename(request events.APIGatewayProxyRequest, level string) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var req TaxonomyRenameRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.ExpectedVersion, err = parseExpectedVersion(request); err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+
+	node := TaxonomyNode{ClassName: req.ClassName}
+	renamed := TaxonomyNode{ClassName: req.NewName}
+	switch level {
+	case LevelSubject:
+		node.SubjectName = req.SubjectName
+		renamed = TaxonomyNode{ClassName: req.ClassName, SubjectName: req.NewName}
+	case LevelTopic:
+		node.SubjectName, node.Topic = req.SubjectName, req.Topic
+		renamed = TaxonomyNode{ClassName: req.ClassName, SubjectName: req.SubjectName, Topic: req.NewName}
+	}
+	if req.ClassName == "" || node.level() != level || req.NewName == "" {
+		return CreateErrorResponse(400, fmt.Sprintf("Missing %s name or 'newName'", level)), nil
+	}
+	if level == LevelClass && req.NewName == DemoClass {
+		return CreateErrorResponse(400, fmt.Sprintf("'%s' is reserved", DemoClass)), nil
+	}
+
+	if req.Resume {
+		return resumeTaxonomyRename(tenantID, node, renamed, req), nil
+	}
+
+	// Inactive nodes can be renamed and their names are taken
+	if err := validateTaxonomy(tenantID, node.ClassName, node.SubjectName, node.Topic, true); err != nil {
+		return taxonomyErrorResponse(err), nil
+	}
+	var taxonomyErr *TaxonomyError
+	err = validateTaxonomy(tenantID, renamed.ClassName, renamed.SubjectName, renamed.Topic, true)
+	if err == nil {
+		return CreateErrorResponse(409, fmt.Sprintf("The %s '%s' already exists", level, req.NewName)), nil
+	}
+	if !errors.As(err, &taxonomyErr) {
+		log.Printf("❌ Error validating taxonomy: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	err = CheckTaxonomyVersion(tenantID, node, req.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse(level), nil
+	}
+	if err != nil {
+		log.Printf("❌ Error checking %s version: %v", level, err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	dependents, err := findRenameDependents(tenantID, node)
+	if err != nil {
+		log.Printf("❌ Error finding %s dependents: %v", level, err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if req.Preview {
+		return taxonomyDependentsResponse(200, "", dependents), nil
+	}
+
+	remaining, err := RenameTaxonomyNode(tenantID, node, req.NewName, dependents, req.ExpectedVersion, time.Now().Add(requestTimeBudget))
+	switch {
+	case errors.Is(err, ErrVersionConflict):
+		return versionConflictResponse(level), nil
+	case errors.Is(err, errTaxonomyConflict):
+		return CreateErrorResponse(409, "The taxonomy changed during the rename; nothing was renamed, please retry"), nil
+	case err != nil:
+		log.Printf("❌ Error renaming %s: %v", level, err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if remaining > 0 {
+		return renameIncompleteResponse(level, req.NewName, remaining), nil
+	}
+
+	return CreateSuccessResponse(fmt.Sprintf("Renamed %s to %s", level, req.NewName)), nil
+}
+
+// resumeTaxonomyRename continues a rename whose node already has its new
+// name while some dependents still carry the old one
+func resumeTaxonomyRename(tenantID string, node, renamed TaxonomyNode, req TaxonomyRenameRequest) events.APIGatewayProxyResponse {
+	level := node.level()
+	var taxonomyErr *TaxonomyError
+	err := validateTaxonomy(tenantID, node.ClassName, node.SubjectName, node.Topic, true)
+	if err == nil {
+		return CreateErrorResponse(409, fmt.Sprintf("The %s has not been renamed yet; rename it without 'resume'", level))
+	}
+	if !errors.As(err, &taxonomyErr) {
+		log.Printf("❌ Error validating taxonomy: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error")
+	}
+	if err := validateTaxonomy(tenantID, renamed.ClassName, renamed.SubjectName, renamed.Topic, true); err != nil {
+		return taxonomyErrorResponse(err)
+	}
+
+	dependents, err := findRenameDependents(tenantID, node)
+	if err != nil {
+		log.Printf("❌ Error finding %s dependents: %v", level, err)
+		return CreateErrorResponse(500, "Internal Server Error")
+	}
+	if req.Preview {
+		return taxonomyDependentsResponse(200, "", dependents)
+	}
+
+	remaining, err := ResumeTaxonomyRename(tenantID, node, req.NewName, dependents, time.Now().Add(requestTimeBudget))
+	if err != nil {
+		log.Printf("❌ Error resuming %s rename: %v", level, err)
+		return CreateErrorResponse(500, "Internal Server Error")
+	}
+	if remaining > 0 {
+		return renameIncompleteResponse(level, req.NewName, remaining)
+	}
+	return CreateSuccessResponse(fmt.Sprintf("Renamed %s to %s", level, req.NewName))
+}
+
+func findRenameDependents(tenantID string, node TaxonomyNode) (*TaxonomyDependents, error) {
+	dependents, err := FindTaxonomyDependents(tenantID, node)
+	if err != nil {
+		return nil, err
+	}
+	if err := FindTaxonomyReferences(tenantID, node, dependents); err != nil {
+		return nil, err
+	}
+	return dependents, nil
+}
+
+// renameIncompleteResponse tells the caller to repeat the rename with resume
+// set until no dependents are left
+func renameIncompleteResponse(level, newName string, remaining int) events.APIGatewayProxyResponse {
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"message":   fmt.Sprintf("Renamed %s to %s; repeat the request with 'resume' set to update the remaining dependents", level, newName),
+		"remaining": remaining,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 202,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}
+}
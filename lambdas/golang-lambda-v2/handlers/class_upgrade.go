@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Upgrade paths of classes that have none configured
+var defaultUpgradeGraph = map[string][]string{
+	"CLS6":       {"CLS7"},
+	"CLS7":       {"CLS8"},
+	"CLS8":       {"CLS9"},
+	"CLS9":       {"CLS10"},
+	"CLS10":      {"CLS11-MPC", "CLS11-BIPC"},
+	"CLS11-MPC":  {"CLS12-MPC"},
+	"CLS11-BIPC": {"CLS12-BIPC"},
+}
+
+// Most attempts archived per transaction; each takes a put and a delete, and
+// one more item counts them on the upgrade event
+const archiveBatchSize = (maxTransactItems - 1) / 2
+
+var (
+	ErrInvalidUpgrade  = errors.New("invalid class upgrade path")
+	ErrUpgradeConflict = errors.New("student's class changed by another upgrade")
+)
+
+// Class upgrade event, keyed by student and time
+type ClassUpgradeItem struct {
+	UID              string `json:"uid" dynamodbav:"uid"`
+	UpgradedAt       string `json:"upgraded_at" dynamodbav:"upgraded_at"`
+	OldClass         string `json:"old_class" dynamodbav:"old_class"`
+	NewClass         string `json:"new_class" dynamodbav:"new_class"`
+	AttemptsArchived int    `json:"attempts_archived" dynamodbav:"attempts_archived"`
+	// UID of the admin for bulk promotions, empty when the student upgraded
+	InitiatedBy string `json:"initiated_by,omitempty" dynamodbav:"initiated_by,omitempty"`
+	// Set until the attempts of the old class are all archived
+	Pending  bool   `json:"pending,omitempty" dynamodbav:"pending,omitempty"`
+	TenantID string `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+// Attempt of a previous class, moved out of student_quiz_attempts_v2 on
+// upgrade. archive_key is "<upgraded_at>#<quiz_name>".
+type ArchivedAttemptItem struct {
+	AttemptItem
+	ArchiveKey string `json:"archive_key" dynamodbav:"archive_key"`
+	UpgradedAt string `json:"upgraded_at" dynamodbav:"upgraded_at"`
+}
+
+// upgradeGraph returns the tenant's upgrade paths by class name. Paths are
+// stored on class nodes by node ID, so they survive renames; a class with
+// none stored keeps its path from defaultUpgradeGraph.
+func upgradeGraph(t *taxonomy) map[string][]string {
+	configured := make(map[string][]string)
+	for _, node := range t.children("") {
+		configured[node.NodeID] = node.UpgradeTo
+	}
+	return mergeUpgradeGraph(t, configured)
+}
+
+// mergeUpgradeGraph lays paths by node ID over the default graph. A nil
+// entry keeps the default; an empty one means the class has no upgrades.
+func mergeUpgradeGraph(t *taxonomy, configured map[string][]string) map[string][]string {
+	graph := make(map[string][]string)
+	for name, next := range defaultUpgradeGraph {
+		graph[name] = next
+	}
+
+	names := make(map[string]string)
+	for _, node := range t.children("") {
+		names[node.NodeID] = node.Name
+	}
+	for _, node := range t.children("") {
+		ids := configured[node.NodeID]
+		if ids == nil {
+			continue
+		}
+		next := []string{}
+		for _, id := range ids {
+			// Paths to deleted classes are ignored
+			if name, ok := names[id]; ok {
+				next = append(next, name)
+			}
+		}
+		graph[node.Name] = next
+	}
+	return graph
+}
+
+// UpgradableClasses returns the classes a student of className may upgrade to
+func UpgradableClasses(tenantID, className string) ([]string, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	if next := upgradeGraph(t)[className]; next != nil {
+		return next, nil
+	}
+	return []string{}, nil
+}
+
+// getUpgradableClasses is UpgradableClasses for student views, which show no
+// upgrades rather than fail
+func getUpgradableClasses(tenantID, currentClass string) []string {
+	classes, err := UpgradableClasses(tenantID, currentClass)
+	if err != nil {
+		log.Printf("⚠️ Error fetching upgrade paths of %s: %v", currentClass, err)
+		return []string{}
+	}
+	return classes
+}
+
+// FetchUpgradeGraph returns every configured upgrade path of the tenant
+func FetchUpgradeGraph(tenantID string) (map[string][]string, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return upgradeGraph(t), nil
+}
+
+// SetClassUpgrades replaces the classes a class upgrades to. An empty list
+// leaves the class without upgrades, while nil restores its default path.
+func SetClassUpgrades(tenantID, className string, upgradeTo []string, expectedVersion *int) error {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return err
+	}
+	class := t.resolve(TaxonomyNode{ClassName: className})
+	if class == nil {
+		return &TaxonomyError{Field: "className", Value: className, Options: t.childNames("")}
+	}
+	if err := checkVersion(class.Version, expectedVersion); err != nil {
+		return err
+	}
+
+	var ids []string
+	if upgradeTo != nil {
+		ids = []string{}
+	}
+	for _, name := range upgradeTo {
+		target := t.resolve(TaxonomyNode{ClassName: name})
+		if target == nil {
+			return &TaxonomyError{Field: "upgradeTo", Value: name, Options: t.childNames("")}
+		}
+		if target.NodeID == class.NodeID {
+			return fmt.Errorf("%w: %s cannot upgrade to itself", ErrInvalidUpgrade, className)
+		}
+		if !containsString(ids, target.NodeID) {
+			ids = append(ids, target.NodeID)
+		}
+	}
+
+	// Reject paths leading back to the class, which would promote students
+	// round in circles
+	proposed := make(map[string][]string)
+	for _, node := range t.children("") {
+		proposed[node.NodeID] = node.UpgradeTo
+	}
+	proposed[class.NodeID] = ids
+	if upgradeCycle(mergeUpgradeGraph(t, proposed), class.Name) {
+		return fmt.Errorf("%w: upgrades of %s lead back to it", ErrInvalidUpgrade, className)
+	}
+
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	update := "REMOVE upgrade_to"
+	if ids != nil {
+		update = "SET upgrade_to = :upgradeTo"
+		values[":upgradeTo"] = stringListAttribute(ids)
+	}
+	update += " " + versionIncrement(names, values)
+	condition := versionCondition(class.Version, names, values)
+
+	_, err = dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String("taxonomy_nodes"),
+		Key:                       taxonomyNodeKey(tenantID, class.NodeID),
+		UpdateExpression:          aws.String(update),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+	})
+	if isConditionFailure(err) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// upgradeCycle reports whether following upgrades from start leads back to it
+func upgradeCycle(graph map[string][]string, start string) bool {
+	visited := make(map[string]bool)
+	queue := append([]string{}, graph[start]...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == start {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		queue = append(queue, graph[id]...)
+	}
+	return false
+}
+
+// UpgradeStudentClass moves a student to newClass along an upgrade path. The
+// upgrade event and the new class are written in one transaction, guarded by
+// the old class so that concurrent upgrades cannot both apply. The attempts of
+// the old class are then archived as history rather than deleted; until that
+// finishes the student carries the event's time in upgrade_pending, and the
+// next upgrade of the student, or a retry of this one, resumes it first.
+func UpgradeStudentClass(tenantID string, student *StudentInfoItem, newClass, initiatedBy string, now time.Time) (*ClassUpgradeItem, error) {
+	if student.UpgradePending != "" {
+		event, err := resumeClassUpgrade(tenantID, student)
+		if err != nil {
+			return nil, err
+		}
+		// A retry of an upgrade that got as far as changing the class
+		if event.NewClass == newClass && student.StudentClass == newClass {
+			return event, nil
+		}
+	}
+
+	allowed, err := UpgradableClasses(tenantID, student.StudentClass)
+	if err != nil {
+		return nil, err
+	}
+	if !containsString(allowed, newClass) {
+		return nil, fmt.Errorf("%w: %s to %s", ErrInvalidUpgrade, student.StudentClass, newClass)
+	}
+
+	event := ClassUpgradeItem{
+		UID:         student.UID,
+		UpgradedAt:  now.UTC().Format(subExpDateLayout),
+		OldClass:    student.StudentClass,
+		NewClass:    newClass,
+		InitiatedBy: initiatedBy,
+		Pending:     true,
+		TenantID:    normalizeTenantID(tenantID),
+	}
+	av, err := dynamodbattribute.MarshalMap(event)
+	if err != nil {
+		return nil, err
+	}
+
+	values := map[string]*dynamodb.AttributeValue{
+		":oldClass":   {S: aws.String(event.OldClass)},
+		":newClass":   {S: aws.String(newClass)},
+		":upgradedAt": {S: aws.String(event.UpgradedAt)},
+	}
+	condition := "student_class = :oldClass AND " + tenantCondition(tenantID, values)
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String("class_upgrades"),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(upgraded_at)"),
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("students_info"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"uid": {S: aws.String(student.UID)},
+					},
+					UpdateExpression:          aws.String("SET student_class = :newClass, upgrade_pending = :upgradedAt"),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeValues: values,
+				},
+			},
+		},
+	})
+	if isTransactionConditionFailure(err, 1) {
+		return nil, ErrUpgradeConflict
+	}
+	if err != nil {
+		return nil, err
+	}
+	student.StudentClass = newClass
+	student.UpgradePending = event.UpgradedAt
+
+	if err := finishClassUpgrade(tenantID, student, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// resumeClassUpgrade finishes the student's pending upgrade
+func resumeClassUpgrade(tenantID string, student *StudentInfoItem) (*ClassUpgradeItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("class_upgrades"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid":         {S: aws.String(student.UID)},
+			"upgraded_at": {S: aws.String(student.UpgradePending)},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if result.Item == nil {
+		return nil, fmt.Errorf("pending upgrade %s of %s not found", student.UpgradePending, student.UID)
+	}
+
+	var event ClassUpgradeItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &event); err != nil {
+		return nil, err
+	}
+	log.Printf("📌 Resuming class upgrade of %s from %s", student.UID, event.UpgradedAt)
+	if err := finishClassUpgrade(tenantID, student, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// finishClassUpgrade archives the attempts made before the upgrade and then
+// clears the pending markers. Attempts already made in the new class stay.
+func finishClassUpgrade(tenantID string, student *StudentInfoItem, event *ClassUpgradeItem) error {
+	attempts, err := GetStudentAttempts(tenantID, student.UID)
+	if err != nil {
+		return err
+	}
+	var previous []AttemptItem
+	for _, attempt := range attempts {
+		if attempt.AttemptedAt < event.UpgradedAt {
+			previous = append(previous, attempt)
+		}
+	}
+	if err := archiveAttempts(previous, event); err != nil {
+		return err
+	}
+	event.AttemptsArchived += len(previous)
+
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Update: &dynamodb.Update{
+					TableName:        aws.String("class_upgrades"),
+					Key:              upgradeEventKey(event),
+					UpdateExpression: aws.String("REMOVE pending"),
+				},
+			},
+			{
+				Update: &dynamodb.Update{
+					TableName: aws.String("students_info"),
+					Key: map[string]*dynamodb.AttributeValue{
+						"uid": {S: aws.String(student.UID)},
+					},
+					UpdateExpression:    aws.String("REMOVE upgrade_pending"),
+					ConditionExpression: aws.String("upgrade_pending = :upgradedAt"),
+					ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+						":upgradedAt": {S: aws.String(event.UpgradedAt)},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	event.Pending = false
+	student.UpgradePending = ""
+	return nil
+}
+
+func upgradeEventKey(event *ClassUpgradeItem) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"uid":         {S: aws.String(event.UID)},
+		"upgraded_at": {S: aws.String(event.UpgradedAt)},
+	}
+}
+
+// archiveAttempts moves attempts to attempt_history, each move a put and a
+// delete in one transaction so that no attempt is lost or kept twice, and
+// counts them on the upgrade event in the same transaction
+func archiveAttempts(attempts []AttemptItem, event *ClassUpgradeItem) error {
+	for start := 0; start < len(attempts); start += archiveBatchSize {
+		batch := attempts[start:min(start+archiveBatchSize, len(attempts))]
+		var items []*dynamodb.TransactWriteItem
+		for _, attempt := range batch {
+			archived := ArchivedAttemptItem{
+				AttemptItem: attempt,
+				ArchiveKey:  event.UpgradedAt + "#" + attempt.QuizName,
+				UpgradedAt:  event.UpgradedAt,
+			}
+			av, err := dynamodbattribute.MarshalMap(archived)
+			if err != nil {
+				return err
+			}
+			items = append(items,
+				&dynamodb.TransactWriteItem{
+					Put: &dynamodb.Put{
+						TableName:           aws.String("attempt_history"),
+						Item:                av,
+						ConditionExpression: aws.String("attribute_not_exists(archive_key)"),
+					},
+				},
+				&dynamodb.TransactWriteItem{
+					Delete: &dynamodb.Delete{
+						TableName: aws.String("student_quiz_attempts_v2"),
+						Key: map[string]*dynamodb.AttributeValue{
+							"uid":       {S: aws.String(attempt.UID)},
+							"quiz_name": {S: aws.String(attempt.QuizName)},
+						},
+					},
+				},
+			)
+		}
+		items = append(items, &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName:        aws.String("class_upgrades"),
+				Key:              upgradeEventKey(event),
+				UpdateExpression: aws.String("ADD attempts_archived :count"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":count": {N: aws.String(strconv.Itoa(len(batch)))},
+				},
+			},
+		})
+		_, err := dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetClassUpgrades returns a student's upgrade events, oldest first
+func GetClassUpgrades(tenantID, uid string) ([]ClassUpgradeItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":uid": {S: aws.String(uid)},
+	}
+	upgrades := []ClassUpgradeItem{}
+	var unmarshalErr error
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String("class_upgrades"),
+		KeyConditionExpression:    aws.String("uid = :uid"),
+		FilterExpression:          aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageUpgrades []ClassUpgradeItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageUpgrades); unmarshalErr != nil {
+			return false
+		}
+		upgrades = append(upgrades, pageUpgrades...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return upgrades, unmarshalErr
+}
+
+// GetArchivedAttempts returns a student's archived attempts, all of them or
+// those archived by the upgrade at upgradedAt
+func GetArchivedAttempts(tenantID, uid, upgradedAt string) ([]ArchivedAttemptItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":uid": {S: aws.String(uid)},
+	}
+	keyCondition := "uid = :uid"
+	if upgradedAt != "" {
+		keyCondition += " AND begins_with(archive_key, :upgradedAt)"
+		values[":upgradedAt"] = &dynamodb.AttributeValue{S: aws.String(upgradedAt + "#")}
+	}
+
+	attempts := []ArchivedAttemptItem{}
+	var unmarshalErr error
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String("attempt_history"),
+		KeyConditionExpression:    aws.String(keyCondition),
+		FilterExpression:          aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageAttempts []ArchivedAttemptItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageAttempts); unmarshalErr != nil {
+			return false
+		}
+		attempts = append(attempts, pageAttempts...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return attempts, unmarshalErr
+}
+
+// PromotionResult reports a bulk promotion of a class
+type PromotionResult struct {
+	Promoted []string          `json:"promoted"`
+	Failed   map[string]string `json:"failed"`
+	// Students not tried before the deadline
+	Remaining int `json:"remaining"`
+}
+
+// FetchClassStudents returns the tenant's students in a class
+func FetchClassStudents(tenantID, className string) ([]StudentInfoItem, error) {
+	return scanClassStudents(tenantID, className, "")
+}
+
+// FetchPendingUpgradeStudents returns the tenant's students upgraded to a class
+// whose old attempts are not yet all archived
+func FetchPendingUpgradeStudents(tenantID, className string) ([]StudentInfoItem, error) {
+	return scanClassStudents(tenantID, className, "attribute_exists(upgrade_pending) AND ")
+}
+
+func scanClassStudents(tenantID, className, filter string) ([]StudentInfoItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":className": {S: aws.String(className)},
+	}
+	students := []StudentInfoItem{}
+	var unmarshalErr error
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("students_info"),
+		FilterExpression:          aws.String(filter + "student_class = :className AND " + tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageStudents []StudentInfoItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageStudents); unmarshalErr != nil {
+			return false
+		}
+		students = append(students, pageStudents...)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(students, func(i, j int) bool {
+		return strings.ToLower(students[i].Email) < strings.ToLower(students[j].Email)
+	})
+	return students, unmarshalErr
+}
+
+// PromoteClass upgrades every student of a class to newClass, as at year
+// end. A failed student does not stop the others, and students not reached
+// by the deadline are counted as remaining; running it again picks up the
+// failed and remaining students, who are still in the class, along with any
+// already moved to newClass whose upgrade is pending.
+func PromoteClass(tenantID string, students []StudentInfoItem, newClass, initiatedBy string, now, deadline time.Time) PromotionResult {
+	result := PromotionResult{Promoted: []string{}, Failed: map[string]string{}}
+	for i := range students {
+		if time.Now().After(deadline) {
+			result.Remaining = len(students) - i
+			break
+		}
+		if _, err := UpgradeStudentClass(tenantID, &students[i], newClass, initiatedBy, now); err != nil {
+			log.Printf("⚠️ Error promoting student %s: %v", students[i].UID, err)
+			result.Failed[students[i].UID] = err.Error()
+			continue
+		}
+		result.Promoted = append(result.Promoted, students[i].UID)
+	}
+	return result
+}
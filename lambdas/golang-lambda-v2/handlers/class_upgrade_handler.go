@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type UpgradeGraphRequest struct {
+	ClassName string `json:"className"`
+	// An empty list removes the class's upgrades; leaving it out restores
+	// the default path
+	UpgradeTo []string `json:"upgradeTo"`
+	// Optional version of the class the change is based on, from the
+	// expectedVersion query parameter; see version.go
+	ExpectedVersion *int `json:"-"`
+}
+
+type ClassPromoteRequest struct {
+	ClassName string `json:"className"`
+	NewClass  string `json:"newClass"`
+	// List the students that would be promoted without changing anything
+	Preview bool `json:"preview"`
+}
+
+// HandleUpgradeGraphFetch returns the tenant's class upgrade paths
+func HandleUpgradeGraphFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	graph, err := FetchUpgradeGraph(tenantID)
+	if err != nil {
+		log.Printf("❌ Error fetching upgrade graph: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"upgrades": graph,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleUpgradeGraphUpdate replaces the classes one class upgrades to
+func HandleUpgradeGraphUpdate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var req UpgradeGraphRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.ExpectedVersion, err = parseExpectedVersion(request); err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+	if req.ClassName == "" {
+		return CreateErrorResponse(400, "Missing 'className'"), nil
+	}
+
+	err = SetClassUpgrades(tenantID, req.ClassName, req.UpgradeTo, req.ExpectedVersion)
+	var taxonomyErr *TaxonomyError
+	switch {
+	case errors.As(err, &taxonomyErr):
+		return taxonomyErrorResponse(err), nil
+	case errors.Is(err, ErrInvalidUpgrade):
+		return CreateErrorResponse(400, err.Error()), nil
+	case errors.Is(err, ErrVersionConflict):
+		return versionConflictResponse("class"), nil
+	case err != nil:
+		log.Printf("❌ Error updating upgrade paths: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	return CreateSuccessResponse(fmt.Sprintf("Upgrade paths of %s updated successfully", req.ClassName)), nil
+}
+
+// HandleClassPromote promotes every student of a class along an upgrade path,
+// archiving their attempts like a self-service upgrade. A class too large for
+// one request is answered with 202 and the number of students remaining;
+// repeating the request promotes them.
+func HandleClassPromote(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	adminUID, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var req ClassPromoteRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.ClassName == "" || req.NewClass == "" {
+		return CreateErrorResponse(400, "Missing 'className' or 'newClass'"), nil
+	}
+
+	allowed, err := UpgradableClasses(tenantID, req.ClassName)
+	if err != nil {
+		log.Printf("❌ Error fetching upgrade paths: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if !containsString(allowed, req.NewClass) {
+		return CreateErrorResponse(400, "Invalid class upgrade path"), nil
+	}
+
+	students, err := FetchClassStudents(tenantID, req.ClassName)
+	if err != nil {
+		log.Printf("❌ Error fetching students of %s: %v", req.ClassName, err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	// Students of an earlier run whose upgrade did not finish
+	pending, err := FetchPendingUpgradeStudents(tenantID, req.NewClass)
+	if err != nil {
+		log.Printf("❌ Error fetching pending upgrades to %s: %v", req.NewClass, err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	students = append(students, pending...)
+
+	statusCode := 200
+	var response map[string]interface{}
+	if req.Preview {
+		uids := []string{}
+		for _, student := range students {
+			uids = append(uids, student.UID)
+		}
+		response = map[string]interface{}{
+			"className": req.ClassName,
+			"newClass":  req.NewClass,
+			"students":  uids,
+		}
+	} else {
+		log.Printf("📌 Promoting %d students from %s to %s", len(students), req.ClassName, req.NewClass)
+		now := time.Now()
+		result := PromoteClass(tenantID, students, req.NewClass, adminUID, now, now.Add(requestTimeBudget))
+		message := "Class promoted"
+		if result.Remaining > 0 {
+			statusCode = 202
+			message = "Class partly promoted; repeat the request to promote the remaining students"
+		}
+		response = map[string]interface{}{
+			"message":   message,
+			"className": req.ClassName,
+			"newClass":  req.NewClass,
+			"promoted":  result.Promoted,
+			"failed":    result.Failed,
+			"remaining": result.Remaining,
+		}
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleStudentHistory returns the caller's class upgrades and the attempts
+// archived by them, optionally those of one upgrade (upgradedAt). Admins may
+// pass uid to see another student's history.
+func HandleStudentHistory(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+	if other := request.QueryStringParameters["uid"]; other != "" && other != uid {
+		if _, err := CheckAdminRole(request); err != nil {
+			return CreateErrorResponse(403, err.Error()), nil
+		}
+		uid = other
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	upgrades, err := GetClassUpgrades(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching class upgrades: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	attempts, err := GetArchivedAttempts(tenantID, uid, request.QueryStringParameters["upgradedAt"])
+	if err != nil {
+		log.Printf("❌ Error fetching archived attempts: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"uid":      uid,
+		"upgrades": upgrades,
+		"attempts": attempts,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
@@ -28,6 +29,10 @@ type QuizData struct {
 	SubjectName string      `json:"subjectName"`
 	Topic       string      `json:"topic"`
 	Questions   []Question  `json:"questions"`
+	// Bank IDs parallel to Questions, set on upload (DynamoDB only)
+	QuestionIDs    []string `json:"questionIds,omitempty"`
+	AvailableUntil string   `json:"availableUntil,omitempty"`
+	HideAnswers    bool     `json:"hideAnswers,omitempty"`
 }
 
 type Question struct {
@@ -48,11 +53,16 @@ type StudentUpdateRequest struct {
 	SubExpDate   string  `json:"subExpDate,omitempty"`
 	PaymentTime  string  `json:"paymentTime,omitempty"`
 	Role         string  `json:"role,omitempty"`
+	PlanID       string  `json:"planId,omitempty"`
+	CouponCode   string  `json:"couponCode,omitempty"`
 }
 
 type Answer struct {
 	Qno     int      `json:"qno"`
 	Options []string `json:"options"`
+	// Optional time on the question and number of times the answer changed
+	TimeSpentSec  *int `json:"timeSpentSec,omitempty"`
+	AnswerChanges int  `json:"answerChanges,omitempty"`
 }
 
 type SubmitRequest struct {
@@ -66,6 +76,14 @@ type QuestionResult struct {
 	StudentAnswer []string `json:"studentAnswer"`
 	CorrectAnswer []string `json:"correctAnswer"`
 	Explanation   string   `json:"explanation"`
+	// Option letters as submitted, kept for item analysis
+	SelectedOptions []string `json:"selectedOptions,omitempty"`
+	TimeSpentSec    *int     `json:"timeSpentSec,omitempty"`
+	AnswerChanges   int      `json:"answerChanges,omitempty"`
+	// Filled in by the result view only, never stored
+	ClassMedianTimeSec  *float64    `json:"classMedianTimeSec,omitempty" dynamodbav:"-"`
+	ClassCorrectPercent *float64    `json:"classCorrectPercent,omitempty" dynamodbav:"-"`
+	MostChosenWrong     *OptionStat `json:"mostChosenWrong,omitempty" dynamodbav:"-"`
 }
 
 type StudentRegisterRequest struct {
@@ -74,6 +92,8 @@ type StudentRegisterRequest struct {
 	Name         string `json:"name"`
 	PhoneNumber  string `json:"phoneNumber"`
 	StudentClass string `json:"studentClass"`
+	TenantID     string `json:"tenantId,omitempty"`
+	JoinCode     string `json:"joinCode,omitempty"`
 }
 
 var VALID_CATEGORIES = []string{
@@ -93,6 +113,16 @@ var VALID_CATEGORIES = []string{
 	"CLS12-BIPC-EAPCET", "CLS12-BIPC-NEET",
 }
 
+// SplitCategory splits a v1 category such as CLS11-MPC-PHYSICS into its class
+// (CLS11-MPC) and subject (PHYSICS) at the last '-'
+func SplitCategory(category string) (string, string, bool) {
+	i := strings.LastIndex(category, "-")
+	if i <= 0 || i == len(category)-1 {
+		return "", "", false
+	}
+	return category[:i], category[i+1:], true
+}
+
 func GetUserFromContext(request events.APIGatewayProxyRequest) (string, error) {
 	if request.RequestContext.Authorizer == nil {
 		return "", fmt.Errorf("no authorizer context")
@@ -118,21 +148,14 @@ func GetUserUIDFromContext(request events.APIGatewayProxyRequest) (string, error
 	return "", fmt.Errorf("missing user UID from authorizer")
 }
 
-// CheckAdminRole verifies if user has admin or super role
+// CheckAdminRole verifies if user has admin or super role. Roles are read from
+// the caller's record in their own tenant, so admins are tenant-scoped.
 func CheckAdminRole(request events.APIGatewayProxyRequest) (string, error) {
-	userUID, err := GetUserUIDFromContext(request)
+	userRole, err := getCallerRole(request)
 	if err != nil {
 		return "", err
 	}
 
-	userStudent, _ := GetStudentInfoByUID(userUID)
-	userRole := "student"
-	if userStudent != nil && userStudent.Role != nil {
-		if roleStr, ok := userStudent.Role.(string); ok {
-			userRole = roleStr
-		}
-	}
-
 	if userRole != "admin" && userRole != "super" {
 		return "", fmt.Errorf("only 'admin' or 'super' role allowed")
 	}
@@ -140,6 +163,37 @@ func CheckAdminRole(request events.APIGatewayProxyRequest) (string, error) {
 	return userRole, nil
 }
 
+// CheckTeacherRole allows teachers as well as admins
+func CheckTeacherRole(request events.APIGatewayProxyRequest) (string, error) {
+	userRole, err := getCallerRole(request)
+	if err != nil {
+		return "", err
+	}
+
+	if userRole != "teacher" && userRole != "admin" && userRole != "super" {
+		return "", fmt.Errorf("only 'teacher', 'admin' or 'super' role allowed")
+	}
+
+	return userRole, nil
+}
+
+// getCallerRole returns the caller's role within their tenant, see roles.go
+func getCallerRole(request events.APIGatewayProxyRequest) (string, error) {
+	userUID, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return "", err
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		return "", err
+	}
+	if role, ok := roleFromClaim(request, tenantID); ok {
+		return role, nil
+	}
+	return storedRole(tenantID, userUID)
+}
+
 func getDBConfig() (*DBConfig, error) {
 	log.Printf("🔐 Getting DB config from environment variables...")
 
@@ -204,6 +258,19 @@ func GetCORSHeaders() map[string]string {
 	}
 }
 
+// GetHeader looks up a request header case-insensitively
+func GetHeader(request events.APIGatewayProxyRequest, name string) string {
+	if value, ok := request.Headers[name]; ok {
+		return value
+	}
+	for key, value := range request.Headers {
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
+}
+
 func CreateSuccessResponse(message string) events.APIGatewayProxyResponse {
 	return events.APIGatewayProxyResponse{
 		StatusCode: 200,
@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+var (
+	ErrCouponNotFound        = errors.New("coupon not found")
+	ErrCouponNotActive       = errors.New("coupon is not active")
+	ErrCouponNotApplicable   = errors.New("coupon does not apply to this plan or class")
+	ErrCouponExhausted       = errors.New("coupon redemption limit reached")
+	ErrCouponAlreadyRedeemed = errors.New("coupon already redeemed by this student")
+)
+
+// Coupon item structure
+type CouponItem struct {
+	Code            string   `json:"code" dynamodbav:"code"`
+	DiscountType    string   `json:"discount_type" dynamodbav:"discount_type"` // "percent" or "fixed"
+	DiscountValue   float64  `json:"discount_value" dynamodbav:"discount_value"`
+	ValidFrom       string   `json:"valid_from,omitempty" dynamodbav:"valid_from,omitempty"`
+	ValidUntil      string   `json:"valid_until,omitempty" dynamodbav:"valid_until,omitempty"`
+	MaxRedemptions  int      `json:"max_redemptions" dynamodbav:"max_redemptions"` // 0 means unlimited
+	RedemptionCount int      `json:"redemption_count" dynamodbav:"redemption_count"`
+	Plans           []string `json:"plans" dynamodbav:"plans"`
+	Classes         []string `json:"classes" dynamodbav:"classes"`
+	Active          bool     `json:"active" dynamodbav:"active"`
+}
+
+// Coupon redemption item structure, one per coupon and student
+type CouponRedemptionItem struct {
+	Code           string  `json:"code" dynamodbav:"code"`
+	UID            string  `json:"uid" dynamodbav:"uid"`
+	Reference      string  `json:"reference" dynamodbav:"reference"`
+	DiscountAmount float64 `json:"discount_amount" dynamodbav:"discount_amount"`
+	RedeemedAt     string  `json:"redeemed_at" dynamodbav:"redeemed_at"`
+}
+
+// Price breakdown for a plan with a coupon applied
+type CouponQuote struct {
+	Code          string  `json:"code"`
+	PlanID        string  `json:"planId"`
+	OriginalPrice float64 `json:"originalPrice"`
+	Discount      float64 `json:"discount"`
+	FinalPrice    float64 `json:"finalPrice"`
+}
+
+func normalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Save coupon to DynamoDB, keeping the existing redemption count
+func SaveCouponToDynamoDB(coupon CouponItem) error {
+	coupon.Code = normalizeCouponCode(coupon.Code)
+
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("coupons"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"code": {S: aws.String(coupon.Code)},
+		},
+		UpdateExpression: aws.String("SET discount_type = :type, discount_value = :value, valid_from = :from, valid_until = :until, " +
+			"max_redemptions = :max, plans = :plans, classes = :classes, active = :active, " +
+			"redemption_count = if_not_exists(redemption_count, :zero)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":type":    {S: aws.String(coupon.DiscountType)},
+			":value":   {N: aws.String(formatNumber(coupon.DiscountValue))},
+			":from":    {S: aws.String(coupon.ValidFrom)},
+			":until":   {S: aws.String(coupon.ValidUntil)},
+			":max":     {N: aws.String(formatNumber(float64(coupon.MaxRedemptions)))},
+			":plans":   stringListAttribute(coupon.Plans),
+			":classes": stringListAttribute(coupon.Classes),
+			":active":  {BOOL: aws.Bool(coupon.Active)},
+			":zero":    {N: aws.String("0")},
+		},
+	})
+	return err
+}
+
+// Get coupon by code
+func GetCoupon(code string) (*CouponItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("coupons"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"code": {S: aws.String(normalizeCouponCode(code))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var coupon CouponItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &coupon)
+	return &coupon, err
+}
+
+// Fetch all coupons
+func FetchCoupons() ([]CouponItem, error) {
+	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
+		TableName: aws.String("coupons"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	coupons := []CouponItem{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &coupons)
+	return coupons, err
+}
+
+// QuoteCoupon checks the coupon against the plan and the student's class and
+// returns the discounted price. It has no side effects.
+func QuoteCoupon(code string, plan *SubscriptionPlanItem, studentClass string, now time.Time) (*CouponQuote, error) {
+	coupon, err := GetCoupon(code)
+	if err != nil {
+		return nil, err
+	}
+	if coupon == nil {
+		return nil, ErrCouponNotFound
+	}
+
+	if !coupon.Active {
+		return nil, ErrCouponNotActive
+	}
+	if from, ok := parseSubExpDate(coupon.ValidFrom); ok && now.Before(from) {
+		return nil, ErrCouponNotActive
+	}
+	if until, ok := parseSubExpDate(coupon.ValidUntil); ok && now.After(until) {
+		return nil, ErrCouponNotActive
+	}
+	if coupon.MaxRedemptions > 0 && coupon.RedemptionCount >= coupon.MaxRedemptions {
+		return nil, ErrCouponExhausted
+	}
+	if len(coupon.Plans) > 0 && !containsString(coupon.Plans, plan.PlanID) {
+		return nil, ErrCouponNotApplicable
+	}
+	if len(coupon.Classes) > 0 && !containsString(coupon.Classes, studentClass) {
+		return nil, ErrCouponNotApplicable
+	}
+
+	discount := coupon.DiscountValue
+	if coupon.DiscountType == "percent" {
+		discount = plan.Price * coupon.DiscountValue / 100
+	}
+	discount = math.Min(math.Round(discount*100)/100, plan.Price)
+
+	return &CouponQuote{
+		Code:          coupon.Code,
+		PlanID:        plan.PlanID,
+		OriginalPrice: plan.Price,
+		Discount:      discount,
+		FinalPrice:    math.Round((plan.Price-discount)*100) / 100,
+	}, nil
+}
+
+// HasRedeemedCoupon reports whether the student already used the coupon
+func HasRedeemedCoupon(code, uid string) (bool, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("coupon_redemptions"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"code": {S: aws.String(normalizeCouponCode(code))},
+			"uid":  {S: aws.String(uid)},
+		},
+	})
+	if err != nil {
+		return false, err
+	}
+	return result.Item != nil, nil
+}
+
+// couponRedemptionWrites bumps the redemption counter, only while under the
+// limit, and records the student's redemption, only once per student. They
+// are written in ApplySubscriptionPayment's transaction so that a coupon is
+// used up exactly when a payment is recorded; see couponRedemptionError.
+func couponRedemptionWrites(code, uid, reference string, discount float64, now time.Time) ([]*dynamodb.TransactWriteItem, error) {
+	av, err := dynamodbattribute.MarshalMap(CouponRedemptionItem{
+		Code:           code,
+		UID:            uid,
+		Reference:      reference,
+		DiscountAmount: discount,
+		RedeemedAt:     now.UTC().Format(subExpDateLayout),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return []*dynamodb.TransactWriteItem{
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String("coupons"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"code": {S: aws.String(code)},
+				},
+				UpdateExpression:    aws.String("ADD redemption_count :one"),
+				ConditionExpression: aws.String("max_redemptions = :zero OR redemption_count < max_redemptions"),
+				ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+					":one":  {N: aws.String("1")},
+					":zero": {N: aws.String("0")},
+				},
+			},
+		},
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String("coupon_redemptions"),
+				Item:                av,
+				ConditionExpression: aws.String("attribute_not_exists(uid)"),
+			},
+		},
+	}, nil
+}
+
+// couponRedemptionError returns the coupon error behind a payment transaction
+// carrying couponRedemptionWrites, or nil when the coupon was not the cause
+func couponRedemptionError(err error) error {
+	switch {
+	case isTransactionConditionFailure(err, paymentExtraWriteIndex):
+		return ErrCouponExhausted
+	case isTransactionConditionFailure(err, paymentExtraWriteIndex+1):
+		return ErrCouponAlreadyRedeemed
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type CouponRequest struct {
+	Code           string   `json:"code"`
+	DiscountType   string   `json:"discountType"`
+	DiscountValue  float64  `json:"discountValue"`
+	ValidFrom      string   `json:"validFrom"`
+	ValidUntil     string   `json:"validUntil"`
+	MaxRedemptions int      `json:"maxRedemptions"`
+	Plans          []string `json:"plans"`
+	Classes        []string `json:"classes"`
+	Active         bool     `json:"active"`
+}
+
+type CouponValidateRequest struct {
+	Code   string `json:"code"`
+	PlanID string `json:"planId"`
+}
+
+// Coupon APIs
+func HandleCouponUpsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userRole, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	// Coupons are shared by every tenant
+	if userRole != "super" || tenantID != DefaultTenantID {
+		return CreateErrorResponse(403, "Only 'super' role can manage coupons"), nil
+	}
+
+	var req CouponRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+
+	if normalizeCouponCode(req.Code) == "" {
+		return CreateErrorResponse(400, "Missing 'code' parameter"), nil
+	}
+	if req.DiscountType != "percent" && req.DiscountType != "fixed" {
+		return CreateErrorResponse(400, "'discountType' must be 'percent' or 'fixed'"), nil
+	}
+	if req.DiscountValue <= 0 || (req.DiscountType == "percent" && req.DiscountValue > 100) {
+		return CreateErrorResponse(400, "Invalid 'discountValue'"), nil
+	}
+	if req.MaxRedemptions < 0 {
+		return CreateErrorResponse(400, "'maxRedemptions' must not be negative"), nil
+	}
+	for _, date := range []string{req.ValidFrom, req.ValidUntil} {
+		if _, ok := parseSubExpDate(date); date != "" && !ok {
+			return CreateErrorResponse(400, "Invalid validity date format"), nil
+		}
+	}
+
+	coupon := CouponItem{
+		Code:           req.Code,
+		DiscountType:   req.DiscountType,
+		DiscountValue:  req.DiscountValue,
+		ValidFrom:      req.ValidFrom,
+		ValidUntil:     req.ValidUntil,
+		MaxRedemptions: req.MaxRedemptions,
+		Plans:          req.Plans,
+		Classes:        req.Classes,
+		Active:         req.Active,
+	}
+
+	if err := SaveCouponToDynamoDB(coupon); err != nil {
+		log.Printf("Failed to save coupon: %v", err)
+		return CreateErrorResponse(500, "Failed to save coupon"), nil
+	}
+
+	return CreateSuccessResponse("Coupon saved successfully"), nil
+}
+
+func HandleCouponFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if tenantID != DefaultTenantID {
+		return CreateErrorResponse(403, "Coupons are managed by the platform"), nil
+	}
+
+	coupons, err := FetchCoupons()
+	if err != nil {
+		log.Printf("Failed to fetch coupons: %v", err)
+		return CreateErrorResponse(500, "Failed to fetch coupons"), nil
+	}
+
+	response, _ := json.Marshal(coupons)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(response),
+	}, nil
+}
+
+// HandleCouponValidate returns the discounted price for a plan at checkout.
+// The coupon is only redeemed when the order is created with /v2/payments/order.
+func HandleCouponValidate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req CouponValidateRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.Code == "" || req.PlanID == "" {
+		return CreateErrorResponse(400, "Missing 'code' or 'planId' parameter"), nil
+	}
+
+	plan, err := GetPlanByID(req.PlanID)
+	if err != nil {
+		log.Printf("❌ Error fetching plan: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if plan == nil || !plan.Active {
+		return CreateErrorResponse(404, "Plan not found"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	quote, err := QuoteCoupon(req.Code, plan, student.StudentClass, time.Now())
+	if err != nil {
+		return couponErrorResponse(err), nil
+	}
+
+	response := map[string]interface{}{
+		"message": "Coupon is valid",
+		"coupon":  quote,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// couponErrorResponse maps coupon errors to API responses
+func couponErrorResponse(err error) events.APIGatewayProxyResponse {
+	switch {
+	case errors.Is(err, ErrCouponNotFound):
+		return CreateErrorResponse(404, "Coupon not found")
+	case errors.Is(err, ErrCouponAlreadyRedeemed):
+		return CreateErrorResponse(409, err.Error())
+	case errors.Is(err, ErrCouponNotActive), errors.Is(err, ErrCouponNotApplicable), errors.Is(err, ErrCouponExhausted):
+		return CreateErrorResponse(422, err.Error())
+	default:
+		log.Printf("❌ Coupon error: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error")
+	}
+}
@@ -1,10 +1,14 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
+	"os"
+	"strconv"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
@@ -24,11 +28,17 @@ func init() {
 		},
 	}
 
-	sess := session.Must(session.NewSession(&aws.Config{
+	config := &aws.Config{
 		Region:     aws.String("us-east-1"),
 		MaxRetries: aws.Int(3),
 		HTTPClient: httpClient,
-	}))
+	}
+	// Points tools such as the v1 migration at DynamoDB Local
+	if endpoint := os.Getenv("DYNAMODB_ENDPOINT"); endpoint != "" {
+		config.Endpoint = aws.String(endpoint)
+	}
+
+	sess := session.Must(session.NewSession(config))
 
 	dynamoClient = dynamodb.New(sess)
 }
@@ -41,6 +51,21 @@ type QuizItem struct {
 	SubjectName string      `json:"subject_name" dynamodbav:"subject_name"`
 	Topic       string      `json:"topic" dynamodbav:"topic"`
 	Questions   []Question  `json:"questions" dynamodbav:"questions"`
+	// Optional closing time; with HideAnswers results leave out correct
+	// answers and explanations until then
+	AvailableUntil string `json:"available_until,omitempty" dynamodbav:"available_until,omitempty"`
+	HideAnswers    bool   `json:"hide_answers,omitempty" dynamodbav:"hide_answers,omitempty"`
+	// Bank IDs parallel to Questions; the bank version wins on read
+	QuestionIDs []string `json:"question_ids,omitempty" dynamodbav:"question_ids,omitempty"`
+	// Set on practice quizzes only, see practice.go
+	OwnerUID  string           `json:"owner_uid,omitempty" dynamodbav:"owner_uid,omitempty"`
+	ExpiresAt int64            `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+	Sources   []QuestionSource `json:"sources,omitempty" dynamodbav:"sources,omitempty"`
+	// Set when the quiz's class, subject or topic was deleted with archiving
+	ArchivedAt string `json:"archived_at,omitempty" dynamodbav:"archived_at,omitempty"`
+	// Raised on every write, see version.go
+	Version  int    `json:"version,omitempty" dynamodbav:"version,omitempty"`
+	TenantID string `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
 }
 
 // Student item structure
@@ -68,6 +93,15 @@ type StudentInfoItem struct {
 	Amount       interface{} `json:"amount,omitempty" dynamodbav:"amount,omitempty"`
 	PaymentTime  interface{} `json:"payment_time,omitempty" dynamodbav:"payment_time,omitempty"`
 	Role         interface{} `json:"role,omitempty" dynamodbav:"role,omitempty"`
+	PlanID       string      `json:"plan_id,omitempty" dynamodbav:"plan_id,omitempty"`
+	BatchIDs     []string    `json:"batch_ids,omitempty" dynamodbav:"batch_ids,stringset,omitempty"`
+	// Hides the student from leaderboards
+	LeaderboardOptOut bool `json:"leaderboard_opt_out,omitempty" dynamodbav:"leaderboard_opt_out,omitempty"`
+	// Boards the student was written to, so opting out can clear past windows
+	LeaderboardBoards []string `json:"-" dynamodbav:"leaderboard_boards,stringset,omitempty"`
+	// Time of a class upgrade whose old attempts are still being archived
+	UpgradePending string `json:"-" dynamodbav:"upgrade_pending,omitempty"`
+	TenantID       string `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
 }
 
 // Quiz attempt item structure
@@ -76,6 +110,7 @@ type AttemptItem struct {
 	QuizName      string           `json:"quiz_name" dynamodbav:"quiz_name"`
 	ClassName     string           `json:"class_name" dynamodbav:"class_name"`
 	Category      string           `json:"category" dynamodbav:"category"`
+	Topic         string           `json:"topic,omitempty" dynamodbav:"topic,omitempty"`
 	CorrectCount  int              `json:"correct_count" dynamodbav:"correct_count"`
 	WrongCount    int              `json:"wrong_count" dynamodbav:"wrong_count"`
 	SkippedCount  int              `json:"skipped_count" dynamodbav:"skipped_count"`
@@ -84,336 +119,371 @@ type AttemptItem struct {
 	AttemptNumber int              `json:"attempt_number" dynamodbav:"attempt_number"`
 	AttemptedAt   string           `json:"attempted_at" dynamodbav:"attempted_at"`
 	Results       []QuestionResult `json:"results" dynamodbav:"results"`
+	StatsRecorded bool             `json:"stats_recorded,omitempty" dynamodbav:"stats_recorded,omitempty"`
+	// Rasch ability estimate of adaptive attempts, see adaptive.go
+	Ability   *float64 `json:"ability,omitempty" dynamodbav:"ability,omitempty"`
+	AbilitySE *float64 `json:"ability_se,omitempty" dynamodbav:"ability_se,omitempty"`
+	TenantID  string   `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
 }
 
-// Save quiz to DynamoDB
-func SaveQuizToDynamoDB(quiz QuizData) error {
+// Save quiz to DynamoDB, refusing to overwrite another tenant's quiz, and
+// return its new version. A non-nil expectedVersion must match the stored
+// quiz's version.
+func SaveQuizToDynamoDB(tenantID string, quiz QuizData, expectedVersion *int) (int, error) {
+	tenantID = normalizeTenantID(tenantID)
+	existing, err := getQuizItem(tenantID, quiz.QuizName)
+	if err != nil {
+		return 0, err
+	}
+	currentVersion := 0
+	if existing != nil {
+		currentVersion = existing.Version
+	}
+	if err := checkVersion(currentVersion, expectedVersion); err != nil {
+		return 0, err
+	}
+
 	item := QuizItem{
-		QuizName:    quiz.QuizName,
-		Duration:    quiz.Duration,
-		ClassName:   quiz.ClassName,
-		SubjectName: quiz.SubjectName,
-		Topic:       quiz.Topic,
-		Questions:   quiz.Questions,
+		QuizName:       scopedKey(tenantID, quiz.QuizName),
+		Duration:       quiz.Duration,
+		ClassName:      quiz.ClassName,
+		SubjectName:    quiz.SubjectName,
+		Topic:          quiz.Topic,
+		Questions:      quiz.Questions,
+		QuestionIDs:    quiz.QuestionIDs,
+		AvailableUntil: quiz.AvailableUntil,
+		HideAnswers:    quiz.HideAnswers,
+		Version:        currentVersion + 1,
+		TenantID:       tenantID,
 	}
 
 	av, err := dynamodbattribute.MarshalMap(item)
 	if err != nil {
-		return err
+		return 0, err
+	}
+
+	// The quiz must still be the one read above, so concurrent uploads of
+	// the same quiz cannot silently overwrite each other
+	condition := "attribute_not_exists(quiz_name)"
+	var names map[string]*string
+	var values map[string]*dynamodb.AttributeValue
+	if existing != nil {
+		names = map[string]*string{}
+		values = map[string]*dynamodb.AttributeValue{}
+		condition = tenantCondition(tenantID, values) + " AND " + versionCondition(currentVersion, names, values)
 	}
 
 	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("quiz_questions"),
-		Item:      av,
+		TableName:                 aws.String("quiz_questions"),
+		Item:                      av,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
 	})
-
-	return err
+	if isConditionFailure(err) {
+		return 0, ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	return item.Version, nil
 }
 
 // Get quiz from DynamoDB with filters
-func GetQuizFromDynamoDB(quizName, className, subjectName, topic string) (*QuizItem, error) {
-	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
-		TableName:        aws.String("quiz_questions"),
-		FilterExpression: aws.String("quiz_name = :quizName AND class_name = :className AND subject_name = :subjectName AND topic = :topic"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":quizName":    {S: aws.String(quizName)},
-			":className":   {S: aws.String(className)},
-			":subjectName": {S: aws.String(subjectName)},
-			":topic":       {S: aws.String(topic)},
-		},
-	})
-
-	if err != nil {
+func GetQuizFromDynamoDB(tenantID, quizName, className, subjectName, topic string) (*QuizItem, error) {
+	quiz, err := getQuizItem(tenantID, quizName)
+	if err != nil || quiz == nil {
 		return nil, err
 	}
 
-	if len(result.Items) == 0 {
+	if quiz.ClassName != className || quiz.SubjectName != subjectName || quiz.Topic != topic {
 		return nil, nil
 	}
 
-	var quiz QuizItem
-	err = dynamodbattribute.UnmarshalMap(result.Items[0], &quiz)
-	return &quiz, err
-}
-
-
-
-// Save quiz attempt to DynamoDB
-func SaveAttemptToDynamoDB(attempt AttemptItem) error {
-	av, err := dynamodbattribute.MarshalMap(attempt)
-	if err != nil {
-		return err
+	if err := ResolveQuizQuestions(tenantID, quiz); err != nil {
+		return nil, err
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		Item:      av,
-	})
-
-	return err
-}
-
-// Class Subject item structure
-type ClassSubjectItem struct {
-	ClassName   string   `json:"class_name" dynamodbav:"class_name"`
-	SubjectName string   `json:"subject_name" dynamodbav:"subject_name"`
-	Topics      []string `json:"topics" dynamodbav:"topics"`
+	quiz.QuizName = quizName
+	return quiz, nil
 }
 
-// Class operations
-func InsertClass(className string) error {
-	// Insert a placeholder item for the class
-	item := ClassSubjectItem{
-		ClassName:   className,
-		SubjectName: "_CLASS_PLACEHOLDER",
-		Topics:      []string{},
+// GetQuizByName fetches a tenant's quiz by name alone, for references such
+// as review cards whose class, subject or topic may predate a rename
+func GetQuizByName(tenantID, quizName string) (*QuizItem, error) {
+	quiz, err := getQuizItem(tenantID, quizName)
+	if err != nil || quiz == nil {
+		return nil, err
 	}
 
-	av, err := dynamodbattribute.MarshalMap(item)
-	if err != nil {
-		return err
+	if err := ResolveQuizQuestions(tenantID, quiz); err != nil {
+		return nil, err
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("class_subjects"),
-		Item:      av,
-	})
-	return err
+	quiz.QuizName = quizName
+	return quiz, nil
 }
 
-func DeleteClass(className string) error {
-	// Query all items for this class
-	result, err := dynamoClient.Query(&dynamodb.QueryInput{
-		TableName:              aws.String("class_subjects"),
-		KeyConditionExpression: aws.String("class_name = :className"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":className": {S: aws.String(className)},
+// getQuizItem reads a tenant's quiz as stored, without resolving bank
+// questions; the quiz name stays scoped
+func getQuizItem(tenantID, quizName string) (*QuizItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("quiz_questions"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"quiz_name": {S: aws.String(scopedKey(tenantID, quizName))},
 		},
 	})
-	if err != nil {
-		return err
-	}
-
-	// Delete all items
-	for _, item := range result.Items {
-		_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
-			TableName: aws.String("class_subjects"),
-			Key: map[string]*dynamodb.AttributeValue{
-				"class_name":   item["class_name"],
-				"subject_name": item["subject_name"],
-			},
-		})
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
 
-func FetchClasses() ([]string, error) {
-	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
-		TableName:        aws.String("class_subjects"),
-		FilterExpression: aws.String("subject_name = :placeholder"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":placeholder": {S: aws.String("_CLASS_PLACEHOLDER")},
-		},
-	})
 	if err != nil {
 		return nil, err
 	}
 
-	var classes []string
-	for _, item := range result.Items {
-		if className, ok := item["class_name"]; ok && className.S != nil {
-			classes = append(classes, *className.S)
-		}
-	}
-	return classes, nil
-}
-
-// Subject operations
-func InsertSubject(className, subjectName string) error {
-	item := ClassSubjectItem{
-		ClassName:   className,
-		SubjectName: subjectName,
-		Topics:      []string{},
+	if result.Item == nil {
+		return nil, nil
 	}
 
-	av, err := dynamodbattribute.MarshalMap(item)
+	var quiz QuizItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &quiz)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("class_subjects"),
-		Item:      av,
-	})
-	return err
+	if !belongsToTenant(quiz.TenantID, tenantID) {
+		return nil, nil
+	}
+	return &quiz, nil
 }
 
-func DeleteSubject(className, subjectName string) error {
-	_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: aws.String("class_subjects"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"class_name":   {S: aws.String(className)},
-			"subject_name": {S: aws.String(subjectName)},
-		},
-	})
-	return err
+// List quizzes for a tenant; empty subject or topic matches all. Practice
+// and archived quizzes are never listed.
+func ListQuizzes(tenantID, className, subjectName, topic string) ([]QuizItem, error) {
+	return listQuizzes(tenantID, className, subjectName, topic, false)
 }
 
-func FetchSubjects(className string) ([]string, error) {
-	result, err := dynamoClient.Query(&dynamodb.QueryInput{
-		TableName:              aws.String("class_subjects"),
-		KeyConditionExpression: aws.String("class_name = :className"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":className": {S: aws.String(className)},
-		},
+func listQuizzes(tenantID, className, subjectName, topic string, includeArchived bool) ([]QuizItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":className": {S: aws.String(className)},
+	}
+	filter := "class_name = :className AND attribute_not_exists(owner_uid) AND " + tenantCondition(tenantID, values)
+	if !includeArchived {
+		filter += " AND attribute_not_exists(archived_at)"
+	}
+	if subjectName != "" {
+		filter += " AND subject_name = :subjectName"
+		values[":subjectName"] = &dynamodb.AttributeValue{S: aws.String(subjectName)}
+	}
+	if topic != "" {
+		filter += " AND topic = :topic"
+		values[":topic"] = &dynamodb.AttributeValue{S: aws.String(topic)}
+	}
+
+	quizzes := []QuizItem{}
+	var unmarshalErr error
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("quiz_questions"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageQuizzes []QuizItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageQuizzes); unmarshalErr != nil {
+			return false
+		}
+		for _, quiz := range pageQuizzes {
+			quiz.QuizName = unscopedKey(tenantID, quiz.QuizName)
+			quizzes = append(quizzes, quiz)
+		}
+		return true
 	})
 	if err != nil {
 		return nil, err
 	}
+	return quizzes, unmarshalErr
+}
 
-	var subjects []string
-	for _, item := range result.Items {
-		if subjectName, ok := item["subject_name"]; ok && subjectName.S != nil {
-			// Filter out placeholder in code instead of DynamoDB
-			if *subjectName.S != "_CLASS_PLACEHOLDER" {
-				subjects = append(subjects, *subjectName.S)
-			}
-		}
-	}
-	if subjects == nil {
-		subjects = []string{}
+// Delete quiz from DynamoDB, only if it belongs to the tenant and, when
+// given, is still at expectedVersion
+func DeleteQuizFromDynamoDB(tenantID, quizName string, expectedVersion *int) error {
+	var names map[string]*string
+	values := map[string]*dynamodb.AttributeValue{}
+	condition := tenantCondition(tenantID, values)
+	if expectedVersion != nil {
+		names = map[string]*string{}
+		condition += " AND " + versionCondition(*expectedVersion, names, values)
 	}
-	return subjects, nil
-}
 
-// Topic operations
-func InsertTopic(className, subjectName, topic string) error {
-	// Get current item
-	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String("class_subjects"),
+	_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("quiz_questions"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"class_name":   {S: aws.String(className)},
-			"subject_name": {S: aws.String(subjectName)},
+			"quiz_name": {S: aws.String(scopedKey(tenantID, quizName))},
 		},
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
 	})
-	if err != nil {
-		return err
+	if expectedVersion != nil && isConditionFailure(err) {
+		return ErrVersionConflict
 	}
+	return err
+}
 
-	var topics []string
-	if result.Item != nil {
-		var item ClassSubjectItem
-		err = dynamodbattribute.UnmarshalMap(result.Item, &item)
-		if err != nil {
-			return err
-		}
-		topics = item.Topics
-	}
-
-	// Check if topic already exists
-	for _, t := range topics {
-		if t == topic {
-			return nil // Already exists
-		}
-	}
-
-	// Add new topic
-	topics = append(topics, topic)
-
-	// Update item
-	item := ClassSubjectItem{
-		ClassName:   className,
-		SubjectName: subjectName,
-		Topics:      topics,
+// Save quiz attempt to DynamoDB, replacing the student's previous attempt at
+// the quiz, and add it to the attempt log
+func SaveAttemptToDynamoDB(tenantID string, attempt AttemptItem) error {
+	attempt.TenantID = normalizeTenantID(tenantID)
+	av, err := dynamodbattribute.MarshalMap(attempt)
+	if err != nil {
+		return err
 	}
-
-	av, err := dynamodbattribute.MarshalMap(item)
+	logPut, err := attemptLogPut(attempt)
 	if err != nil {
 		return err
 	}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("class_subjects"),
-		Item:      av,
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName: aws.String("student_quiz_attempts_v2"),
+					Item:      av,
+				},
+			},
+			logPut,
+		},
 	})
+
 	return err
 }
 
-func DeleteTopic(className, subjectName, topic string) error {
-	// Get current item
+// Get a student's attempt for a quiz
+func GetAttempt(tenantID, uid, quizName string) (*AttemptItem, error) {
 	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String("class_subjects"),
+		TableName: aws.String("student_quiz_attempts_v2"),
 		Key: map[string]*dynamodb.AttributeValue{
-			"class_name":   {S: aws.String(className)},
-			"subject_name": {S: aws.String(subjectName)},
+			"uid":       {S: aws.String(uid)},
+			"quiz_name": {S: aws.String(quizName)},
 		},
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if result.Item == nil {
-		return nil // Item doesn't exist
+		return nil, nil
 	}
 
-	var item ClassSubjectItem
-	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	var attempt AttemptItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &attempt)
 	if err != nil {
-		return err
+		return nil, err
 	}
-
-	// Remove topic
-	var newTopics []string
-	for _, t := range item.Topics {
-		if t != topic {
-			newTopics = append(newTopics, t)
-		}
+	if !belongsToTenant(attempt.TenantID, tenantID) {
+		return nil, nil
 	}
+	return &attempt, nil
+}
 
-	// Update item
-	item.Topics = newTopics
-	av, err := dynamodbattribute.MarshalMap(item)
+// Get all attempts of a student
+func GetStudentAttempts(tenantID, uid string) ([]AttemptItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":uid": {S: aws.String(uid)},
+	}
+
+	attempts := []AttemptItem{}
+	var unmarshalErr error
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:                 aws.String("student_quiz_attempts_v2"),
+		KeyConditionExpression:    aws.String("uid = :uid"),
+		FilterExpression:          aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageAttempts []AttemptItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageAttempts); unmarshalErr != nil {
+			return false
+		}
+		attempts = append(attempts, pageAttempts...)
+		return true
+	})
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return attempts, unmarshalErr
+}
 
-	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("class_subjects"),
-		Item:      av,
+// Delete a student's attempt for a quiz
+func DeleteAttempt(uid, quizName string) error {
+	_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("student_quiz_attempts_v2"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid":       {S: aws.String(uid)},
+			"quiz_name": {S: aws.String(quizName)},
+		},
 	})
 	return err
 }
 
-func FetchTopics(className, subjectName string) ([]string, error) {
-	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String("class_subjects"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"class_name":   {S: aws.String(className)},
-			"subject_name": {S: aws.String(subjectName)},
-		},
+// attemptPercentage reads percentage stored as a number or, for older rows, a string
+func attemptPercentage(attempt AttemptItem) float64 {
+	switch v := attempt.Percentage.(type) {
+	case float64:
+		return v
+	case string:
+		percentage, _ := strconv.ParseFloat(v, 64)
+		return percentage
+	}
+	return 0
+}
+
+// Delete every tenant attempt for a quiz, returning how many were removed
+func DeleteQuizAttempts(tenantID, quizName, className, subjectName string) (int, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":quizName":    {S: aws.String(quizName)},
+		":className":   {S: aws.String(className)},
+		":subjectName": {S: aws.String(subjectName)},
+	}
+	filter := "quiz_name = :quizName AND class_name = :className AND category = :subjectName AND " + tenantCondition(tenantID, values)
+
+	var keys []map[string]*dynamodb.AttributeValue
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("student_quiz_attempts_v2"),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+		ProjectionExpression:      aws.String("uid, quiz_name"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		keys = append(keys, page.Items...)
+		return true
 	})
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	if result.Item == nil {
-		return []string{}, nil
+	for _, key := range keys {
+		_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("student_quiz_attempts_v2"),
+			Key:       key,
+		})
+		if err != nil {
+			return 0, err
+		}
 	}
+	return len(keys), nil
+}
 
-	var item ClassSubjectItem
-	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
-	if err != nil {
+// Get student info by UID, hiding students of other tenants
+func GetStudentInfoByUID(tenantID, uid string) (*StudentInfoItem, error) {
+	student, err := getStudentInfoByUIDAnyTenant(uid)
+	if err != nil || student == nil {
 		return nil, err
 	}
 
-	return item.Topics, nil
+	if !belongsToTenant(student.TenantID, tenantID) {
+		return nil, nil
+	}
+	return student, nil
 }
 
-// Get student info by UID
-func GetStudentInfoByUID(uid string) (*StudentInfoItem, error) {
+// getStudentInfoByUIDAnyTenant is for callers that have no tenant context yet,
+// such as registration and payment webhooks
+func getStudentInfoByUIDAnyTenant(uid string) (*StudentInfoItem, error) {
 	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
 		TableName: aws.String("students_info"),
 		Key: map[string]*dynamodb.AttributeValue{
@@ -435,14 +505,16 @@ func GetStudentInfoByUID(uid string) (*StudentInfoItem, error) {
 }
 
 // Get student info by email using GSI
-func GetStudentInfoByEmail(email string) (*StudentInfoItem, error) {
+func GetStudentInfoByEmail(tenantID, email string) (*StudentInfoItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":email": {S: aws.String(email)},
+	}
 	result, err := dynamoClient.Query(&dynamodb.QueryInput{
-		TableName:              aws.String("students_info"),
-		IndexName:              aws.String("email-index"),
-		KeyConditionExpression: aws.String("email = :email"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":email": {S: aws.String(email)},
-		},
+		TableName:                 aws.String("students_info"),
+		IndexName:                 aws.String("email-index"),
+		KeyConditionExpression:    aws.String("email = :email"),
+		FilterExpression:          aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
 	})
 
 	if err != nil {
@@ -458,17 +530,134 @@ func GetStudentInfoByEmail(email string) (*StudentInfoItem, error) {
 	return &student, err
 }
 
-// Save student info to DynamoDB
-func SaveStudentInfoToDynamoDB(student StudentInfoItem) error {
+// Find student info by phone number within a tenant
+func FindStudentInfoByPhone(tenantID, phone string) (*StudentInfoItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":phone": {S: aws.String(phone)},
+	}
+
+	var found map[string]*dynamodb.AttributeValue
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("students_info"),
+		FilterExpression:          aws.String("phone_number = :phone AND " + tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		if len(page.Items) > 0 {
+			found = page.Items[0]
+			return false
+		}
+		return true
+	})
+	if err != nil || found == nil {
+		return nil, err
+	}
+
+	var student StudentInfoItem
+	err = dynamodbattribute.UnmarshalMap(found, &student)
+	return &student, err
+}
+
+// Save student info to DynamoDB, refusing to overwrite another tenant's student
+func SaveStudentInfoToDynamoDB(tenantID string, student StudentInfoItem) error {
+	student.TenantID = normalizeTenantID(tenantID)
 	av, err := dynamodbattribute.MarshalMap(student)
 	if err != nil {
 		return err
 	}
 
+	values := map[string]*dynamodb.AttributeValue{}
+	condition := "attribute_not_exists(uid) OR " + tenantCondition(tenantID, values)
+
 	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
-		TableName: aws.String("students_info"),
-		Item:      av,
+		TableName:                 aws.String("students_info"),
+		Item:                      av,
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeValues: values,
 	})
 
 	return err
 }
+
+// isConditionFailure reports whether a single-item write failed its condition
+func isConditionFailure(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
+
+// formatNumber renders a number attribute value
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// stringListAttribute renders a string slice as a list attribute value
+func stringListAttribute(values []string) *dynamodb.AttributeValue {
+	list := []*dynamodb.AttributeValue{}
+	for _, v := range values {
+		list = append(list, &dynamodb.AttributeValue{S: aws.String(v)})
+	}
+	return &dynamodb.AttributeValue{L: list}
+}
+
+// Most items a single BatchWriteItem call accepts
+const batchWriteSize = 25
+
+// BatchPutItems writes items to a table in batches, retrying unprocessed
+// items with backoff. Items are written unconditionally.
+func BatchPutItems(tableName string, items []map[string]*dynamodb.AttributeValue) error {
+	for start := 0; start < len(items); start += batchWriteSize {
+		end := min(start+batchWriteSize, len(items))
+
+		requests := []*dynamodb.WriteRequest{}
+		for _, item := range items[start:end] {
+			requests = append(requests, &dynamodb.WriteRequest{
+				PutRequest: &dynamodb.PutRequest{Item: item},
+			})
+		}
+
+		pending := map[string][]*dynamodb.WriteRequest{tableName: requests}
+		for retry := 0; len(pending[tableName]) > 0; retry++ {
+			if retry > 0 {
+				if retry > 8 {
+					return fmt.Errorf("%d items left unprocessed in %s", len(pending[tableName]), tableName)
+				}
+				time.Sleep(time.Duration(1<<min(retry, 5)) * 100 * time.Millisecond)
+			}
+			result, err := dynamoClient.BatchWriteItem(&dynamodb.BatchWriteItemInput{RequestItems: pending})
+			if err != nil {
+				return err
+			}
+			pending = result.UnprocessedItems
+		}
+	}
+	return nil
+}
+
+// ScanTable passes every item of a table to fn, a page at a time
+func ScanTable(tableName string, fn func(items []map[string]*dynamodb.AttributeValue) error) error {
+	var fnErr error
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		fnErr = fn(page.Items)
+		return fnErr == nil
+	})
+	if err != nil {
+		return err
+	}
+	return fnErr
+}
+
+// PutItemIfAbsent writes an item unless one with the same primary key exists,
+// and reports whether it was written. keyAttribute is the partition key.
+func PutItemIfAbsent(tableName, keyAttribute string, item map[string]*dynamodb.AttributeValue) (bool, error) {
+	_, err := dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName:                aws.String(tableName),
+		Item:                     item,
+		ConditionExpression:      aws.String("attribute_not_exists(#key)"),
+		ExpressionAttributeNames: map[string]*string{"#key": aws.String(keyAttribute)},
+	})
+	if isConditionFailure(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// The v2 lambda normally trusts the uid, email and tenant_id that the Node
+// authorizer puts in RequestContext.Authorizer. With FIREBASE_VERIFY_TOKENS
+// set to true it verifies the Firebase ID token in the Authorization header
+// itself and fills in the same context, e.g. for the local dev server.
+// FIREBASE_JWKS_URL may point at another JWKS, an http(s) URL or a file, to
+// accept tokens signed with local test keys (see cmd/dev-token).
+
+// Google's signing keys for Firebase ID tokens in JWK format
+const firebaseJWKSURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+const firebaseIssuerPrefix = "https://securetoken.google.com/"
+
+const (
+	// How long keys are cached when the JWKS response has no max-age
+	defaultJWKSCacheTTL = time.Hour
+	// Least time between two JWKS fetches triggered by an unknown key ID
+	minJWKSRefresh = time.Minute
+	// Clock difference tolerated on exp, iat and auth_time
+	tokenClockSkew = time.Minute
+)
+
+var (
+	ErrNoIDToken      = errors.New("missing bearer token")
+	ErrInvalidIDToken = errors.New("invalid ID token")
+)
+
+var maxAgePattern = regexp.MustCompile(`max-age=(\d+)`)
+
+// Claims set by Firebase itself; everything else in a token is a custom claim
+var registeredClaims = []string{
+	"iss", "aud", "auth_time", "user_id", "sub", "iat", "exp",
+	"email", "email_verified", "phone_number", "name", "picture", "firebase",
+}
+
+// FirebaseToken is a verified Firebase ID token
+type FirebaseToken struct {
+	UID           string
+	Email         string
+	EmailVerified bool
+	PhoneNumber   string
+	// Custom claims set through the Admin SDK
+	TenantID   string
+	Role       string
+	RoleTenant string
+	Claims     map[string]interface{}
+
+	AuthTime  time.Time
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// FirebaseVerifier checks Firebase ID tokens of one project against a cached
+// JWKS
+type FirebaseVerifier struct {
+	ProjectID string
+	JWKSURL   string
+
+	now func() time.Time
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	expires   time.Time
+	fetchedAt time.Time
+}
+
+func NewFirebaseVerifier(projectID, jwksURL string) *FirebaseVerifier {
+	if jwksURL == "" {
+		jwksURL = firebaseJWKSURL
+	}
+	return &FirebaseVerifier{ProjectID: projectID, JWKSURL: jwksURL, now: time.Now}
+}
+
+var (
+	firebaseVerifier     *FirebaseVerifier
+	firebaseVerifierOnce sync.Once
+)
+
+// GetFirebaseVerifier returns the in-process verifier, or nil unless
+// FIREBASE_VERIFY_TOKENS is true
+func GetFirebaseVerifier() *FirebaseVerifier {
+	firebaseVerifierOnce.Do(func() {
+		if os.Getenv("FIREBASE_VERIFY_TOKENS") != "true" {
+			return
+		}
+		projectID := os.Getenv("FIREBASE_PROJECT_ID")
+		if projectID == "" {
+			// Left in place so every token is refused rather than trusted
+			log.Printf("❌ FIREBASE_VERIFY_TOKENS is set without FIREBASE_PROJECT_ID")
+		}
+		firebaseVerifier = NewFirebaseVerifier(projectID, os.Getenv("FIREBASE_JWKS_URL"))
+	})
+	return firebaseVerifier
+}
+
+// AuthenticateRequest verifies the request's bearer token and fills the
+// authorizer context the handlers read. It returns ErrNoIDToken when the
+// request carries no token, leaving the context untouched.
+func (v *FirebaseVerifier) AuthenticateRequest(request *events.APIGatewayProxyRequest) (*FirebaseToken, error) {
+	header := ""
+	for name, value := range request.Headers {
+		if strings.EqualFold(name, "Authorization") {
+			header = value
+			break
+		}
+	}
+	if header == "" {
+		return nil, ErrNoIDToken
+	}
+	if !strings.HasPrefix(header, "Bearer ") {
+		return nil, fmt.Errorf("%w: expected a bearer token", ErrInvalidIDToken)
+	}
+
+	token, err := v.VerifyIDToken(strings.TrimSpace(strings.TrimPrefix(header, "Bearer ")))
+	if err != nil {
+		return nil, err
+	}
+
+	// Same keys as the Node authorizer's context
+	request.RequestContext.Authorizer = map[string]interface{}{
+		"uid":          token.UID,
+		"user_id":      token.UID,
+		"email":        token.Email,
+		"phone_number": token.PhoneNumber,
+		"tenant_id":    token.TenantID,
+		"role":         token.Role,
+		"role_tenant":  token.RoleTenant,
+	}
+	return token, nil
+}
+
+// VerifyIDToken checks an ID token's RS256 signature, audience, issuer and
+// lifetime and returns its claims
+func (v *FirebaseVerifier) VerifyIDToken(idToken string) (*FirebaseToken, error) {
+	if v.ProjectID == "" {
+		return nil, fmt.Errorf("%w: no Firebase project configured", ErrInvalidIDToken)
+	}
+
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidIDToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeTokenSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("%w: unexpected algorithm %q", ErrInvalidIDToken, header.Alg)
+	}
+	if header.Kid == "" {
+		return nil, fmt.Errorf("%w: missing key ID", ErrInvalidIDToken)
+	}
+
+	key, err := v.publicKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidIDToken)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidIDToken)
+	}
+
+	var claims map[string]interface{}
+	if err := decodeTokenSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	return v.checkClaims(claims)
+}
+
+func (v *FirebaseVerifier) checkClaims(claims map[string]interface{}) (*FirebaseToken, error) {
+	now := v.now()
+	if aud, _ := claims["aud"].(string); aud != v.ProjectID {
+		return nil, fmt.Errorf("%w: unexpected audience %q", ErrInvalidIDToken, aud)
+	}
+	if iss, _ := claims["iss"].(string); iss != firebaseIssuerPrefix+v.ProjectID {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidIDToken, iss)
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" || len(sub) > 128 {
+		return nil, fmt.Errorf("%w: invalid subject", ErrInvalidIDToken)
+	}
+
+	token := &FirebaseToken{
+		UID:       sub,
+		ExpiresAt: claimTime(claims, "exp"),
+		IssuedAt:  claimTime(claims, "iat"),
+		AuthTime:  claimTime(claims, "auth_time"),
+		Claims:    map[string]interface{}{},
+	}
+	if token.ExpiresAt.IsZero() || !now.Before(token.ExpiresAt.Add(tokenClockSkew)) {
+		return nil, fmt.Errorf("%w: token expired", ErrInvalidIDToken)
+	}
+	if token.IssuedAt.IsZero() || token.IssuedAt.After(now.Add(tokenClockSkew)) {
+		return nil, fmt.Errorf("%w: token issued in the future", ErrInvalidIDToken)
+	}
+	if token.AuthTime.IsZero() || token.AuthTime.After(now.Add(tokenClockSkew)) {
+		return nil, fmt.Errorf("%w: invalid auth_time", ErrInvalidIDToken)
+	}
+
+	token.Email, _ = claims["email"].(string)
+	token.EmailVerified, _ = claims["email_verified"].(bool)
+	token.PhoneNumber, _ = claims["phone_number"].(string)
+	for name, value := range claims {
+		if !containsString(registeredClaims, name) {
+			token.Claims[name] = value
+		}
+	}
+	token.TenantID, _ = token.Claims["tenant_id"].(string)
+	token.Role, _ = token.Claims["role"].(string)
+	token.RoleTenant, _ = token.Claims["role_tenant"].(string)
+	return token, nil
+}
+
+// publicKey returns the key with the given ID, refetching the JWKS when the
+// cache has expired or the key is unknown (Google rotates its keys)
+func (v *FirebaseVerifier) publicKey(kid string) (*rsa.PublicKey, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	key, ok := v.keys[kid]
+	stale := now.After(v.expires)
+	if ok && !stale {
+		return key, nil
+	}
+	if stale || now.Sub(v.fetchedAt) >= minJWKSRefresh {
+		keys, ttl, err := fetchJWKS(v.JWKSURL)
+		if err != nil {
+			log.Printf("❌ Error fetching JWKS from %s: %v", v.JWKSURL, err)
+			// Keep using cached keys while the endpoint is unavailable
+			if ok {
+				return key, nil
+			}
+			return nil, fmt.Errorf("fetching signing keys: %w", err)
+		}
+		v.keys, v.expires, v.fetchedAt = keys, now.Add(ttl), now
+		key, ok = keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key ID %q", ErrInvalidIDToken, kid)
+	}
+	return key, nil
+}
+
+// fetchJWKS reads a JWKS from an http(s) URL or a local file and returns its
+// RSA keys with how long they may be cached
+func fetchJWKS(source string) (map[string]*rsa.PublicKey, time.Duration, error) {
+	var body []byte
+	ttl := defaultJWKSCacheTTL
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, 0, fmt.Errorf("JWKS request returned %s", resp.Status)
+		}
+		if body, err = io.ReadAll(resp.Body); err != nil {
+			return nil, 0, err
+		}
+		if m := maxAgePattern.FindStringSubmatch(resp.Header.Get("Cache-Control")); m != nil {
+			if seconds, err := strconv.Atoi(m[1]); err == nil {
+				ttl = time.Duration(seconds) * time.Second
+			}
+		}
+	} else {
+		var err error
+		if body, err = os.ReadFile(strings.TrimPrefix(source, "file://")); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	keys, err := ParseJWKS(body)
+	if err != nil {
+		return nil, 0, err
+	}
+	return keys, ttl, nil
+}
+
+// JSONWebKey is an RSA key of a JWKS
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// NewJSONWebKey describes an RSA public key as a signing JWK
+func NewJSONWebKey(kid string, key *rsa.PublicKey) JSONWebKey {
+	return JSONWebKey{
+		Kty: "RSA",
+		Alg: "RS256",
+		Use: "sig",
+		Kid: kid,
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+// ParseJWKS returns the RSA keys of a JWKS document by key ID
+func ParseJWKS(data []byte) (map[string]*rsa.PublicKey, error) {
+	var jwks struct {
+		Keys []JSONWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Kty != "RSA" || jwk.Kid == "" {
+			continue
+		}
+		n, errN := base64.RawURLEncoding.DecodeString(jwk.N)
+		e, errE := base64.RawURLEncoding.DecodeString(jwk.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid JWKS key %q", jwk.Kid)
+		}
+		keys[jwk.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS holds no RSA keys")
+	}
+	return keys, nil
+}
+
+// SignJWT signs claims as an RS256 JWT, for test tokens and Google service
+// account assertions
+func SignJWT(key *rsa.PrivateKey, kid string, claims map[string]interface{}) (string, error) {
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	headerJSON, _ := json.Marshal(header)
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+func decodeTokenSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidIDToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidIDToken)
+	}
+	return nil
+}
+
+// claimTime reads a NumericDate claim, zero when missing
+func claimTime(claims map[string]interface{}, name string) time.Time {
+	seconds, ok := claims[name].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(seconds), 0)
+}
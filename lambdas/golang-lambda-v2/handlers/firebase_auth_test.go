@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const testProjectID = "demo-project"
+
+func newTestKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	return key
+}
+
+// writeTestJWKS writes the public halves of keys, by key ID, as a JWKS file
+func writeTestJWKS(t *testing.T, path string, keys map[string]*rsa.PrivateKey) {
+	t.Helper()
+	jwks := []JSONWebKey{}
+	for kid, key := range keys {
+		jwks = append(jwks, NewJSONWebKey(kid, &key.PublicKey))
+	}
+	data, _ := json.Marshal(map[string]interface{}{"keys": jwks})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("writing JWKS: %v", err)
+	}
+}
+
+// newTestVerifier returns a verifier reading path whose clock is *now
+func newTestVerifier(path string, now *time.Time) *FirebaseVerifier {
+	v := NewFirebaseVerifier(testProjectID, path)
+	v.now = func() time.Time { return *now }
+	return v
+}
+
+func validClaims(now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"iss":         firebaseIssuerPrefix + testProjectID,
+		"aud":         testProjectID,
+		"sub":         "u1",
+		"user_id":     "u1",
+		"email":       "a@b.c",
+		"auth_time":   now.Add(-time.Hour).Unix(),
+		"iat":         now.Add(-time.Minute).Unix(),
+		"exp":         now.Add(time.Hour).Unix(),
+		"tenant_id":   "t1",
+		"role":        "teacher",
+		"role_tenant": "t1",
+	}
+}
+
+func signTestToken(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	token, err := SignJWT(key, kid, claims)
+	if err != nil {
+		t.Fatalf("signing token: %v", err)
+	}
+	return token
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key, otherKey := newTestKey(t), newTestKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, path, map[string]*rsa.PrivateKey{"k1": key})
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	withClaim := func(name string, value interface{}) map[string]interface{} {
+		claims := validClaims(now)
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+	valid := signTestToken(t, key, "k1", validClaims(now))
+	parts := strings.Split(valid, ".")
+	hs256Header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"k1"}`))
+	noKidHeader := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256"}`))
+	otherPayload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"someone-else"}`))
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{"valid", valid, ""},
+		{"expiry within clock skew", signTestToken(t, key, "k1", withClaim("exp", now.Add(-30*time.Second).Unix())), ""},
+		{"expired", signTestToken(t, key, "k1", withClaim("exp", now.Add(-2*time.Minute).Unix())), "token expired"},
+		{"missing exp", signTestToken(t, key, "k1", withClaim("exp", nil)), "token expired"},
+		{"issued in the future", signTestToken(t, key, "k1", withClaim("iat", now.Add(2*time.Minute).Unix())), "issued in the future"},
+		{"missing iat", signTestToken(t, key, "k1", withClaim("iat", nil)), "issued in the future"},
+		{"auth_time in the future", signTestToken(t, key, "k1", withClaim("auth_time", now.Add(2*time.Minute).Unix())), "invalid auth_time"},
+		{"missing auth_time", signTestToken(t, key, "k1", withClaim("auth_time", nil)), "invalid auth_time"},
+		{"wrong audience", signTestToken(t, key, "k1", withClaim("aud", "other-project")), "unexpected audience"},
+		{"wrong issuer", signTestToken(t, key, "k1", withClaim("iss", "https://securetoken.google.com/other-project")), "unexpected issuer"},
+		{"missing subject", signTestToken(t, key, "k1", withClaim("sub", nil)), "invalid subject"},
+		{"long subject", signTestToken(t, key, "k1", withClaim("sub", strings.Repeat("u", 129))), "invalid subject"},
+		{"signed by another key", signTestToken(t, otherKey, "k1", validClaims(now)), "bad signature"},
+		{"tampered payload", parts[0] + "." + otherPayload + "." + parts[2], "bad signature"},
+		{"unknown key ID", signTestToken(t, key, "k2", validClaims(now)), "unknown key ID"},
+		{"HS256", hs256Header + "." + parts[1] + "." + parts[2], "unexpected algorithm"},
+		{"missing key ID", noKidHeader + "." + parts[1] + "." + parts[2], "missing key ID"},
+		{"malformed", "not-a-token", "malformed token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := now
+			token, err := newTestVerifier(path, &clock).VerifyIDToken(tt.token)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if token.UID != "u1" || token.TenantID != "t1" || token.Role != "teacher" || token.RoleTenant != "t1" {
+					t.Errorf("got uid %q, tenant %q, role %q in %q", token.UID, token.TenantID, token.Role, token.RoleTenant)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidIDToken) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenWithoutProject(t *testing.T) {
+	v := NewFirebaseVerifier("", "unused.json")
+	if _, err := v.VerifyIDToken("a.b.c"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Errorf("got %v, want ErrInvalidIDToken", err)
+	}
+}
+
+func TestPublicKeyRefresh(t *testing.T) {
+	oldKey, newKey := newTestKey(t), newTestKey(t)
+	start := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		// Time after start at which the token signed by the new key is checked
+		after time.Duration
+		// Removes the JWKS file before that check
+		unavailable bool
+		wantErr     bool
+	}{
+		{"unknown key within the refresh interval", 30 * time.Second, false, true},
+		{"unknown key after the refresh interval", minJWKSRefresh, false, false},
+		{"unknown key with the JWKS unavailable", 2 * minJWKSRefresh, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			writeTestJWKS(t, path, map[string]*rsa.PrivateKey{"old": oldKey})
+			clock := start
+			v := newTestVerifier(path, &clock)
+			if _, err := v.VerifyIDToken(signTestToken(t, oldKey, "old", validClaims(clock))); err != nil {
+				t.Fatalf("first token: %v", err)
+			}
+
+			// Keys rotate
+			writeTestJWKS(t, path, map[string]*rsa.PrivateKey{"new": newKey})
+			if tt.unavailable {
+				os.Remove(path)
+			}
+			clock = start.Add(tt.after)
+			_, err := v.VerifyIDToken(signTestToken(t, newKey, "new", validClaims(clock)))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("got error %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublicKeyKeepsCacheWhenFetchFails(t *testing.T) {
+	key := newTestKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, path, map[string]*rsa.PrivateKey{"k1": key})
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	v := newTestVerifier(path, &clock)
+	if _, err := v.VerifyIDToken(signTestToken(t, key, "k1", validClaims(clock))); err != nil {
+		t.Fatalf("first token: %v", err)
+	}
+
+	// The cache has expired and the JWKS is gone
+	os.Remove(path)
+	clock = clock.Add(2 * defaultJWKSCacheTTL)
+	if _, err := v.VerifyIDToken(signTestToken(t, key, "k1", validClaims(clock))); err != nil {
+		t.Errorf("cached key not used: %v", err)
+	}
+}
+
+func TestAuthenticateRequest(t *testing.T) {
+	key := newTestKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeTestJWKS(t, path, map[string]*rsa.PrivateKey{"k1": key})
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	token := signTestToken(t, key, "k1", validClaims(clock))
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		wantErr error
+	}{
+		{"bearer token", map[string]string{"Authorization": "Bearer " + token}, nil},
+		{"lower-case header", map[string]string{"authorization": "Bearer " + token}, nil},
+		{"no token", map[string]string{}, ErrNoIDToken},
+		{"not a bearer token", map[string]string{"Authorization": "Basic dTpw"}, ErrInvalidIDToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{Headers: tt.headers}
+			_, err := newTestVerifier(path, &clock).AuthenticateRequest(&request)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("got %v, want %v", err, tt.wantErr)
+				}
+				if request.RequestContext.Authorizer != nil {
+					t.Errorf("authorizer context set on failure")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			authorizer := request.RequestContext.Authorizer
+			if authorizer["uid"] != "u1" || authorizer["tenant_id"] != "t1" || authorizer["role"] != "teacher" || authorizer["role_tenant"] != "t1" {
+				t.Errorf("got authorizer context %v", authorizer)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// quiz_item_stats holds one row per question (qno >= 1) with counters for the
+// latest attempt of each student, plus a summary row (qno = 0) with the score
+// histogram. Counters are maintained with ADD on every submit:
+//
+//	attempts, correct, skipped   per question
+//	opt_<letter>                 students who picked the option
+//	cbs_<score>                  students with total score <score> who got it right
+//	timed                        students who reported time on the question
+//	tm_<seconds>                 students whose time fell in the bucket starting at <seconds>
+//	sc_<score>                   students with total score <score> (summary row)
+const itemStatsSummaryQno = 0
+
+// Width and last bucket of the time-spent histogram, in seconds
+const (
+	timeBucketSec    = 5
+	maxTimeBucketSec = 600
+)
+
+// Share of students in the upper and lower groups for the discrimination index
+const discriminationGroupShare = 0.27
+
+// Item analysis flags
+const (
+	FlagNegativeDiscrimination = "NEGATIVE_DISCRIMINATION"
+	FlagUnusedDistractor       = "UNUSED_DISTRACTOR"
+)
+
+type OptionStat struct {
+	Option    string  `json:"option"`
+	Text      string  `json:"text"`
+	IsCorrect bool    `json:"isCorrect"`
+	Count     int     `json:"count"`
+	Frequency float64 `json:"frequency"`
+}
+
+type ItemAnalysis struct {
+	Qno            int          `json:"qno"`
+	Question       string       `json:"question"`
+	Attempts       int          `json:"attempts"`
+	Correct        int          `json:"correct"`
+	Skipped        int          `json:"skipped"`
+	Difficulty     float64      `json:"difficulty"` // p-value, share answering correctly
+	SkipRate       float64      `json:"skipRate"`
+	Discrimination float64      `json:"discrimination"`
+	TimedAttempts  int          `json:"timedAttempts"`
+	MedianTimeSec  *float64     `json:"medianTimeSec"`
+	Options        []OptionStat `json:"options"`
+	Flags          []string     `json:"flags"`
+}
+
+// itemStatsDelta maps qno to counter deltas
+type itemStatsDelta map[int]map[string]int
+
+func (d itemStatsDelta) add(qno int, counter string, value int) {
+	if d[qno] == nil {
+		d[qno] = make(map[string]int)
+	}
+	d[qno][counter] += value
+}
+
+// optionLetter returns the letter for the option at index i
+func optionLetter(i int) string {
+	return string(rune('A' + i))
+}
+
+// resultOptionLetters returns the option letters picked for a question. Results
+// saved before SelectedOptions existed are mapped back from the answer text.
+func resultOptionLetters(result QuestionResult, question Question) []string {
+	if result.SelectedOptions != nil {
+		return result.SelectedOptions
+	}
+
+	letters := []string{}
+	for _, answer := range result.StudentAnswer {
+		for i, text := range question.AllAnswers {
+			if text == answer {
+				letters = append(letters, optionLetter(i))
+				break
+			}
+		}
+	}
+	return letters
+}
+
+// addAttemptToItemStats adds (sign 1) or removes (sign -1) an attempt's
+// contribution to the item statistics
+func addAttemptToItemStats(delta itemStatsDelta, quiz *QuizItem, results []QuestionResult, correctCount, sign int) {
+	score := strconv.Itoa(correctCount)
+	delta.add(itemStatsSummaryQno, "attempts", sign)
+	delta.add(itemStatsSummaryQno, "sc_"+score, sign)
+
+	for _, result := range results {
+		if result.Qno < 1 || result.Qno > len(quiz.Questions) {
+			continue
+		}
+		delta.add(result.Qno, "attempts", sign)
+		switch result.Status {
+		case "correct":
+			delta.add(result.Qno, "correct", sign)
+			delta.add(result.Qno, "cbs_"+score, sign)
+		case "skipped":
+			delta.add(result.Qno, "skipped", sign)
+		}
+		for _, letter := range resultOptionLetters(result, quiz.Questions[result.Qno-1]) {
+			delta.add(result.Qno, "opt_"+letter, sign)
+		}
+		if result.TimeSpentSec != nil {
+			delta.add(result.Qno, "timed", sign)
+			delta.add(result.Qno, "tm_"+strconv.Itoa(timeBucket(*result.TimeSpentSec)), sign)
+		}
+	}
+}
+
+// timeBucket returns the start of the histogram bucket a time falls in
+func timeBucket(seconds int) int {
+	return min(seconds/timeBucketSec*timeBucketSec, maxTimeBucketSec)
+}
+
+// medianTimeSec estimates the median time on a question from its histogram,
+// using bucket midpoints. It is nil when no time was reported.
+func medianTimeSec(counters map[string]int) *float64 {
+	timed := counters["timed"]
+	if timed <= 0 {
+		return nil
+	}
+
+	buckets := []int{}
+	for name := range counters {
+		if bucket, err := strconv.Atoi(strings.TrimPrefix(name, "tm_")); err == nil && strings.HasPrefix(name, "tm_") {
+			buckets = append(buckets, bucket)
+		}
+	}
+	sort.Ints(buckets)
+
+	seen := 0
+	for _, bucket := range buckets {
+		seen += counters["tm_"+strconv.Itoa(bucket)]
+		if seen*2 >= timed {
+			median := float64(bucket)
+			if bucket < maxTimeBucketSec {
+				median += timeBucketSec / 2.0
+			}
+			return &median
+		}
+	}
+	return nil
+}
+
+// MarkAttemptStatsRecorded flags a saved attempt as counted in the item
+// statistics, unless it has since been replaced by a newer attempt
+func MarkAttemptStatsRecorded(attempt AttemptItem) error {
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("student_quiz_attempts_v2"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid":       {S: aws.String(attempt.UID)},
+			"quiz_name": {S: aws.String(attempt.QuizName)},
+		},
+		UpdateExpression:    aws.String("SET stats_recorded = :true"),
+		ConditionExpression: aws.String("attempted_at = :attemptedAt"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":true":        {BOOL: aws.Bool(true)},
+			":attemptedAt": {S: aws.String(attempt.AttemptedAt)},
+		},
+	})
+	if isConditionFailure(err) {
+		return nil
+	}
+	return err
+}
+
+// UpdateItemStats applies a new attempt to the quiz's item statistics,
+// replacing the contribution of the student's previous attempt if it was counted
+func UpdateItemStats(tenantID string, quiz *QuizItem, previous *AttemptItem, current AttemptItem) error {
+	delta := itemStatsDelta{}
+	if previous != nil && previous.StatsRecorded {
+		addAttemptToItemStats(delta, quiz, previous.Results, previous.CorrectCount, -1)
+	}
+	addAttemptToItemStats(delta, quiz, current.Results, current.CorrectCount, 1)
+
+	quizKey := scopedKey(tenantID, quiz.QuizName)
+	for qno, counters := range delta {
+		names := map[string]*string{}
+		values := map[string]*dynamodb.AttributeValue{}
+		adds := []string{}
+		i := 0
+		for counter, value := range counters {
+			if value == 0 {
+				continue
+			}
+			names[fmt.Sprintf("#c%d", i)] = aws.String(counter)
+			values[fmt.Sprintf(":v%d", i)] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(value))}
+			adds = append(adds, fmt.Sprintf("#c%d :v%d", i, i))
+			i++
+		}
+		if len(adds) == 0 {
+			continue
+		}
+
+		_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("quiz_item_stats"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"quiz_name": {S: aws.String(quizKey)},
+				"qno":       {N: aws.String(strconv.Itoa(qno))},
+			},
+			UpdateExpression:          aws.String("ADD " + strings.Join(adds, ", ")),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FetchItemStats returns the counters of every row of a quiz keyed by qno
+func FetchItemStats(tenantID, quizName string) (map[int]map[string]int, error) {
+	stats := make(map[int]map[string]int)
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("quiz_item_stats"),
+		KeyConditionExpression: aws.String("quiz_name = :quizName"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":quizName": {S: aws.String(scopedKey(tenantID, quizName))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			qno, err := strconv.Atoi(aws.StringValue(item["qno"].N))
+			if err != nil {
+				continue
+			}
+			counters := make(map[string]int)
+			for name, value := range item {
+				if name == "qno" || value.N == nil {
+					continue
+				}
+				counters[name], _ = strconv.Atoi(*value.N)
+			}
+			stats[qno] = counters
+		}
+		return true
+	})
+	return stats, err
+}
+
+// DeleteItemStats removes all statistics of a quiz
+func DeleteItemStats(tenantID, quizName string, questionCount int) error {
+	quizKey := scopedKey(tenantID, quizName)
+	for qno := itemStatsSummaryQno; qno <= questionCount; qno++ {
+		_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("quiz_item_stats"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"quiz_name": {S: aws.String(quizKey)},
+				"qno":       {N: aws.String(strconv.Itoa(qno))},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scoreHistogram reads the sc_<score> counters of the summary row
+func scoreHistogram(summary map[string]int) map[int]int {
+	histogram := make(map[int]int)
+	for name, count := range summary {
+		if !strings.HasPrefix(name, "sc_") || count <= 0 {
+			continue
+		}
+		if score, err := strconv.Atoi(strings.TrimPrefix(name, "sc_")); err == nil {
+			histogram[score] = count
+		}
+	}
+	return histogram
+}
+
+// groupWeights returns, for the top (or bottom) share of students by score, the
+// fraction of each score bucket that falls in the group. The boundary bucket is
+// split proportionally so that ties do not inflate the group.
+func groupWeights(histogram map[int]int, groupSize float64, upper bool) map[int]float64 {
+	scores := make([]int, 0, len(histogram))
+	for score := range histogram {
+		scores = append(scores, score)
+	}
+	sort.Ints(scores)
+	if upper {
+		sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+	}
+
+	weights := make(map[int]float64)
+	remaining := groupSize
+	for _, score := range scores {
+		if remaining <= 0 {
+			break
+		}
+		count := float64(histogram[score])
+		taken := math.Min(count, remaining)
+		weights[score] = taken / count
+		remaining -= taken
+	}
+	return weights
+}
+
+// discriminationIndex is the share correct in the upper group minus the share
+// correct in the lower group
+func discriminationIndex(counters map[string]int, upper, lower map[int]float64, groupSize float64) float64 {
+	if groupSize <= 0 {
+		return 0
+	}
+	groupCorrect := func(weights map[int]float64) float64 {
+		var correct float64
+		for score, weight := range weights {
+			correct += float64(counters["cbs_"+strconv.Itoa(score)]) * weight
+		}
+		return correct / groupSize
+	}
+	return groupCorrect(upper) - groupCorrect(lower)
+}
+
+func roundTo(value float64, places int) float64 {
+	factor := math.Pow(10, float64(places))
+	return math.Round(value*factor) / factor
+}
+
+// AnalyzeItems computes item analysis for every question of a quiz
+func AnalyzeItems(quiz *QuizItem, stats map[int]map[string]int) []ItemAnalysis {
+	histogram := scoreHistogram(stats[itemStatsSummaryQno])
+	students := 0
+	for _, count := range histogram {
+		students += count
+	}
+	groupSize := math.Ceil(float64(students) * discriminationGroupShare)
+	upper := groupWeights(histogram, groupSize, true)
+	lower := groupWeights(histogram, groupSize, false)
+
+	analysis := []ItemAnalysis{}
+	for i, question := range quiz.Questions {
+		qno := i + 1
+		counters := stats[qno]
+		if counters == nil {
+			counters = map[string]int{}
+		}
+
+		item := ItemAnalysis{
+			Qno:           qno,
+			Question:      question.Question,
+			Attempts:      counters["attempts"],
+			Correct:       counters["correct"],
+			Skipped:       counters["skipped"],
+			TimedAttempts: counters["timed"],
+			MedianTimeSec: medianTimeSec(counters),
+			Options:       []OptionStat{},
+			Flags:         []string{},
+		}
+		if item.Attempts > 0 {
+			item.Difficulty = roundTo(float64(item.Correct)/float64(item.Attempts), 3)
+			item.SkipRate = roundTo(float64(item.Skipped)/float64(item.Attempts), 3)
+			item.Discrimination = roundTo(discriminationIndex(counters, upper, lower, groupSize), 3)
+		}
+		if item.Discrimination < 0 {
+			item.Flags = append(item.Flags, FlagNegativeDiscrimination)
+		}
+
+		correctLetters := strings.Split(strings.ToUpper(question.CorrectAnswer), ",")
+		for j := range correctLetters {
+			correctLetters[j] = strings.TrimSpace(correctLetters[j])
+		}
+
+		unusedDistractor := false
+		for j, text := range question.AllAnswers {
+			letter := optionLetter(j)
+			option := OptionStat{
+				Option:    letter,
+				Text:      text,
+				IsCorrect: containsString(correctLetters, letter),
+				Count:     counters["opt_"+letter],
+			}
+			if item.Attempts > 0 {
+				option.Frequency = roundTo(float64(option.Count)/float64(item.Attempts), 3)
+			}
+			if !option.IsCorrect && option.Count == 0 && item.Attempts > 0 {
+				unusedDistractor = true
+			}
+			item.Options = append(item.Options, option)
+		}
+		if unusedDistractor {
+			item.Flags = append(item.Flags, FlagUnusedDistractor)
+		}
+
+		analysis = append(analysis, item)
+	}
+	return analysis
+}
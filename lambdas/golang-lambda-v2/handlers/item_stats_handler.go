@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// HandleQuizItemAnalysis returns per-question difficulty, discrimination,
+// distractor frequencies and skip rates from the maintained item statistics
+func HandleQuizItemAnalysis(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+
+	quizName := request.QueryStringParameters["quizName"]
+	className := request.QueryStringParameters["className"]
+	subjectName := request.QueryStringParameters["subjectName"]
+	topic := request.QueryStringParameters["topic"]
+
+	if quizName == "" || className == "" || subjectName == "" || topic == "" {
+		return CreateErrorResponse(400, "Missing 'quizName', 'className', 'subjectName' or 'topic' parameter"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	quiz, err := GetQuizFromDynamoDB(tenantID, quizName, className, subjectName, topic)
+	if err != nil {
+		log.Printf("❌ Error fetching quiz: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if quiz == nil {
+		return CreateErrorResponse(404, "Quiz not found"), nil
+	}
+
+	stats, err := FetchItemStats(tenantID, quizName)
+	if err != nil {
+		log.Printf("❌ Error fetching item stats: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	items := AnalyzeItems(quiz, stats)
+	flagged := []int{}
+	for _, item := range items {
+		if len(item.Flags) > 0 {
+			flagged = append(flagged, item.Qno)
+		}
+	}
+
+	response := map[string]interface{}{
+		"quizName":         quizName,
+		"students":         stats[itemStatsSummaryQno]["attempts"],
+		"scoreHistogram":   scoreHistogram(stats[itemStatsSummaryQno]),
+		"items":            items,
+		"flaggedQuestions": flagged,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestGroupWeights(t *testing.T) {
+	histogram := map[int]int{10: 2, 5: 4, 0: 2}
+
+	tests := []struct {
+		name      string
+		groupSize float64
+		upper     bool
+		want      map[int]float64
+	}{
+		{"upper group of whole buckets", 2, true, map[int]float64{10: 1}},
+		{"lower group of whole buckets", 2, false, map[int]float64{0: 1}},
+		{"boundary bucket split", 4, true, map[int]float64{10: 1, 5: 0.5}},
+		{"everyone", 8, false, map[int]float64{0: 1, 5: 1, 10: 1}},
+		{"empty group", 0, true, map[int]float64{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := groupWeights(histogram, tt.groupSize, tt.upper)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			for score, weight := range tt.want {
+				if got[score] != weight {
+					t.Errorf("got %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDiscriminationIndex(t *testing.T) {
+	tests := []struct {
+		name      string
+		histogram map[int]int
+		// Correct answers by score bucket, as cbs_<score> counters
+		correctByScore map[int]int
+		groupSize      float64
+		want           float64
+	}{
+		{"top students right, bottom wrong", map[int]int{10: 2, 5: 2, 0: 2}, map[int]int{10: 2, 5: 1}, 2, 1},
+		{"bottom students right, top wrong", map[int]int{10: 2, 5: 2, 0: 2}, map[int]int{0: 2, 5: 1}, 2, -1},
+		{"everyone right", map[int]int{10: 2, 5: 2, 0: 2}, map[int]int{10: 2, 5: 2, 0: 2}, 2, 0},
+		{"ties shared by both groups", map[int]int{5: 4}, map[int]int{5: 2}, 2, 0},
+		{"partial boundary bucket", map[int]int{10: 1, 5: 2, 0: 1}, map[int]int{10: 1, 5: 1}, 2, 0.5},
+		{"no students", map[int]int{}, map[int]int{}, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counters := map[string]int{}
+			for score, count := range tt.correctByScore {
+				counters["cbs_"+strconv.Itoa(score)] = count
+			}
+			upper := groupWeights(tt.histogram, tt.groupSize, true)
+			lower := groupWeights(tt.histogram, tt.groupSize, false)
+			if got := discriminationIndex(counters, upper, lower, tt.groupSize); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Leaderboard periods for class/subject and topic boards
+const (
+	LeaderboardWeekly  = "weekly"
+	LeaderboardMonthly = "monthly"
+)
+
+// Window boards are kept for a year after they were last written
+const leaderboardWindowRetention = 365 * 24 * time.Hour
+
+// Leaderboard entry structure, one per board and student. Quiz boards hold the
+// best percentage; window boards hold the sum of the best percentage of each
+// quiz attempted in the window (quiz_scores).
+type LeaderboardEntry struct {
+	BoardID     string             `json:"board_id" dynamodbav:"board_id"`
+	UID         string             `json:"uid" dynamodbav:"uid"`
+	Name        string             `json:"name" dynamodbav:"name"`
+	Score       float64            `json:"score" dynamodbav:"score"`
+	QuizScores  map[string]float64 `json:"quiz_scores,omitempty" dynamodbav:"quiz_scores,omitempty"`
+	AttemptedAt string             `json:"attempted_at" dynamodbav:"attempted_at"`
+	ExpiresAt   int64              `json:"expires_at,omitempty" dynamodbav:"expires_at,omitempty"`
+}
+
+// quizBoardID is the board of a single quiz
+func quizBoardID(tenantID, quizName string) string {
+	return scopedKey(tenantID, "quiz#"+quizName)
+}
+
+// leaderboardWindow names the week (2006-W01) or month (2006-01) containing t
+func leaderboardWindow(period string, t time.Time) string {
+	t = t.UTC()
+	if period == LeaderboardMonthly {
+		return t.Format("2006-01")
+	}
+	year, week := t.ISOWeek()
+	return fmt.Sprintf("%d-W%02d", year, week)
+}
+
+// classBoardID is the board of a class and subject over a week or month
+func classBoardID(tenantID, className, subjectName, period, window string) string {
+	return scopedKey(tenantID, fmt.Sprintf("class#%s#%s#%s#%s", className, subjectName, period, window))
+}
+
+// topicBoardID is the board of a topic of a class and subject over a week or month
+func topicBoardID(tenantID, className, subjectName, topic, period, window string) string {
+	return scopedKey(tenantID, fmt.Sprintf("topic#%s#%s#%s#%s#%s", className, subjectName, topic, period, window))
+}
+
+// windowBoardIDs returns the weekly and monthly boards of an attempt's class
+// and subject, and of its topic when it has one, for the windows containing t
+func windowBoardIDs(tenantID string, attempt AttemptItem, t time.Time) []string {
+	boardIDs := []string{}
+	for _, period := range []string{LeaderboardWeekly, LeaderboardMonthly} {
+		window := leaderboardWindow(period, t)
+		boardIDs = append(boardIDs, classBoardID(tenantID, attempt.ClassName, attempt.Category, period, window))
+		if attempt.Topic != "" {
+			boardIDs = append(boardIDs, topicBoardID(tenantID, attempt.ClassName, attempt.Category, attempt.Topic, period, window))
+		}
+	}
+	return boardIDs
+}
+
+// UpdateLeaderboards records an attempt on the quiz board and the current
+// weekly and monthly boards of its class and subject and of its topic
+func UpdateLeaderboards(tenantID string, student *StudentInfoItem, attempt AttemptItem, now time.Time) error {
+	if student.LeaderboardOptOut {
+		return nil
+	}
+	percentage := attemptPercentage(attempt)
+
+	boardIDs := []string{quizBoardID(tenantID, attempt.QuizName)}
+	if err := recordBestScore(boardIDs[0], student, percentage, attempt.AttemptedAt); err != nil {
+		return err
+	}
+
+	for _, boardID := range windowBoardIDs(tenantID, attempt, now) {
+		if err := recordWindowScore(boardID, student, attempt.QuizName, percentage, attempt.AttemptedAt, now); err != nil {
+			return err
+		}
+		boardIDs = append(boardIDs, boardID)
+	}
+	return trackLeaderboards(student.UID, boardIDs)
+}
+
+// trackLeaderboards adds boards to the student's leaderboard_boards set
+func trackLeaderboards(uid string, boardIDs []string) error {
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("students_info"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {S: aws.String(uid)},
+		},
+		UpdateExpression:    aws.String("ADD leaderboard_boards :boards"),
+		ConditionExpression: aws.String("attribute_exists(uid)"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":boards": {SS: aws.StringSlice(boardIDs)},
+		},
+	})
+	if isConditionFailure(err) {
+		return nil
+	}
+	return err
+}
+
+// SetLeaderboardOptOut sets only the student's opt-out flag, so that boards
+// tracked by concurrent submissions are kept
+func SetLeaderboardOptOut(tenantID, uid string, optOut bool) error {
+	values := map[string]*dynamodb.AttributeValue{
+		":optOut": {BOOL: aws.Bool(optOut)},
+	}
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("students_info"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid": {S: aws.String(uid)},
+		},
+		UpdateExpression:          aws.String("SET leaderboard_opt_out = :optOut"),
+		ConditionExpression:       aws.String("attribute_exists(uid) AND " + tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	})
+	return err
+}
+
+// optedOutStudents returns which of the given students opted out of
+// leaderboards. Entries written before boards were tracked can outlive an
+// opt-out, so boards are filtered when read as well.
+func optedOutStudents(uids []string) (map[string]bool, error) {
+	optedOut := make(map[string]bool)
+	for start := 0; start < len(uids); start += bankBatchGetSize {
+		end := min(start+bankBatchGetSize, len(uids))
+
+		seen := make(map[string]bool)
+		keys := []map[string]*dynamodb.AttributeValue{}
+		for _, uid := range uids[start:end] {
+			if seen[uid] {
+				continue
+			}
+			seen[uid] = true
+			keys = append(keys, map[string]*dynamodb.AttributeValue{
+				"uid": {S: aws.String(uid)},
+			})
+		}
+
+		requests := map[string]*dynamodb.KeysAndAttributes{
+			"students_info": {
+				Keys:                 keys,
+				ProjectionExpression: aws.String("uid, leaderboard_opt_out"),
+			},
+		}
+		for len(keys) > 0 && len(requests) > 0 {
+			result, err := dynamoClient.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: requests})
+			if err != nil {
+				return nil, err
+			}
+
+			var items []StudentInfoItem
+			if err := dynamodbattribute.UnmarshalListOfMaps(result.Responses["students_info"], &items); err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if item.LeaderboardOptOut {
+					optedOut[item.UID] = true
+				}
+			}
+			requests = result.UnprocessedKeys
+		}
+	}
+	return optedOut, nil
+}
+
+// recordBestScore keeps the student's best score on a board
+func recordBestScore(boardID string, student *StudentInfoItem, score float64, attemptedAt string) error {
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("leaderboards"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"board_id": {S: aws.String(boardID)},
+			"uid":      {S: aws.String(student.UID)},
+		},
+		UpdateExpression:    aws.String("SET score = :score, #name = :name, attempted_at = :attemptedAt"),
+		ConditionExpression: aws.String("attribute_not_exists(score) OR score < :score"),
+		ExpressionAttributeNames: map[string]*string{
+			"#name": aws.String("name"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":score":       {N: aws.String(formatNumber(score))},
+			":name":        {S: aws.String(student.Name)},
+			":attemptedAt": {S: aws.String(attemptedAt)},
+		},
+	})
+	if isConditionFailure(err) {
+		// Not an improvement
+		return nil
+	}
+	return err
+}
+
+// Attempts at a conditional window board write before giving up
+const leaderboardWriteAttempts = 3
+
+var errLeaderboardConflict = errors.New("leaderboard entry changed concurrently")
+
+// recordWindowScore raises the student's score for a quiz within a window board.
+// The write is conditional on the quiz score read, so concurrent submissions
+// cannot double count; conflicting writes are retried from the new state.
+func recordWindowScore(boardID string, student *StudentInfoItem, quizName string, score float64, attemptedAt string, now time.Time) error {
+	var err error
+	for i := 0; i < leaderboardWriteAttempts; i++ {
+		err = writeWindowScore(boardID, student, quizName, score, attemptedAt, now)
+		if !errors.Is(err, errLeaderboardConflict) {
+			return err
+		}
+	}
+	return err
+}
+
+func writeWindowScore(boardID string, student *StudentInfoItem, quizName string, score float64, attemptedAt string, now time.Time) error {
+	entry, err := getLeaderboardEntry(boardID, student.UID)
+	if err != nil {
+		return err
+	}
+	expiresAt := now.Add(leaderboardWindowRetention).Unix()
+
+	if entry == nil {
+		av, err := dynamodbattribute.MarshalMap(LeaderboardEntry{
+			BoardID:     boardID,
+			UID:         student.UID,
+			Name:        student.Name,
+			Score:       score,
+			QuizScores:  map[string]float64{quizName: score},
+			AttemptedAt: attemptedAt,
+			ExpiresAt:   expiresAt,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+			TableName:           aws.String("leaderboards"),
+			Item:                av,
+			ConditionExpression: aws.String("attribute_not_exists(uid)"),
+		})
+		if isConditionFailure(err) {
+			return errLeaderboardConflict
+		}
+		return err
+	}
+
+	previous, seen := entry.QuizScores[quizName]
+	if seen && previous >= score {
+		return nil
+	}
+
+	values := map[string]*dynamodb.AttributeValue{
+		":score":       {N: aws.String(formatNumber(score))},
+		":delta":       {N: aws.String(formatNumber(score - previous))},
+		":name":        {S: aws.String(student.Name)},
+		":attemptedAt": {S: aws.String(attemptedAt)},
+		":expiresAt":   {N: aws.String(strconv.FormatInt(expiresAt, 10))},
+	}
+	condition := "attribute_not_exists(quiz_scores.#quiz)"
+	if seen {
+		condition = "quiz_scores.#quiz = :previous"
+		values[":previous"] = &dynamodb.AttributeValue{N: aws.String(formatNumber(previous))}
+	}
+
+	_, err = dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("leaderboards"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"board_id": {S: aws.String(boardID)},
+			"uid":      {S: aws.String(student.UID)},
+		},
+		UpdateExpression: aws.String("SET quiz_scores.#quiz = :score, score = score + :delta, " +
+			"#name = :name, attempted_at = :attemptedAt, expires_at = :expiresAt"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]*string{
+			"#quiz": aws.String(quizName),
+			"#name": aws.String("name"),
+		},
+		ExpressionAttributeValues: values,
+	})
+	if isConditionFailure(err) {
+		return errLeaderboardConflict
+	}
+	return err
+}
+
+func getLeaderboardEntry(boardID, uid string) (*LeaderboardEntry, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("leaderboards"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"board_id": {S: aws.String(boardID)},
+			"uid":      {S: aws.String(uid)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var entry LeaderboardEntry
+	err = dynamodbattribute.UnmarshalMap(result.Item, &entry)
+	return &entry, err
+}
+
+// FetchLeaderboardTop returns the highest scores of a board, leaving out
+// students who opted out. Pages are read until limit entries are left or the
+// board is exhausted.
+func FetchLeaderboardTop(boardID string, limit int) ([]LeaderboardEntry, error) {
+	entries := []LeaderboardEntry{}
+	var pageErr error
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("leaderboards"),
+		IndexName:              aws.String("board-score-index"),
+		KeyConditionExpression: aws.String("board_id = :boardId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":boardId": {S: aws.String(boardID)},
+		},
+		ScanIndexForward: aws.Bool(false),
+		Limit:            aws.Int64(int64(limit)),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var pageEntries []LeaderboardEntry
+		if pageErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageEntries); pageErr != nil {
+			return false
+		}
+
+		uids := []string{}
+		for _, entry := range pageEntries {
+			uids = append(uids, entry.UID)
+		}
+		var optedOut map[string]bool
+		if optedOut, pageErr = optedOutStudents(uids); pageErr != nil {
+			return false
+		}
+		for _, entry := range pageEntries {
+			if !optedOut[entry.UID] {
+				entries = append(entries, entry)
+			}
+		}
+		return len(entries) < limit
+	})
+	if err != nil {
+		return nil, err
+	}
+	if pageErr != nil {
+		return nil, pageErr
+	}
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+// countLeaderboard counts the entries of a board, or only those scoring above
+// minScore when it is given
+func countLeaderboard(boardID string, minScore *float64) (int, error) {
+	input := &dynamodb.QueryInput{
+		TableName:              aws.String("leaderboards"),
+		IndexName:              aws.String("board-score-index"),
+		KeyConditionExpression: aws.String("board_id = :boardId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":boardId": {S: aws.String(boardID)},
+		},
+		Select: aws.String("COUNT"),
+	}
+	if minScore != nil {
+		input.KeyConditionExpression = aws.String("board_id = :boardId AND score > :score")
+		input.ExpressionAttributeValues[":score"] = &dynamodb.AttributeValue{N: aws.String(formatNumber(*minScore))}
+	}
+
+	count := 0
+	err := dynamoClient.QueryPages(input, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		count += int(aws.Int64Value(page.Count))
+		return true
+	})
+	return count, err
+}
+
+// LeaderboardRank returns the caller's entry, rank (1 = best, ties share a rank)
+// and the number of students on the board. The entry is nil when the student
+// has no score on the board.
+func LeaderboardRank(boardID, uid string) (*LeaderboardEntry, int, int, error) {
+	total, err := countLeaderboard(boardID, nil)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	entry, err := getLeaderboardEntry(boardID, uid)
+	if err != nil || entry == nil {
+		return nil, 0, total, err
+	}
+
+	above, err := countLeaderboard(boardID, &entry.Score)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return entry, above + 1, total, nil
+}
+
+// leaderboardPercentile is the share of a board's students ranked at or below
+// rank, so that the top and a sole student are at 100
+func leaderboardPercentile(rank, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return roundTo(float64(total-rank+1)/float64(total)*100, 1)
+}
+
+// RemoveFromLeaderboards deletes a student's entries from the given boards
+func RemoveFromLeaderboards(boardIDs []string, uid string) error {
+	for _, boardID := range boardIDs {
+		_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("leaderboards"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"board_id": {S: aws.String(boardID)},
+				"uid":      {S: aws.String(uid)},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// studentLeaderboardIDs lists the boards a student appears on: those tracked
+// on the student plus, for entries written before tracking, the quiz boards of
+// their attempts and the current class/subject and topic windows
+func studentLeaderboardIDs(tenantID string, student *StudentInfoItem, attempts []AttemptItem, now time.Time) []string {
+	boardIDs := append([]string{}, student.LeaderboardBoards...)
+	seen := make(map[string]bool)
+	for _, attempt := range attempts {
+		boardIDs = append(boardIDs, quizBoardID(tenantID, attempt.QuizName))
+		for _, boardID := range windowBoardIDs(tenantID, attempt, now) {
+			if !seen[boardID] {
+				seen[boardID] = true
+				boardIDs = append(boardIDs, boardID)
+			}
+		}
+	}
+	return boardIDs
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultLeaderboardLimit = 10
+	maxLeaderboardLimit     = 100
+)
+
+type LeaderboardOptOutRequest struct {
+	OptOut bool `json:"optOut"`
+}
+
+type LeaderboardRow struct {
+	Rank        int     `json:"rank"`
+	UID         string  `json:"uid"`
+	Name        string  `json:"name"`
+	Score       float64 `json:"score"`
+	AttemptedAt string  `json:"attemptedAt"`
+	IsCaller    bool    `json:"isCaller"`
+}
+
+// HandleLeaderboard returns the top N of a board plus the caller's rank and
+// percentile.
+//
+//	?type=quiz&quizName=...
+//	?type=class&subjectName=...&period=weekly|monthly[&window=2026-W42|2026-10]
+//	?type=topic&subjectName=...&topic=...&period=weekly|monthly[&window=...]
+//
+// Class and topic boards are always those of the caller's class.
+func HandleLeaderboard(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	params := request.QueryStringParameters
+	limit := defaultLeaderboardLimit
+	if limitStr := params["limit"]; limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxLeaderboardLimit {
+			return CreateErrorResponse(400, "'limit' must be between 1 and 100"), nil
+		}
+	}
+
+	var boardID string
+	board := map[string]interface{}{"type": params["type"]}
+	switch params["type"] {
+	case "quiz":
+		if params["quizName"] == "" {
+			return CreateErrorResponse(400, "Missing 'quizName' parameter"), nil
+		}
+		boardID = quizBoardID(tenantID, params["quizName"])
+		board["quizName"] = params["quizName"]
+	case "class", "topic":
+		period := params["period"]
+		if period == "" {
+			period = LeaderboardWeekly
+		}
+		if period != LeaderboardWeekly && period != LeaderboardMonthly {
+			return CreateErrorResponse(400, "'period' must be 'weekly' or 'monthly'"), nil
+		}
+		if params["subjectName"] == "" {
+			return CreateErrorResponse(400, "Missing 'subjectName' parameter"), nil
+		}
+		window := params["window"]
+		if window == "" {
+			window = leaderboardWindow(period, time.Now())
+		}
+		if params["type"] == "topic" {
+			if params["topic"] == "" {
+				return CreateErrorResponse(400, "Missing 'topic' parameter"), nil
+			}
+			boardID = topicBoardID(tenantID, student.StudentClass, params["subjectName"], params["topic"], period, window)
+			board["topic"] = params["topic"]
+		} else {
+			boardID = classBoardID(tenantID, student.StudentClass, params["subjectName"], period, window)
+		}
+		board["className"] = student.StudentClass
+		board["subjectName"] = params["subjectName"]
+		board["period"] = period
+		board["window"] = window
+	default:
+		return CreateErrorResponse(400, "'type' must be 'quiz', 'class' or 'topic'"), nil
+	}
+
+	entries, err := FetchLeaderboardTop(boardID, limit)
+	if err != nil {
+		log.Printf("❌ Error fetching leaderboard: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	// Competition ranking: equal scores share a rank
+	rows := []LeaderboardRow{}
+	for i, entry := range entries {
+		rank := i + 1
+		if i > 0 && entry.Score == entries[i-1].Score {
+			rank = rows[i-1].Rank
+		}
+		rows = append(rows, LeaderboardRow{
+			Rank:        rank,
+			UID:         entry.UID,
+			Name:        entry.Name,
+			Score:       entry.Score,
+			AttemptedAt: entry.AttemptedAt,
+			IsCaller:    entry.UID == uid,
+		})
+	}
+
+	callerEntry, rank, total, err := LeaderboardRank(boardID, uid)
+	if err != nil {
+		log.Printf("❌ Error ranking caller: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var caller map[string]interface{}
+	if callerEntry != nil {
+		caller = map[string]interface{}{
+			"rank":       rank,
+			"score":      callerEntry.Score,
+			"percentile": leaderboardPercentile(rank, total),
+		}
+	}
+
+	response := map[string]interface{}{
+		"board":         board,
+		"top":           rows,
+		"totalStudents": total,
+		"caller":        caller,
+		"optedOut":      student.LeaderboardOptOut,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleLeaderboardOptOut lets a student hide from leaderboards. Opting out
+// removes the student from every board they were written to, including past
+// weekly and monthly windows.
+func HandleLeaderboardOptOut(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req LeaderboardOptOutRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	if err := SetLeaderboardOptOut(tenantID, uid, req.OptOut); err != nil {
+		log.Printf("❌ Error updating student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student.LeaderboardOptOut = req.OptOut
+
+	if req.OptOut {
+		attempts, err := GetStudentAttempts(tenantID, uid)
+		if err == nil {
+			err = RemoveFromLeaderboards(studentLeaderboardIDs(tenantID, student, attempts, time.Now()), uid)
+		}
+		if err != nil {
+			log.Printf("⚠️ Error removing %s from leaderboards: %v", uid, err)
+		}
+	}
+
+	response := map[string]interface{}{
+		"message": "Leaderboard preference updated",
+		"optOut":  student.LeaderboardOptOut,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Default half-life for recency weighting of attempts in topic mastery
+const defaultMasteryHalfLifeDays = 30
+
+// Number of topics reported as weakest and strongest per subject
+const masteryTopicListSize = 3
+
+type TopicMastery struct {
+	Topic           string   `json:"topic"`
+	Mastery         *float64 `json:"mastery"` // nil until the topic has been attempted
+	Attempted       int      `json:"attempted"`
+	TotalQuizzes    int      `json:"totalQuizzes"`
+	LastAttemptedAt string   `json:"lastAttemptedAt,omitempty"`
+	Listed          bool     `json:"listed"` // topic is listed in the taxonomy
+}
+
+// getMasteryHalfLife reads MASTERY_HALF_LIFE_DAYS
+func getMasteryHalfLife() float64 {
+	days, err := strconv.ParseFloat(os.Getenv("MASTERY_HALF_LIFE_DAYS"), 64)
+	if err != nil || days <= 0 {
+		return defaultMasteryHalfLifeDays
+	}
+	return days
+}
+
+// recencyWeight halves an attempt's weight every half-life days
+func recencyWeight(attemptedAt string, now time.Time, halfLifeDays float64) float64 {
+	at, ok := parseSubExpDate(attemptedAt)
+	if !ok {
+		return 0.5 // undated attempts count as one half-life old
+	}
+	ageDays := math.Max(now.Sub(at).Hours()/24, 0)
+	return math.Pow(0.5, ageDays/halfLifeDays)
+}
+
+// ComputeTopicMastery builds the topic breakdown for one subject. Mastery is the
+// recency-weighted average percentage of every attempt in the topic, retakes
+// included; Attempted counts the distinct quizzes attempted. Listed topics come first in taxonomy order; topics only seen in
+// quizzes or attempts follow.
+func ComputeTopicMastery(listedTopics []string, quizzes []QuizItem, attempts []AttemptItem, now time.Time) []TopicMastery {
+	halfLife := getMasteryHalfLife()
+
+	order := []string{}
+	byTopic := make(map[string]*TopicMastery)
+	ensure := func(topic string, listed bool) *TopicMastery {
+		if byTopic[topic] == nil {
+			byTopic[topic] = &TopicMastery{Topic: topic, Listed: listed}
+			order = append(order, topic)
+		}
+		return byTopic[topic]
+	}
+
+	for _, topic := range listedTopics {
+		ensure(topic, true)
+	}
+	for _, quiz := range quizzes {
+		ensure(quiz.Topic, false).TotalQuizzes++
+	}
+
+	weightedSum := make(map[string]float64)
+	weightTotal := make(map[string]float64)
+	attemptedQuizzes := make(map[string]bool)
+	for _, attempt := range attempts {
+		if attempt.Topic == "" {
+			continue
+		}
+		topic := ensure(attempt.Topic, false)
+		if !attemptedQuizzes[attempt.QuizName] {
+			attemptedQuizzes[attempt.QuizName] = true
+			topic.Attempted++
+		}
+		if attempt.AttemptedAt > topic.LastAttemptedAt {
+			topic.LastAttemptedAt = attempt.AttemptedAt
+		}
+
+		weight := recencyWeight(attempt.AttemptedAt, now, halfLife)
+		weightedSum[attempt.Topic] += weight * attemptPercentage(attempt)
+		weightTotal[attempt.Topic] += weight
+	}
+
+	breakdown := []TopicMastery{}
+	for _, name := range order {
+		topic := byTopic[name]
+		if weightTotal[name] > 0 {
+			mastery := roundTo(weightedSum[name]/weightTotal[name], 1)
+			topic.Mastery = &mastery
+		}
+		breakdown = append(breakdown, *topic)
+	}
+	return breakdown
+}
+
+// WeakestAndStrongestTopics returns up to masteryTopicListSize attempted topics
+// from each end of the mastery ranking. The lists never overlap.
+func WeakestAndStrongestTopics(breakdown []TopicMastery) ([]string, []string) {
+	attempted := []TopicMastery{}
+	for _, topic := range breakdown {
+		if topic.Mastery != nil {
+			attempted = append(attempted, topic)
+		}
+	}
+	sort.SliceStable(attempted, func(i, j int) bool {
+		return *attempted[i].Mastery < *attempted[j].Mastery
+	})
+
+	size := len(attempted) / 2
+	if size > masteryTopicListSize {
+		size = masteryTopicListSize
+	}
+
+	weakest := []string{}
+	strongest := []string{}
+	for i := 0; i < size; i++ {
+		weakest = append(weakest, attempted[i].Topic)
+		strongest = append(strongest, attempted[len(attempted)-1-i].Topic)
+	}
+	return weakest, strongest
+}
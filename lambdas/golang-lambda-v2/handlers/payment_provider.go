@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Order created with the payment provider before checkout
+type PaymentOrder struct {
+	OrderID  string            `json:"id"`
+	Amount   int64             `json:"amount"`
+	Currency string            `json:"currency"`
+	Receipt  string            `json:"receipt"`
+	Status   string            `json:"status"`
+	Notes    map[string]string `json:"notes"`
+}
+
+// PaymentProvider is implemented by Razorpay and by the local fake provider
+type PaymentProvider interface {
+	Name() string
+	KeyID() string
+	CreateOrder(amount int64, currency, receipt string, notes map[string]string) (*PaymentOrder, error)
+	VerifyWebhookSignature(body []byte, signature string) bool
+}
+
+// Razorpay-style webhook event
+type PaymentWebhookEvent struct {
+	Event   string `json:"event"`
+	Payload struct {
+		Payment struct {
+			Entity PaymentEntity `json:"entity"`
+		} `json:"payment"`
+		Order struct {
+			Entity PaymentOrder `json:"entity"`
+		} `json:"order"`
+	} `json:"payload"`
+}
+
+type PaymentEntity struct {
+	ID       string            `json:"id"`
+	OrderID  string            `json:"order_id"`
+	Amount   int64             `json:"amount"`
+	Currency string            `json:"currency"`
+	Status   string            `json:"status"`
+	Notes    map[string]string `json:"notes"`
+}
+
+// signWebhookBody returns the hex HMAC-SHA256 of body, as sent in X-Razorpay-Signature
+func signWebhookBody(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func verifyWebhookBody(body []byte, signature, secret string) bool {
+	if secret == "" || signature == "" {
+		return false
+	}
+	expected := signWebhookBody(body, secret)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
+
+// RazorpayProvider talks to the Razorpay orders API
+type RazorpayProvider struct {
+	keyID         string
+	keySecret     string
+	webhookSecret string
+	baseURL       string
+	httpClient    *http.Client
+}
+
+func NewRazorpayProvider(keyID, keySecret, webhookSecret string) *RazorpayProvider {
+	return &RazorpayProvider{
+		keyID:         keyID,
+		keySecret:     keySecret,
+		webhookSecret: webhookSecret,
+		baseURL:       "https://api.razorpay.com/v1",
+		httpClient:    &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *RazorpayProvider) Name() string  { return "razorpay" }
+func (p *RazorpayProvider) KeyID() string { return p.keyID }
+
+func (p *RazorpayProvider) CreateOrder(amount int64, currency, receipt string, notes map[string]string) (*PaymentOrder, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"amount":   amount,
+		"currency": currency,
+		"receipt":  receipt,
+		"notes":    notes,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", p.baseURL+"/orders", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(p.keyID, p.keySecret)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("razorpay order creation failed: %d %s", resp.StatusCode, string(respBody))
+	}
+
+	var order PaymentOrder
+	err = json.Unmarshal(respBody, &order)
+	return &order, err
+}
+
+func (p *RazorpayProvider) VerifyWebhookSignature(body []byte, signature string) bool {
+	return verifyWebhookBody(body, signature, p.webhookSecret)
+}
+
+// FakePaymentProvider creates orders locally and signs webhook payloads with the
+// same scheme as Razorpay, for local runs and tests without the real gateway.
+type FakePaymentProvider struct {
+	WebhookSecret string
+
+	mu      sync.Mutex
+	counter int
+}
+
+func NewFakePaymentProvider(webhookSecret string) *FakePaymentProvider {
+	return &FakePaymentProvider{WebhookSecret: webhookSecret}
+}
+
+func (p *FakePaymentProvider) Name() string  { return "fake" }
+func (p *FakePaymentProvider) KeyID() string { return "rzp_test_fake" }
+
+func (p *FakePaymentProvider) CreateOrder(amount int64, currency, receipt string, notes map[string]string) (*PaymentOrder, error) {
+	p.mu.Lock()
+	p.counter++
+	id := fmt.Sprintf("order_fake_%d_%d", time.Now().UnixNano(), p.counter)
+	p.mu.Unlock()
+
+	return &PaymentOrder{
+		OrderID:  id,
+		Amount:   amount,
+		Currency: currency,
+		Receipt:  receipt,
+		Status:   "created",
+		Notes:    notes,
+	}, nil
+}
+
+func (p *FakePaymentProvider) VerifyWebhookSignature(body []byte, signature string) bool {
+	return verifyWebhookBody(body, signature, p.WebhookSecret)
+}
+
+// CapturePayment builds a signed payment.captured webhook body for an order,
+// returning the body and the X-Razorpay-Signature header value.
+func (p *FakePaymentProvider) CapturePayment(order *PaymentOrder, paymentID string) ([]byte, string, error) {
+	var event PaymentWebhookEvent
+	event.Event = "payment.captured"
+	event.Payload.Payment.Entity = PaymentEntity{
+		ID:       paymentID,
+		OrderID:  order.OrderID,
+		Amount:   order.Amount,
+		Currency: order.Currency,
+		Status:   "captured",
+		Notes:    order.Notes,
+	}
+
+	body, err := json.Marshal(event)
+	if err != nil {
+		return nil, "", err
+	}
+	return body, signWebhookBody(body, p.WebhookSecret), nil
+}
+
+var (
+	paymentProvider     PaymentProvider
+	paymentProviderOnce sync.Once
+)
+
+// GetPaymentProvider picks the provider from PAYMENT_PROVIDER (razorpay or fake)
+func GetPaymentProvider() PaymentProvider {
+	paymentProviderOnce.Do(func() {
+		webhookSecret := os.Getenv("PAYMENT_WEBHOOK_SECRET")
+		if os.Getenv("PAYMENT_PROVIDER") == "fake" {
+			paymentProvider = NewFakePaymentProvider(webhookSecret)
+			return
+		}
+		paymentProvider = NewRazorpayProvider(os.Getenv("RAZORPAY_KEY_ID"), os.Getenv("RAZORPAY_KEY_SECRET"), webhookSecret)
+	})
+	return paymentProvider
+}
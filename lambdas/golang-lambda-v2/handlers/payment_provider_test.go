@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	body := []byte(`{"event":"payment.captured"}`)
+	signature := signWebhookBody(body, "secret")
+
+	tests := []struct {
+		name      string
+		body      []byte
+		signature string
+		secret    string
+		want      bool
+	}{
+		{"valid", body, signature, "secret", true},
+		{"tampered body", []byte(`{"event":"payment.failed"}`), signature, "secret", false},
+		{"wrong secret", body, signature, "other", false},
+		{"upper-case hex", body, toUpperHex(signature), "secret", false},
+		{"missing signature", body, "", "secret", false},
+		{"no secret configured", body, signWebhookBody(body, ""), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewRazorpayProvider("key", "key-secret", tt.secret).VerifyWebhookSignature(tt.body, tt.signature); got != tt.want {
+				t.Errorf("razorpay: got %v, want %v", got, tt.want)
+			}
+			if got := NewFakePaymentProvider(tt.secret).VerifyWebhookSignature(tt.body, tt.signature); got != tt.want {
+				t.Errorf("fake: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func toUpperHex(s string) string {
+	upper := []byte(s)
+	for i, c := range upper {
+		if c >= 'a' && c <= 'f' {
+			upper[i] = c - 'a' + 'A'
+		}
+	}
+	return string(upper)
+}
+
+func TestFakeCapturePayment(t *testing.T) {
+	provider := NewFakePaymentProvider("secret")
+	order, err := provider.CreateOrder(49900, "INR", "receipt", map[string]string{"plan_id": "p1"})
+	if err != nil {
+		t.Fatalf("creating order: %v", err)
+	}
+
+	body, signature, err := provider.CapturePayment(order, "pay_1")
+	if err != nil {
+		t.Fatalf("capturing payment: %v", err)
+	}
+	if !provider.VerifyWebhookSignature(body, signature) {
+		t.Errorf("own signature rejected")
+	}
+	if NewFakePaymentProvider("other").VerifyWebhookSignature(body, signature) {
+		t.Errorf("signature accepted with another secret")
+	}
+
+	var event PaymentWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		t.Fatalf("decoding event: %v", err)
+	}
+	payment := event.Payload.Payment.Entity
+	if event.Event != "payment.captured" || payment.OrderID != order.OrderID || payment.Amount != 49900 || payment.Notes["plan_id"] != "p1" {
+		t.Errorf("got event %+v", event)
+	}
+}
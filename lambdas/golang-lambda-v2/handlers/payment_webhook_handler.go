@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type PaymentOrderRequest struct {
+	PlanID     string `json:"planId"`
+	CouponCode string `json:"couponCode,omitempty"`
+}
+
+// HandlePaymentOrderCreate creates a provider order for the caller and a plan,
+// applying a coupon when one is given. The coupon is recorded on the order and
+// only redeemed once the webhook reports the payment captured, so abandoned or
+// failed checkouts do not use it up. If parallel orders use it up first, the
+// captured payment is flagged for a refund instead.
+func HandlePaymentOrderCreate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req PaymentOrderRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.PlanID == "" {
+		return CreateErrorResponse(400, "Missing 'planId' parameter"), nil
+	}
+
+	plan, err := GetPlanByID(req.PlanID)
+	if err != nil {
+		log.Printf("❌ Error fetching plan: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if plan == nil || !plan.Active {
+		return CreateErrorResponse(404, "Plan not found"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	now := time.Now()
+	receipt := fmt.Sprintf("rcpt_%d", now.UnixNano())
+	price := plan.Price
+
+	var quote *CouponQuote
+	if req.CouponCode != "" {
+		quote, err = QuoteCoupon(req.CouponCode, plan, student.StudentClass, now)
+		if err != nil {
+			return couponErrorResponse(err), nil
+		}
+		price = quote.FinalPrice
+	}
+
+	// Fully discounted plans are activated without going through the provider
+	if price <= 0 {
+		var couponWrites []*dynamodb.TransactWriteItem
+		payment := PaymentItem{
+			PaymentID:  "free-" + receipt,
+			Amount:     0,
+			Source:     "free",
+			RecordedBy: uid,
+		}
+		if quote != nil {
+			payment.PaymentID = "coupon-" + receipt
+			payment.CouponCode = quote.Code
+			payment.Discount = quote.Discount
+			payment.Source = "coupon"
+			couponWrites, err = couponRedemptionWrites(quote.Code, uid, payment.PaymentID, quote.Discount, now)
+			if err != nil {
+				log.Printf("❌ Error preparing coupon redemption: %v", err)
+				return CreateErrorResponse(500, "Internal Server Error"), nil
+			}
+		}
+		recorded, err := ApplySubscriptionPayment(student, plan, payment, now, couponWrites...)
+		if couponErr := couponRedemptionError(err); couponErr != nil {
+			return couponErrorResponse(couponErr), nil
+		}
+		if errors.Is(err, ErrSubscriptionConflict) {
+			return CreateErrorResponse(409, err.Error()), nil
+		}
+		if err != nil {
+			log.Printf("❌ Error recording payment: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+
+		response := map[string]interface{}{
+			"message":    "Subscription activated",
+			"paymentId":  recorded.PaymentID,
+			"planId":     plan.PlanID,
+			"validUntil": recorded.ValidUntil,
+			"coupon":     quote,
+		}
+		responseJSON, _ := json.Marshal(response)
+		return events.APIGatewayProxyResponse{
+			StatusCode: 201,
+			Headers:    GetCORSHeaders(),
+			Body:       string(responseJSON),
+		}, nil
+	}
+
+	// The limit was checked by QuoteCoupon; check the student's own use here
+	// since redemption waits for the payment
+	if quote != nil {
+		redeemed, err := HasRedeemedCoupon(quote.Code, uid)
+		if err != nil {
+			log.Printf("❌ Error checking coupon redemption: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		if redeemed {
+			return couponErrorResponse(ErrCouponAlreadyRedeemed), nil
+		}
+	}
+
+	// Amounts are sent to the provider in paise
+	amount := int64(math.Round(price * 100))
+	provider := GetPaymentProvider()
+	notes := map[string]string{
+		"uid":     uid,
+		"plan_id": plan.PlanID,
+	}
+
+	order, err := provider.CreateOrder(amount, "INR", receipt, notes)
+	if err != nil {
+		log.Printf("❌ Error creating payment order: %v", err)
+		return CreateErrorResponse(502, "Failed to create payment order"), nil
+	}
+
+	orderItem := PaymentOrderItem{
+		OrderID:   order.OrderID,
+		UID:       uid,
+		PlanID:    plan.PlanID,
+		Amount:    order.Amount,
+		Currency:  order.Currency,
+		Provider:  provider.Name(),
+		TenantID:  tenantID,
+		Status:    "created",
+		CreatedAt: now.UTC().Format(subExpDateLayout),
+	}
+	if quote != nil {
+		orderItem.CouponCode = quote.Code
+		orderItem.Discount = quote.Discount
+	}
+
+	if err := SavePaymentOrder(orderItem); err != nil {
+		log.Printf("❌ Error saving payment order: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	log.Printf("📌 Created payment order %s for %s (%s)", order.OrderID, uid, plan.PlanID)
+
+	response := map[string]interface{}{
+		"orderId":  order.OrderID,
+		"amount":   order.Amount,
+		"currency": order.Currency,
+		"keyId":    provider.KeyID(),
+		"provider": provider.Name(),
+		"planId":   plan.PlanID,
+	}
+	if quote != nil {
+		response["coupon"] = quote
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 201,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandlePaymentWebhook receives provider events. It is not behind the Firebase
+// authorizer; the HMAC signature is the only authentication.
+func HandlePaymentWebhook(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	body := []byte(request.Body)
+	if request.IsBase64Encoded {
+		decoded, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return CreateErrorResponse(400, "Failed to decode base64 body"), nil
+		}
+		body = decoded
+	}
+
+	provider := GetPaymentProvider()
+	signature := GetHeader(request, "X-Razorpay-Signature")
+	if !provider.VerifyWebhookSignature(body, signature) {
+		log.Printf("❌ Invalid webhook signature")
+		return CreateErrorResponse(401, "Invalid signature"), nil
+	}
+
+	var event PaymentWebhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		log.Printf("❌ Error parsing webhook: %v", err)
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+
+	if event.Event != "payment.captured" && event.Event != "order.paid" {
+		log.Printf("ℹ️ Ignoring webhook event: %s", event.Event)
+		return CreateSuccessResponse("Event ignored"), nil
+	}
+
+	payment := event.Payload.Payment.Entity
+	if payment.ID == "" || payment.OrderID == "" {
+		return CreateErrorResponse(400, "Missing payment or order id"), nil
+	}
+
+	log.Printf("📌 Webhook %s: payment %s for order %s", event.Event, payment.ID, payment.OrderID)
+
+	order, err := GetPaymentOrder(payment.OrderID)
+	if err != nil {
+		log.Printf("❌ Error fetching order: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if order == nil {
+		// Not one of ours; acknowledge so the provider stops retrying
+		log.Printf("⚠️ Unknown order in webhook: %s", payment.OrderID)
+		return CreateSuccessResponse("Order not recognised"), nil
+	}
+
+	if payment.Amount < order.Amount || payment.Currency != order.Currency {
+		log.Printf("❌ Payment %s amount %d %s does not match order %d %s", payment.ID, payment.Amount, payment.Currency, order.Amount, order.Currency)
+		return CreateErrorResponse(400, "Payment amount does not match order"), nil
+	}
+
+	student, err := GetStudentInfoByUID(order.TenantID, order.UID)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		log.Printf("❌ Student %s for order %s not found", order.UID, order.OrderID)
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	plan, err := GetPlanByID(order.PlanID)
+	if err != nil {
+		log.Printf("❌ Error fetching plan: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if plan == nil {
+		log.Printf("❌ Plan %s for order %s not found", order.PlanID, order.OrderID)
+		return CreateErrorResponse(404, "Plan not found"), nil
+	}
+
+	now := time.Now()
+	var couponWrites []*dynamodb.TransactWriteItem
+	if order.CouponCode != "" {
+		couponWrites, err = couponRedemptionWrites(order.CouponCode, order.UID, payment.ID, order.Discount, now)
+		if err != nil {
+			log.Printf("❌ Error preparing coupon redemption: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+	}
+
+	// The coupon is redeemed in the same transaction as the ledger row, so a
+	// replayed webhook cannot redeem it twice, and only if it is still under
+	// its limit and unused by the student
+	recorded, err := ApplySubscriptionPayment(student, plan, PaymentItem{
+		PaymentID:  payment.ID,
+		OrderID:    order.OrderID,
+		Amount:     float64(payment.Amount) / 100,
+		Currency:   payment.Currency,
+		CouponCode: order.CouponCode,
+		Discount:   order.Discount,
+		Source:     provider.Name(),
+		RecordedBy: "webhook",
+	}, now, couponWrites...)
+	if errors.Is(err, ErrPaymentAlreadyRecorded) {
+		log.Printf("ℹ️ Payment %s already recorded", payment.ID)
+		return CreateSuccessResponse("Payment already recorded"), nil
+	}
+	if couponErr := couponRedemptionError(err); couponErr != nil {
+		// The money was taken but the coupon was used up by a parallel order;
+		// acknowledge so the provider stops retrying and leave it for a refund
+		log.Printf("❌ Payment %s for order %s needs a refund: %v", payment.ID, order.OrderID, couponErr)
+		if err := MarkPaymentOrderRefundRequired(order.OrderID, payment.ID, couponErr.Error()); err != nil {
+			log.Printf("❌ Failed to flag order %s for refund: %v", order.OrderID, err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		return CreateSuccessResponse("Payment flagged for refund"), nil
+	}
+	if err != nil {
+		log.Printf("❌ Error recording payment: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	if err := MarkPaymentOrderPaid(order.OrderID, payment.ID); err != nil {
+		// The ledger is the source of truth; the order status is informational
+		log.Printf("⚠️ Failed to mark order %s paid: %v", order.OrderID, err)
+	}
+
+	log.Printf("✅ Payment %s recorded, subscription valid until %s", recorded.PaymentID, recorded.ValidUntil)
+	return CreateSuccessResponse("Payment recorded"), nil
+}
+
+type FakeCaptureRequest struct {
+	OrderID string `json:"orderId"`
+}
+
+// HandleFakePaymentCapture simulates the provider capturing an order. It is only
+// available with PAYMENT_PROVIDER=fake and runs the real webhook path end to end.
+func HandleFakePaymentCapture(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	fake, ok := GetPaymentProvider().(*FakePaymentProvider)
+	if !ok {
+		return CreateErrorResponse(404, "Fake payment provider not enabled"), nil
+	}
+
+	var req FakeCaptureRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil || req.OrderID == "" {
+		return CreateErrorResponse(400, "Missing 'orderId' parameter"), nil
+	}
+
+	order, err := GetPaymentOrder(req.OrderID)
+	if err != nil {
+		log.Printf("❌ Error fetching order: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if order == nil {
+		return CreateErrorResponse(404, "Order not found"), nil
+	}
+
+	body, signature, err := fake.CapturePayment(&PaymentOrder{
+		OrderID:  order.OrderID,
+		Amount:   order.Amount,
+		Currency: order.Currency,
+		Notes:    map[string]string{"uid": order.UID, "plan_id": order.PlanID},
+	}, fmt.Sprintf("pay_fake_%d", time.Now().UnixNano()))
+	if err != nil {
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	return HandlePaymentWebhook(events.APIGatewayProxyRequest{
+		Headers: map[string]string{"X-Razorpay-Signature": signature},
+		Body:    string(body),
+	})
+}
@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Practice quizzes are assembled for one student from questions of existing
+// quizzes. They live in quiz_questions like any other quiz so the standard
+// get, submit and result handlers work on them, but they carry an owner, are
+// removed by the table's TTL and are kept out of lists, item statistics,
+// leaderboards, progress and trends.
+const PracticeTopic = "PRACTICE"
+
+// How long a practice quiz can be taken
+const practiceQuizTTL = 24 * time.Hour
+
+// Difficulty bands on the item p-value. Questions answered by fewer than
+// practiceMinItemAttempts students have no band yet.
+const (
+	PracticeEasy            = "easy"
+	PracticeMedium          = "medium"
+	PracticeHard            = "hard"
+	practiceEasyPValue      = 0.7
+	practiceHardPValue      = 0.4
+	practiceMinItemAttempts = 5
+)
+
+// Where a practice question was taken from
+type QuestionSource struct {
+	QuizName    string `json:"quiz_name" dynamodbav:"quiz_name"`
+	ClassName   string `json:"class_name" dynamodbav:"class_name"`
+	SubjectName string `json:"subject_name" dynamodbav:"subject_name"`
+	Topic       string `json:"topic" dynamodbav:"topic"`
+	Qno         int    `json:"qno" dynamodbav:"qno"`
+}
+
+type PracticeFilter struct {
+	Topics     []string
+	Difficulty string
+	OnlyWrong  bool
+}
+
+type practiceCandidate struct {
+	question   Question
+	questionID string
+	source     QuestionSource
+}
+
+func isPracticeQuiz(quiz *QuizItem) bool {
+	return quiz.OwnerUID != ""
+}
+
+// isPracticeAttempt also covers adaptive attempts, which likewise reuse
+// questions of other quizzes
+func isPracticeAttempt(attempt AttemptItem) bool {
+	return attempt.Topic == PracticeTopic || attempt.Topic == AdaptiveTopic
+}
+
+// withoutPracticeAttempts drops practice and adaptive attempts from statistics
+func withoutPracticeAttempts(attempts []AttemptItem) []AttemptItem {
+	filtered := []AttemptItem{}
+	for _, attempt := range attempts {
+		if !isPracticeAttempt(attempt) {
+			filtered = append(filtered, attempt)
+		}
+	}
+	return filtered
+}
+
+// canAccessQuiz hides practice quizzes from everyone but their owner, and
+// expired ones before the TTL sweep removes them
+func canAccessQuiz(quiz *QuizItem, uid string, now time.Time) bool {
+	if !isPracticeQuiz(quiz) {
+		return true
+	}
+	return quiz.OwnerUID == uid && (quiz.ExpiresAt == 0 || now.Unix() < quiz.ExpiresAt)
+}
+
+// questionSource returns where a quiz question came from; questions of
+// regular quizzes are their own source
+func questionSource(quiz *QuizItem, qno int) QuestionSource {
+	if qno >= 1 && qno <= len(quiz.Sources) {
+		return quiz.Sources[qno-1]
+	}
+	return QuestionSource{
+		QuizName:    quiz.QuizName,
+		ClassName:   quiz.ClassName,
+		SubjectName: quiz.SubjectName,
+		Topic:       quiz.Topic,
+		Qno:         qno,
+	}
+}
+
+// difficultyBand classifies a question from its item statistics counters
+func difficultyBand(counters map[string]int) string {
+	attempts := counters["attempts"]
+	if attempts < practiceMinItemAttempts {
+		return ""
+	}
+	pValue := float64(counters["correct"]) / float64(attempts)
+	switch {
+	case pValue >= practiceEasyPValue:
+		return PracticeEasy
+	case pValue < practiceHardPValue:
+		return PracticeHard
+	}
+	return PracticeMedium
+}
+
+// wrongAnswerKeys returns the questions, as question keys, answered wrong
+// in the student's latest attempt of each quiz
+func wrongAnswerKeys(attempts []AttemptItem) map[string]bool {
+	keys := make(map[string]bool)
+	for _, attempt := range withoutPracticeAttempts(attempts) {
+		for _, result := range attempt.Results {
+			if result.Status == "wrong" {
+				keys[questionKey(attempt.QuizName, result.Qno)] = true
+			}
+		}
+	}
+	return keys
+}
+
+// PracticeCandidates collects the questions of quizzes matching the filter.
+// wrong is only consulted with OnlyWrong.
+func PracticeCandidates(tenantID string, quizzes []QuizItem, filter PracticeFilter, wrong map[string]bool) ([]practiceCandidate, error) {
+	candidates := []practiceCandidate{}
+	for i := range quizzes {
+		quiz := &quizzes[i]
+		if len(filter.Topics) > 0 && !containsString(filter.Topics, quiz.Topic) {
+			continue
+		}
+		// Practice results would give the answers away
+		if answersHidden(quiz, time.Now()) {
+			continue
+		}
+
+		var stats map[int]map[string]int
+		if filter.Difficulty != "" {
+			var err error
+			if stats, err = FetchItemStats(tenantID, quiz.QuizName); err != nil {
+				return nil, err
+			}
+		}
+
+		for j, question := range quiz.Questions {
+			qno := j + 1
+			if filter.OnlyWrong && !wrong[questionKey(quiz.QuizName, qno)] {
+				continue
+			}
+			if filter.Difficulty != "" && difficultyBand(stats[qno]) != filter.Difficulty {
+				continue
+			}
+			candidate := practiceCandidate{
+				question: question,
+				source:   questionSource(quiz, qno),
+			}
+			if len(quiz.QuestionIDs) == len(quiz.Questions) {
+				candidate.questionID = quiz.QuestionIDs[j]
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates, nil
+}
+
+// BuildPracticeQuiz draws up to count candidates in random order into a
+// practice quiz owned by uid
+func BuildPracticeQuiz(uid, className, subjectName string, candidates []practiceCandidate, count, duration int, now time.Time) QuizItem {
+	rand.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	if count > len(candidates) {
+		count = len(candidates)
+	}
+
+	quiz := QuizItem{
+		QuizName:    fmt.Sprintf("practice_%d", now.UnixNano()),
+		Duration:    duration,
+		ClassName:   className,
+		SubjectName: subjectName,
+		Topic:       PracticeTopic,
+		Questions:   []Question{},
+		OwnerUID:    uid,
+		ExpiresAt:   now.Add(practiceQuizTTL).Unix(),
+		Sources:     []QuestionSource{},
+	}
+	banked := false
+	questionIDs := []string{}
+	for _, candidate := range candidates[:count] {
+		quiz.Questions = append(quiz.Questions, candidate.question)
+		quiz.Sources = append(quiz.Sources, candidate.source)
+		questionIDs = append(questionIDs, candidate.questionID)
+		banked = banked || candidate.questionID != ""
+	}
+	// Bank questions stay current like in the source quizzes
+	if banked {
+		quiz.QuestionIDs = questionIDs
+	}
+	return quiz
+}
+
+// Save a practice quiz, never overwriting an existing quiz
+func SavePracticeQuiz(tenantID string, quiz QuizItem) error {
+	quiz.TenantID = normalizeTenantID(tenantID)
+	quiz.QuizName = scopedKey(tenantID, quiz.QuizName)
+	av, err := dynamodbattribute.MarshalMap(quiz)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("quiz_questions"),
+		Item:                av,
+		ConditionExpression: aws.String("attribute_not_exists(quiz_name)"),
+	})
+	return err
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultPracticeCount = 10
+	maxPracticeCount     = 50
+	// Minutes per question when no duration is given
+	practiceMinutesPerQuestion = 1
+)
+
+type PracticeQuizRequest struct {
+	SubjectName string   `json:"subjectName"`
+	Topics      []string `json:"topics,omitempty"`
+	Count       int      `json:"count,omitempty"`
+	Difficulty  string   `json:"difficulty,omitempty"` // easy, medium or hard
+	OnlyWrong   bool     `json:"onlyWrong,omitempty"`
+	Duration    int      `json:"duration,omitempty"`
+}
+
+// HandlePracticeQuizCreate assembles a practice quiz for the caller from the
+// quizzes of their class. The quiz is then taken with the regular quiz
+// endpoints using the returned quizName, className, subjectName and topic.
+func HandlePracticeQuizCreate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req PracticeQuizRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.SubjectName == "" {
+		return CreateErrorResponse(400, "Missing 'subjectName' parameter"), nil
+	}
+	if req.Count == 0 {
+		req.Count = defaultPracticeCount
+	}
+	if req.Count < 0 || req.Count > maxPracticeCount {
+		return CreateErrorResponse(400, "'count' must be between 1 and 50"), nil
+	}
+	if req.Difficulty != "" && req.Difficulty != PracticeEasy && req.Difficulty != PracticeMedium && req.Difficulty != PracticeHard {
+		return CreateErrorResponse(400, "'difficulty' must be 'easy', 'medium' or 'hard'"), nil
+	}
+	if req.Duration < 0 {
+		return CreateErrorResponse(400, "'duration' must be positive"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	className := student.StudentClass
+	if resp, denied := subscriptionDeniedResponse(student, className, req.SubjectName); denied {
+		return resp, nil
+	}
+
+	quizzes, err := ListQuizzes(tenantID, className, req.SubjectName, "")
+	if err != nil {
+		log.Printf("❌ Error listing quizzes: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var wrong map[string]bool
+	if req.OnlyWrong {
+		attempts, err := GetStudentAttempts(tenantID, uid)
+		if err != nil {
+			log.Printf("❌ Error querying attempts: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		wrong = wrongAnswerKeys(attempts)
+	}
+
+	filter := PracticeFilter{Topics: req.Topics, Difficulty: req.Difficulty, OnlyWrong: req.OnlyWrong}
+	candidates, err := PracticeCandidates(tenantID, quizzes, filter, wrong)
+	if err != nil {
+		log.Printf("❌ Error collecting practice questions: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if len(candidates) == 0 {
+		return CreateErrorResponse(404, "No questions match the filters"), nil
+	}
+
+	duration := req.Duration
+	if duration == 0 {
+		duration = min(req.Count, len(candidates)) * practiceMinutesPerQuestion
+	}
+
+	quiz := BuildPracticeQuiz(uid, className, req.SubjectName, candidates, req.Count, duration, time.Now())
+	if err := SavePracticeQuiz(tenantID, quiz); err != nil {
+		log.Printf("❌ Error saving practice quiz: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	log.Printf("📌 Practice quiz %s created for %s with %d questions", quiz.QuizName, uid, len(quiz.Questions))
+
+	response := map[string]interface{}{
+		"message":       "Practice quiz created successfully",
+		"quizName":      quiz.QuizName,
+		"className":     quiz.ClassName,
+		"subjectName":   quiz.SubjectName,
+		"topic":         quiz.Topic,
+		"duration":      duration,
+		"questionCount": len(quiz.Questions),
+		"available":     len(candidates),
+		"expiresAt":     time.Unix(quiz.ExpiresAt, 0).UTC().Format(subExpDateLayout),
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
@@ -0,0 +1,373 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// BatchGetItem accepts at most 100 keys per call
+const bankBatchGetSize = 100
+
+// Question bank item structure. question_id is scoped to the tenant and never
+// changes; content_hash follows the current content and is used to find
+// duplicates on upload.
+type QuestionBankItem struct {
+	QuestionID    string   `json:"question_id" dynamodbav:"question_id"`
+	ContentHash   string   `json:"content_hash" dynamodbav:"content_hash"`
+	ClassName     string   `json:"class_name" dynamodbav:"class_name"`
+	SubjectName   string   `json:"subject_name" dynamodbav:"subject_name"`
+	Topic         string   `json:"topic" dynamodbav:"topic"`
+	Question      string   `json:"question" dynamodbav:"question"`
+	AllAnswers    []string `json:"all_answers" dynamodbav:"all_answers"`
+	CorrectAnswer string   `json:"correct_answer" dynamodbav:"correct_answer"`
+	Explanation   string   `json:"explanation" dynamodbav:"explanation"`
+	Tags          []string `json:"tags,omitempty" dynamodbav:"tags,stringset,omitempty"`
+	Difficulty    string   `json:"difficulty,omitempty" dynamodbav:"difficulty,omitempty"`
+	Source        string   `json:"source,omitempty" dynamodbav:"source,omitempty"`
+	CreatedAt     string   `json:"created_at" dynamodbav:"created_at"`
+	UpdatedAt     string   `json:"updated_at" dynamodbav:"updated_at"`
+	TenantID      string   `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+func (q QuestionBankItem) toQuestion() Question {
+	return Question{
+		Explanation:   q.Explanation,
+		Question:      q.Question,
+		CorrectAnswer: q.CorrectAnswer,
+		AllAnswers:    q.AllAnswers,
+	}
+}
+
+// normalizeText lowercases and collapses whitespace for hashing
+func normalizeText(value string) string {
+	return strings.Join(strings.Fields(strings.ToLower(value)), " ")
+}
+
+// questionContentHash identifies a question by its text, options and correct
+// letters, ignoring case and spacing. The explanation is not part of it.
+func questionContentHash(question Question) string {
+	parts := []string{normalizeText(question.Question)}
+	for _, answer := range question.AllAnswers {
+		parts = append(parts, normalizeText(answer))
+	}
+	letters := strings.Split(strings.ToUpper(question.CorrectAnswer), ",")
+	for i := range letters {
+		letters[i] = strings.TrimSpace(letters[i])
+	}
+	parts = append(parts, strings.Join(letters, ","))
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x1f")))
+	return hex.EncodeToString(sum[:])
+}
+
+// questionIDFromHash derives the stable ID a new question is created with
+func questionIDFromHash(hash string) string {
+	return "q_" + hash[:20]
+}
+
+// Create a bank question. The ID is derived from the content hash; if an
+// edited question already holds that ID a time-based one is used instead.
+func CreateBankQuestion(tenantID string, item QuestionBankItem, now time.Time) (*QuestionBankItem, error) {
+	item.ContentHash = questionContentHash(item.toQuestion())
+	item.CreatedAt = now.UTC().Format(subExpDateLayout)
+	item.UpdatedAt = item.CreatedAt
+
+	for _, id := range []string{questionIDFromHash(item.ContentHash), fmt.Sprintf("q_%d", now.UnixNano())} {
+		item.QuestionID = id
+		err := putBankQuestion(tenantID, item, "attribute_not_exists(question_id)")
+		if isConditionFailure(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &item, nil
+	}
+	return nil, fmt.Errorf("question ID %s already taken", item.QuestionID)
+}
+
+// Update a bank question's content and metadata, keeping its ID
+func UpdateBankQuestion(tenantID string, item QuestionBankItem, now time.Time) error {
+	item.ContentHash = questionContentHash(item.toQuestion())
+	item.UpdatedAt = now.UTC().Format(subExpDateLayout)
+	return putBankQuestion(tenantID, item, "attribute_exists(question_id)")
+}
+
+func putBankQuestion(tenantID string, item QuestionBankItem, condition string) error {
+	item.TenantID = normalizeTenantID(tenantID)
+	item.QuestionID = scopedKey(tenantID, item.QuestionID)
+	av, err := dynamodbattribute.MarshalMap(item)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName:           aws.String("question_bank"),
+		Item:                av,
+		ConditionExpression: aws.String(condition),
+	})
+	return err
+}
+
+// Get a bank question by ID within a tenant
+func GetBankQuestion(tenantID, questionID string) (*QuestionBankItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("question_bank"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"question_id": {S: aws.String(scopedKey(tenantID, questionID))},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var item QuestionBankItem
+	if err := dynamodbattribute.UnmarshalMap(result.Item, &item); err != nil {
+		return nil, err
+	}
+	if !belongsToTenant(item.TenantID, tenantID) {
+		return nil, nil
+	}
+	item.QuestionID = questionID
+	return &item, nil
+}
+
+// Find a tenant's bank question with the given content, using the hash GSI
+func FindBankQuestionByHash(tenantID, hash string) (*QuestionBankItem, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":hash": {S: aws.String(hash)},
+	}
+	result, err := dynamoClient.Query(&dynamodb.QueryInput{
+		TableName:                 aws.String("question_bank"),
+		IndexName:                 aws.String("content-hash-index"),
+		KeyConditionExpression:    aws.String("content_hash = :hash"),
+		FilterExpression:          aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.Items) == 0 {
+		return nil, nil
+	}
+
+	var item QuestionBankItem
+	if err := dynamodbattribute.UnmarshalMap(result.Items[0], &item); err != nil {
+		return nil, err
+	}
+	item.QuestionID = unscopedKey(tenantID, item.QuestionID)
+	return &item, nil
+}
+
+// Fetch bank questions by ID, keyed by unscoped ID. Unknown IDs are left out.
+func FetchBankQuestions(tenantID string, questionIDs []string) (map[string]QuestionBankItem, error) {
+	questions := make(map[string]QuestionBankItem)
+	for start := 0; start < len(questionIDs); start += bankBatchGetSize {
+		end := min(start+bankBatchGetSize, len(questionIDs))
+
+		seen := make(map[string]bool)
+		keys := []map[string]*dynamodb.AttributeValue{}
+		for _, id := range questionIDs[start:end] {
+			if id == "" || seen[id] {
+				continue
+			}
+			seen[id] = true
+			keys = append(keys, map[string]*dynamodb.AttributeValue{
+				"question_id": {S: aws.String(scopedKey(tenantID, id))},
+			})
+		}
+
+		requests := map[string]*dynamodb.KeysAndAttributes{
+			"question_bank": {Keys: keys},
+		}
+		for len(keys) > 0 && len(requests) > 0 {
+			result, err := dynamoClient.BatchGetItem(&dynamodb.BatchGetItemInput{RequestItems: requests})
+			if err != nil {
+				return nil, err
+			}
+
+			var items []QuestionBankItem
+			if err := dynamodbattribute.UnmarshalListOfMaps(result.Responses["question_bank"], &items); err != nil {
+				return nil, err
+			}
+			for _, item := range items {
+				if belongsToTenant(item.TenantID, tenantID) {
+					item.QuestionID = unscopedKey(tenantID, item.QuestionID)
+					questions[item.QuestionID] = item
+				}
+			}
+			requests = result.UnprocessedKeys
+		}
+	}
+	return questions, nil
+}
+
+// ResolveQuizQuestions replaces a quiz's embedded questions with the current
+// bank version of each referenced question. The embedded copy is kept for
+// questions that are not in the bank.
+func ResolveQuizQuestions(tenantID string, quiz *QuizItem) error {
+	if len(quiz.QuestionIDs) != len(quiz.Questions) {
+		return nil
+	}
+
+	bank, err := FetchBankQuestions(tenantID, quiz.QuestionIDs)
+	if err != nil {
+		return err
+	}
+	for i, id := range quiz.QuestionIDs {
+		if item, ok := bank[id]; ok {
+			quiz.Questions[i] = item.toQuestion()
+		}
+	}
+	return nil
+}
+
+// AddQuestionsToBank returns the bank ID of every question of an uploaded
+// quiz, creating bank questions for content not seen before
+func AddQuestionsToBank(tenantID string, quiz QuizData, now time.Time) ([]string, int, error) {
+	ids := []string{}
+	created := 0
+	// The hash index is eventually consistent, so repeats within the upload
+	// are matched here
+	uploaded := make(map[string]string)
+	for _, question := range quiz.Questions {
+		hash := questionContentHash(question)
+		if id, ok := uploaded[hash]; ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		existing, err := FindBankQuestionByHash(tenantID, hash)
+		if err != nil {
+			return nil, 0, err
+		}
+		if existing != nil {
+			uploaded[hash] = existing.QuestionID
+			ids = append(ids, existing.QuestionID)
+			continue
+		}
+
+		item, err := CreateBankQuestion(tenantID, QuestionBankItem{
+			ClassName:     quiz.ClassName,
+			SubjectName:   quiz.SubjectName,
+			Topic:         quiz.Topic,
+			Question:      question.Question,
+			AllAnswers:    question.AllAnswers,
+			CorrectAnswer: question.CorrectAnswer,
+			Explanation:   question.Explanation,
+			Source:        "upload:" + quiz.QuizName,
+		}, now)
+		if err != nil {
+			return nil, 0, err
+		}
+		uploaded[hash] = item.QuestionID
+		ids = append(ids, item.QuestionID)
+		created++
+	}
+	return ids, created, nil
+}
+
+// BankSearchFilter narrows a question search; empty fields match all
+type BankSearchFilter struct {
+	ClassName   string
+	SubjectName string
+	Topic       string
+	Tag         string
+	Difficulty  string
+	Text        string
+}
+
+// Search a tenant's bank questions
+func SearchBankQuestions(tenantID string, filter BankSearchFilter) ([]QuestionBankItem, error) {
+	values := map[string]*dynamodb.AttributeValue{}
+	conditions := []string{tenantCondition(tenantID, values)}
+	for _, field := range []struct{ attribute, placeholder, value string }{
+		{"class_name", ":className", filter.ClassName},
+		{"subject_name", ":subjectName", filter.SubjectName},
+		{"topic", ":topic", filter.Topic},
+		{"difficulty", ":difficulty", filter.Difficulty},
+	} {
+		if field.value != "" {
+			conditions = append(conditions, field.attribute+" = "+field.placeholder)
+			values[field.placeholder] = &dynamodb.AttributeValue{S: aws.String(field.value)}
+		}
+	}
+	if filter.Tag != "" {
+		conditions = append(conditions, "contains(tags, :tag)")
+		values[":tag"] = &dynamodb.AttributeValue{S: aws.String(filter.Tag)}
+	}
+
+	// Text matching is case-insensitive, so it is done here rather than in the filter
+	text := normalizeText(filter.Text)
+	questions := []QuestionBankItem{}
+	var unmarshalErr error
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("question_bank"),
+		FilterExpression:          aws.String(strings.Join(conditions, " AND ")),
+		ExpressionAttributeValues: values,
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		var pageQuestions []QuestionBankItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &pageQuestions); unmarshalErr != nil {
+			return false
+		}
+		for _, question := range pageQuestions {
+			if text != "" && !strings.Contains(normalizeText(question.Question), text) {
+				continue
+			}
+			question.QuestionID = unscopedKey(tenantID, question.QuestionID)
+			questions = append(questions, question)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return questions, unmarshalErr
+}
+
+// Names of a tenant's quizzes that reference a bank question
+func QuizzesUsingQuestion(tenantID, questionID string) ([]string, error) {
+	values := map[string]*dynamodb.AttributeValue{
+		":questionId": {S: aws.String(questionID)},
+	}
+
+	names := []string{}
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("quiz_questions"),
+		FilterExpression:          aws.String("contains(question_ids, :questionId) AND attribute_not_exists(owner_uid) AND " + tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+		ProjectionExpression:      aws.String("quiz_name"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			names = append(names, unscopedKey(tenantID, aws.StringValue(item["quiz_name"].S)))
+		}
+		return true
+	})
+	return names, err
+}
+
+// Delete a bank question, only if it belongs to the tenant
+func DeleteBankQuestion(tenantID, questionID string) error {
+	values := map[string]*dynamodb.AttributeValue{}
+	_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("question_bank"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"question_id": {S: aws.String(scopedKey(tenantID, questionID))},
+		},
+		ConditionExpression:       aws.String(tenantCondition(tenantID, values)),
+		ExpressionAttributeValues: values,
+	})
+	return err
+}
@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type BankQuestionRequest struct {
+	QuestionID    string   `json:"questionId,omitempty"`
+	ClassName     string   `json:"className"`
+	SubjectName   string   `json:"subjectName"`
+	Topic         string   `json:"topic"`
+	Question      string   `json:"question"`
+	AllAnswers    []string `json:"allAnswers"`
+	CorrectAnswer string   `json:"correctAnswer"`
+	Explanation   string   `json:"explanation"`
+	Tags          []string `json:"tags,omitempty"`
+	Difficulty    string   `json:"difficulty,omitempty"` // easy, medium or hard
+	Source        string   `json:"source,omitempty"`
+}
+
+type BankQuestionDeleteRequest struct {
+	QuestionID string `json:"questionId"`
+}
+
+// validateBankQuestion returns a message describing the first problem found
+func validateBankQuestion(req BankQuestionRequest) string {
+	switch {
+	case req.ClassName == "" || req.SubjectName == "" || req.Topic == "":
+		return "Missing 'className', 'subjectName' or 'topic'"
+	case strings.TrimSpace(req.Question) == "":
+		return "Missing 'question'"
+	case len(req.AllAnswers) < 2:
+		return "'allAnswers' needs at least two options"
+	case req.Difficulty != "" && req.Difficulty != PracticeEasy && req.Difficulty != PracticeMedium && req.Difficulty != PracticeHard:
+		return "'difficulty' must be 'easy', 'medium' or 'hard'"
+	}
+
+	letters := strings.Split(req.CorrectAnswer, ",")
+	for _, letter := range letters {
+		letter = strings.ToUpper(strings.TrimSpace(letter))
+		if len(letter) != 1 || letter[0] < 'A' || int(letter[0]-'A') >= len(req.AllAnswers) {
+			return "'correctAnswer' must be comma-separated option letters"
+		}
+	}
+	return ""
+}
+
+// HandleBankQuestionUpsert creates a question, or updates it when questionId
+// is given. Creating a question that is already in the bank returns the
+// existing one.
+func HandleBankQuestionUpsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	_, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+
+	var req BankQuestionRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if msg := validateBankQuestion(req); msg != "" {
+		return CreateErrorResponse(400, msg), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	now := time.Now()
+	item := QuestionBankItem{
+		QuestionID:    req.QuestionID,
+		ClassName:     req.ClassName,
+		SubjectName:   req.SubjectName,
+		Topic:         req.Topic,
+		Question:      req.Question,
+		AllAnswers:    req.AllAnswers,
+		CorrectAnswer: req.CorrectAnswer,
+		Explanation:   req.Explanation,
+		Tags:          req.Tags,
+		Difficulty:    req.Difficulty,
+		Source:        req.Source,
+	}
+
+	statusCode := 200
+	message := "Question updated successfully"
+	if req.QuestionID == "" {
+		existing, err := FindBankQuestionByHash(tenantID, questionContentHash(item.toQuestion()))
+		if err != nil {
+			log.Printf("❌ Error checking for duplicate question: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		if existing != nil {
+			response := map[string]interface{}{
+				"message":   "Question already in bank",
+				"duplicate": true,
+				"question":  existing,
+			}
+			responseJSON, _ := json.Marshal(response)
+			return events.APIGatewayProxyResponse{
+				StatusCode: 200,
+				Headers:    GetCORSHeaders(),
+				Body:       string(responseJSON),
+			}, nil
+		}
+
+		if item.Source == "" {
+			item.Source = "manual"
+		}
+		created, err := CreateBankQuestion(tenantID, item, now)
+		if err != nil {
+			log.Printf("❌ Error creating question: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		item = *created
+		statusCode = 201
+		message = "Question created successfully"
+	} else {
+		existing, err := GetBankQuestion(tenantID, req.QuestionID)
+		if err != nil {
+			log.Printf("❌ Error fetching question: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		if existing == nil {
+			return CreateErrorResponse(404, "Question not found"), nil
+		}
+
+		item.CreatedAt = existing.CreatedAt
+		if item.Source == "" {
+			item.Source = existing.Source
+		}
+		if err := UpdateBankQuestion(tenantID, item, now); err != nil {
+			log.Printf("❌ Error updating question: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+	}
+
+	response := map[string]interface{}{
+		"message":  message,
+		"question": item,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleBankQuestionGet returns a question and the quizzes that use it
+func HandleBankQuestionGet(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	_, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+
+	questionID := request.QueryStringParameters["questionId"]
+	if questionID == "" {
+		return CreateErrorResponse(400, "Missing 'questionId' parameter"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	question, err := GetBankQuestion(tenantID, questionID)
+	if err != nil {
+		log.Printf("❌ Error fetching question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if question == nil {
+		return CreateErrorResponse(404, "Question not found"), nil
+	}
+
+	usedIn, err := QuizzesUsingQuestion(tenantID, questionID)
+	if err != nil {
+		log.Printf("❌ Error finding quizzes using question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	response := map[string]interface{}{
+		"question": question,
+		"usedIn":   usedIn,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleBankQuestionSearch searches questions by class, subject, topic, tag,
+// difficulty and text
+func HandleBankQuestionSearch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	_, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+
+	params := request.QueryStringParameters
+	filter := BankSearchFilter{
+		ClassName:   params["className"],
+		SubjectName: params["subjectName"],
+		Topic:       params["topic"],
+		Tag:         params["tag"],
+		Difficulty:  params["difficulty"],
+		Text:        params["q"],
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	questions, err := SearchBankQuestions(tenantID, filter)
+	if err != nil {
+		log.Printf("❌ Error searching questions: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	response := map[string]interface{}{
+		"questions": questions,
+		"count":     len(questions),
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleBankQuestionDelete deletes a question no quiz uses anymore
+func HandleBankQuestionDelete(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	_, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+
+	var req BankQuestionDeleteRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.QuestionID == "" {
+		return CreateErrorResponse(400, "Missing 'questionId' parameter"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	question, err := GetBankQuestion(tenantID, req.QuestionID)
+	if err != nil {
+		log.Printf("❌ Error fetching question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if question == nil {
+		return CreateErrorResponse(404, "Question not found"), nil
+	}
+
+	usedIn, err := QuizzesUsingQuestion(tenantID, req.QuestionID)
+	if err != nil {
+		log.Printf("❌ Error finding quizzes using question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if len(usedIn) > 0 {
+		return CreateErrorResponse(409, "Question is used by quizzes: "+strings.Join(usedIn, ", ")), nil
+	}
+
+	if err := DeleteBankQuestion(tenantID, req.QuestionID); err != nil {
+		log.Printf("❌ Error deleting question: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	return CreateSuccessResponse("Question deleted successfully"), nil
+}
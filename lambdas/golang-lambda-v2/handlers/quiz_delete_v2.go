@@ -2,11 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 func HandleQuizDeleteV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -34,68 +33,54 @@ func HandleQuizDeleteV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 	if topic == "" {
 		return CreateErrorResponse(400, "Missing 'topic' parameter"), nil
 	}
+	expectedVersion, err := parseExpectedVersion(request)
+	if err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
 
 	log.Printf("📌 Deleting quiz: %s (%s-%s-%s)", quizName, className, subjectName, topic)
 
-	// Check if quiz exists with all filters
-	getResult, err := dynamoClient.Scan(&dynamodb.ScanInput{
-		TableName:        aws.String("quiz_questions"),
-		FilterExpression: aws.String("quiz_name = :quizName AND class_name = :className AND subject_name = :subjectName AND topic = :topic"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":quizName":    {S: aws.String(quizName)},
-			":className":   {S: aws.String(className)},
-			":subjectName": {S: aws.String(subjectName)},
-			":topic":       {S: aws.String(topic)},
-		},
-	})
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
 
+	// Check if quiz exists with all filters
+	quiz, err := GetQuizFromDynamoDB(tenantID, quizName, className, subjectName, topic)
 	if err != nil {
 		log.Printf("❌ Error checking quiz: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
-	if len(getResult.Items) == 0 {
+	if quiz == nil {
 		return CreateErrorResponse(404, "Quiz not found"), nil
 	}
 
-	// Delete quiz
-	_, err = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
-		TableName: aws.String("quiz_questions"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"quiz_name": {S: aws.String(quizName)},
-		},
-	})
+	if err := checkVersion(quiz.Version, expectedVersion); err != nil {
+		return versionConflictResponse("quiz"), nil
+	}
 
+	// Delete quiz
+	err = DeleteQuizFromDynamoDB(tenantID, quizName, expectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse("quiz"), nil
+	}
 	if err != nil {
 		log.Printf("❌ Error deleting quiz: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
 	// Delete all attempt records for this specific quiz (matching all filters)
-	scanResult, scanErr := dynamoClient.Scan(&dynamodb.ScanInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		FilterExpression: aws.String("quiz_name = :quiz_name AND class_name = :className AND category = :subjectName"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":quiz_name":    {S: aws.String(quizName)},
-			":className":    {S: aws.String(className)},
-			":subjectName":  {S: aws.String(subjectName)},
-		},
-	})
+	deleted, err := DeleteQuizAttempts(tenantID, quizName, className, subjectName)
+	if err != nil {
+		log.Printf("⚠️ Error deleting attempts for quiz %s: %v", quizName, err)
+	} else {
+		log.Printf("🗑️ Deleted %d attempt records for quiz %s", deleted, quizName)
+	}
 
-	if scanErr == nil {
-		for _, item := range scanResult.Items {
-			if email := item["email"]; email != nil && email.S != nil {
-				_, _ = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
-					TableName: aws.String("student_quiz_attempts_v2"),
-					Key: map[string]*dynamodb.AttributeValue{
-						"email": {S: email.S},
-						"quiz_name": {S: aws.String(quizName)},
-					},
-				})
-				log.Printf("🗑️ Deleted attempt record for %s", *email.S)
-			}
-		}
-		log.Printf("🗑️ Deleted %d attempt records for quiz %s", len(scanResult.Items), quizName)
+	if err := DeleteItemStats(tenantID, quizName, len(quiz.Questions)); err != nil {
+		log.Printf("⚠️ Error deleting item stats for quiz %s: %v", quizName, err)
 	}
 
 	response := map[string]interface{}{
@@ -3,6 +3,7 @@ package handlers
 import (
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 )
@@ -35,7 +36,12 @@ func HandleQuizGetByNameV2(request events.APIGatewayProxyRequest) (events.APIGat
 	log.Printf("📌 Fetching quiz questions for: %s (%s-%s-%s), UID: %s", quizName, className, subjectName, topic, userUID)
 
 	// Check student exists and is paid
-	student, err := GetStudentInfoByUID(userUID)
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, userUID)
 	if err != nil {
 		log.Printf("❌ Error fetching student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -45,22 +51,24 @@ func HandleQuizGetByNameV2(request events.APIGatewayProxyRequest) (events.APIGat
 		return CreateErrorResponse(404, "Student not found"), nil
 	}
 
-	// Check payment status (skip for now during migration)
-	// today := time.Now().Format("2006-01-02")
-	// if student.SubExpDate == nil || *student.SubExpDate < today {
-	// 	return CreateErrorResponse(400, "Student not paid"), nil
-	// }
+	// Check subscription status and plan coverage
+	if resp, denied := subscriptionDeniedResponse(student, className, subjectName); denied {
+		return resp, nil
+	}
 
 	// Fetch quiz data and remove correctAnswer from questions
-	quiz, err := GetQuizFromDynamoDB(quizName, className, subjectName, topic)
+	quiz, err := GetQuizFromDynamoDB(tenantID, quizName, className, subjectName, topic)
 	if err != nil {
 		log.Printf("❌ Error fetching quiz: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
-	if quiz == nil {
+	if quiz == nil || !canAccessQuiz(quiz, userUID, time.Now()) {
 		return CreateErrorResponse(404, "Quiz not found"), nil
 	}
+	if quizClosed(quiz, time.Now()) {
+		return CreateErrorResponse(403, "Quiz is closed"), nil
+	}
 
 	// Remove correctAnswer and explanation from questions
 	var cleanQuestions []map[string]interface{}
@@ -81,6 +89,10 @@ func HandleQuizGetByNameV2(request events.APIGatewayProxyRequest) (events.APIGat
 		"topic":       quiz.Topic,
 		"questions":   cleanQuestions,
 	}
+	if quiz.AvailableUntil != "" {
+		quizData["availableUntil"] = quiz.AvailableUntil
+		quizData["hideAnswers"] = quiz.HideAnswers
+	}
 
 	response := map[string]interface{}{
 		"message": "Quiz fetched successfully",
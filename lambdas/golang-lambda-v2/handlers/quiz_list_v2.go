@@ -5,17 +5,17 @@ import (
 	"log"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
 type QuizListItem struct {
-	QuizName    string      `json:"quizName" dynamodbav:"quiz_name"`
-	ClassName   string      `json:"className" dynamodbav:"class_name"`
-	SubjectName string      `json:"subjectName" dynamodbav:"subject_name"`
-	Topic       string      `json:"topic" dynamodbav:"topic"`
-	Duration    interface{} `json:"duration" dynamodbav:"duration"`
+	QuizName       string      `json:"quizName" dynamodbav:"quiz_name"`
+	ClassName      string      `json:"className" dynamodbav:"class_name"`
+	SubjectName    string      `json:"subjectName" dynamodbav:"subject_name"`
+	Topic          string      `json:"topic" dynamodbav:"topic"`
+	Duration       interface{} `json:"duration" dynamodbav:"duration"`
+	AvailableUntil string      `json:"availableUntil,omitempty" dynamodbav:"available_until,omitempty"`
+	HideAnswers    bool        `json:"hideAnswers,omitempty" dynamodbav:"hide_answers,omitempty"`
+	Version        int         `json:"version" dynamodbav:"version"`
 }
 
 func HandleQuizListV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -42,30 +42,29 @@ func HandleQuizListV2(request events.APIGatewayProxyRequest) (events.APIGatewayP
 	log.Printf("📌 Listing quizzes for: %s-%s-%s", className, subjectName, topic)
 
 	// Scan for matching quizzes
-	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
-		TableName:        aws.String("quiz_questions"),
-		FilterExpression: aws.String("class_name = :className AND subject_name = :subjectName AND topic = :topic"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":className":   {S: aws.String(className)},
-			":subjectName": {S: aws.String(subjectName)},
-			":topic":       {S: aws.String(topic)},
-		},
-	})
-
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	items, err := ListQuizzes(tenantID, className, subjectName, topic)
 	if err != nil {
 		log.Printf("❌ Error scanning quizzes: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
 	var quizzes []QuizListItem
-	for _, item := range result.Items {
-		var quiz QuizListItem
-		err = dynamodbattribute.UnmarshalMap(item, &quiz)
-		if err != nil {
-			log.Printf("❌ Error unmarshaling quiz: %v", err)
-			continue
-		}
-		quizzes = append(quizzes, quiz)
+	for _, item := range items {
+		quizzes = append(quizzes, QuizListItem{
+			QuizName:       item.QuizName,
+			ClassName:      item.ClassName,
+			SubjectName:    item.SubjectName,
+			Topic:          item.Topic,
+			Duration:       item.Duration,
+			AvailableUntil: item.AvailableUntil,
+			HideAnswers:    item.HideAnswers,
+			Version:        item.Version,
+		})
 	}
 
 	response := map[string]interface{}{
@@ -79,4 +78,4 @@ func HandleQuizListV2(request events.APIGatewayProxyRequest) (events.APIGatewayP
 		Headers:    GetCORSHeaders(),
 		Body:       string(responseJSON),
 	}, nil
-}
\ No newline at end of file
+}
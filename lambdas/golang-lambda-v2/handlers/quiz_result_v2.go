@@ -3,11 +3,9 @@ package handlers
 import (
 	"encoding/json"
 	"log"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
 func HandleQuizResultV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -38,30 +36,48 @@ func HandleQuizResultV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 	log.Printf("📌 Fetching result for: %s, Quiz: %s (%s-%s-%s)", uid, quizName, className, subjectName, topic)
 
 	// Get quiz attempt using simple key lookup
-	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"uid":       {S: aws.String(uid)},
-			"quiz_name": {S: aws.String(quizName)},
-		},
-	})
-
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	attempt, err := GetAttempt(tenantID, uid, quizName)
 	if err != nil {
 		log.Printf("❌ Error fetching result: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
-	if result.Item == nil {
+	if attempt == nil {
 		return CreateErrorResponse(404, "Quiz result not found"), nil
 	}
 
-	var attempt AttemptItem
-	err = dynamodbattribute.UnmarshalMap(result.Item, &attempt)
+	// Compare with the class; practice and adaptive attempts have no class
+	// stats, and results of deleted quizzes are shown as stored
+	var rank *QuizRank
+	if !isPracticeAttempt(*attempt) {
+		quiz, err := GetQuizFromDynamoDB(tenantID, quizName, className, subjectName, topic)
+		if err != nil {
+			log.Printf("❌ Error fetching quiz: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
 
+		if quiz != nil {
+			stats, err := FetchItemStats(tenantID, quizName)
+			if err != nil {
+				log.Printf("⚠️ Error fetching item stats for %s: %v", quizName, err)
+			} else {
+				addClassComparison(attempt.Results, quiz, stats)
+			}
 
-	if err != nil {
-		log.Printf("❌ Error unmarshaling result: %v", err)
-		return CreateErrorResponse(500, "Internal Server Error"), nil
+			if answersHidden(quiz, time.Now()) {
+				hideAnswers(attempt.Results)
+			}
+		}
+
+		rank, err = quizRank(tenantID, quizName, uid)
+		if err != nil {
+			log.Printf("⚠️ Error ranking %s on %s: %v", uid, quizName, err)
+		}
 	}
 
 	response := map[string]interface{}{
@@ -75,6 +91,11 @@ func HandleQuizResultV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		"attemptNumber": attempt.AttemptNumber,
 		"attemptedAt":   attempt.AttemptedAt,
 		"results":       attempt.Results,
+		"rank":          rank,
+	}
+	if attempt.Ability != nil {
+		response["ability"] = *attempt.Ability
+		response["abilitySE"] = attempt.AbilitySE
 	}
 
 	responseJSON, _ := json.Marshal(response)
@@ -3,13 +3,10 @@ package handlers
 import (
 	"encoding/json"
 	"log"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -38,14 +35,49 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		return CreateErrorResponse(400, "Invalid JSON format"), nil
 	}
 
+	// Get user UID from context
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
 	log.Printf("📌 Processing quiz submission: %s for %s-%s-%s", quizName, className, subjectName, topic)
 
+	// Check subscription status and plan coverage
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+	if resp, denied := subscriptionDeniedResponse(student, className, subjectName); denied {
+		return resp, nil
+	}
+
 	// Get quiz data
-	quiz, err := GetQuizFromDynamoDB(quizName, className, subjectName, topic)
+	quiz, err := GetQuizFromDynamoDB(tenantID, quizName, className, subjectName, topic)
 	if err != nil || quiz == nil {
 		log.Printf("❌ Quiz not found: %v", err)
 		return CreateErrorResponse(404, "Quiz not found"), nil
 	}
+	if !canAccessQuiz(quiz, uid, time.Now()) {
+		return CreateErrorResponse(404, "Quiz not found"), nil
+	}
+	if quizClosed(quiz, time.Now()) {
+		return CreateErrorResponse(403, "Quiz is closed"), nil
+	}
+	practice := isPracticeQuiz(quiz)
+
+	if msg := validateTimeSpent(submitReq.Answers, quiz.Duration); msg != "" {
+		return CreateErrorResponse(400, msg), nil
+	}
 
 	// Create answer map for quick lookup
 	answerMap := make(map[int]Answer)
@@ -65,6 +97,7 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		
 		var status string
 		var studentAnswer []string
+		selectedOptions := []string{}
 		
 		// Check if question was skipped
 		if !hasAnswer || len(answer.Options) == 0 {
@@ -72,35 +105,7 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 			skippedCount++
 			studentAnswer = []string{}
 		} else {
-			// Parse correct answers (comma-separated)
-			correctAnswers := strings.Split(question.CorrectAnswer, ",")
-			for j := range correctAnswers {
-				correctAnswers[j] = strings.ToLower(strings.TrimSpace(correctAnswers[j]))
-			}
-			
-			// Trim and lowercase submitted options
-			trimmedOptions := make([]string, len(answer.Options))
-			for j, option := range answer.Options {
-				trimmedOptions[j] = strings.ToLower(strings.TrimSpace(option))
-			}
-			
-			// Check if submitted options match correct answers
-			isCorrect := len(trimmedOptions) == len(correctAnswers)
-			if isCorrect {
-				for _, option := range trimmedOptions {
-					found := false
-					for _, correct := range correctAnswers {
-						if option == correct {
-							found = true
-							break
-						}
-					}
-					if !found {
-						isCorrect = false
-						break
-					}
-				}
-			}
+			isCorrect := isAnswerCorrect(question, answer.Options)
 			
 			if isCorrect {
 				status = "correct"
@@ -112,6 +117,7 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 			
 			// Map student answer letters to actual text
 			for _, option := range answer.Options {
+				selectedOptions = append(selectedOptions, strings.ToUpper(strings.TrimSpace(option)))
 				switch strings.ToUpper(strings.TrimSpace(option)) {
 				case "A":
 					if len(question.AllAnswers) > 0 {
@@ -159,50 +165,31 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		}
 		
 		results = append(results, QuestionResult{
-			Qno:           qno,
-			Question:      question.Question,
-			Status:        status,
-			StudentAnswer: studentAnswer,
-			CorrectAnswer: correctAnswerText,
-			Explanation:   question.Explanation,
+			Qno:             qno,
+			Question:        question.Question,
+			Status:          status,
+			StudentAnswer:   studentAnswer,
+			CorrectAnswer:   correctAnswerText,
+			Explanation:     question.Explanation,
+			SelectedOptions: selectedOptions,
+			TimeSpentSec:    answer.TimeSpentSec,
+			AnswerChanges:   answer.AnswerChanges,
 		})
 	}
 
 	totalCount := len(quiz.Questions)
 	percentage := float64(correctCount) / float64(totalCount) * 100
 
-	// Get user UID from context
-	uid, err := GetUserUIDFromContext(request)
-	if err != nil {
-		return CreateErrorResponse(401, "Unauthorized"), nil
-	}
-
 	// Get existing attempt to increment attempt number
-	existingResult, _ := dynamoClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		Key: map[string]*dynamodb.AttributeValue{
-			"uid":       {S: aws.String(uid)},
-			"quiz_name": {S: aws.String(quizName)},
-		},
-	})
+	existingAttempt, _ := GetAttempt(tenantID, uid, quizName)
 
 	attemptNumber := 1
-	if existingResult.Item != nil {
+	if existingAttempt != nil {
 		// Delete existing record first
-		_, _ = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
-			TableName: aws.String("student_quiz_attempts_v2"),
-			Key: map[string]*dynamodb.AttributeValue{
-				"uid":       {S: aws.String(uid)},
-				"quiz_name": {S: aws.String(quizName)},
-			},
-		})
-		
+		_ = DeleteAttempt(uid, quizName)
+
 		// Increment attempt number
-		if attemptNum := existingResult.Item["attempt_number"]; attemptNum != nil && attemptNum.N != nil {
-			if num, err := strconv.Atoi(*attemptNum.N); err == nil {
-				attemptNumber = num + 1
-			}
-		}
+		attemptNumber = existingAttempt.AttemptNumber + 1
 	}
 
 	// Save new attempt with incremented count
@@ -211,6 +198,7 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		QuizName:      quizName,
 		ClassName:     quiz.ClassName,
 		Category:      quiz.SubjectName,
+		Topic:         quiz.Topic,
 		CorrectCount:  correctCount,
 		WrongCount:    wrongCount,
 		SkippedCount:  skippedCount,
@@ -221,12 +209,38 @@ func HandleQuizSubmitV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		Results:       results,
 	}
 
-	err = SaveAttemptToDynamoDB(attempt)
+	err = SaveAttemptToDynamoDB(tenantID, attempt)
 	if err != nil {
 		log.Printf("❌ Error saving attempt: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
+	// Item statistics are best effort and only count saved attempts. Practice
+	// quizzes reuse questions of other quizzes and are not counted.
+	if !practice {
+		if err := UpdateItemStats(tenantID, quiz, existingAttempt, attempt); err != nil {
+			log.Printf("⚠️ Error updating item stats for %s: %v", quizName, err)
+		} else if err := MarkAttemptStatsRecorded(attempt); err != nil {
+			log.Printf("⚠️ Error marking item stats recorded for %s: %v", quizName, err)
+		}
+	}
+
+	if !practice {
+		if err := UpdateLeaderboards(tenantID, student, attempt, time.Now()); err != nil {
+			log.Printf("⚠️ Error updating leaderboards for %s: %v", quizName, err)
+		}
+	}
+
+	if err := QueueWrongAnswers(tenantID, quiz, attempt, time.Now()); err != nil {
+		log.Printf("⚠️ Error queueing reviews for %s: %v", quizName, err)
+	}
+
+	// The stored attempt keeps the answers for when the quiz closes
+	if answersHidden(quiz, time.Now()) {
+		results = append([]QuestionResult(nil), results...)
+		hideAnswers(results)
+	}
+
 	response := map[string]interface{}{
 		"correctCount": correctCount,
 		"wrongCount":   wrongCount,
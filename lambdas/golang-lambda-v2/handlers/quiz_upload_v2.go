@@ -11,6 +11,7 @@ import (
 	"mime/multipart"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/xuri/excelize/v2"
@@ -41,6 +42,32 @@ func HandleQuizUploadV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		return CreateErrorResponse(400, "Invalid duration format"), nil
 	}
 
+	// Optional availability window; answers can only be hidden until it closes
+	availableUntil := queryParams["availableUntil"]
+	if _, ok := parseDueDate(availableUntil); availableUntil != "" && !ok {
+		return CreateErrorResponse(400, "Invalid availableUntil format"), nil
+	}
+	hideAnswers := queryParams["hideAnswers"] == "true"
+	if hideAnswers && availableUntil == "" {
+		return CreateErrorResponse(400, "hideAnswers requires availableUntil"), nil
+	}
+
+	// Optional version of the quiz being replaced, see version.go
+	expectedVersion, err := parseExpectedVersion(request)
+	if err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+
+	// Quizzes outside the taxonomy would never be listed to students
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if err := ValidateTaxonomy(tenantID, className, subjectName, topic); err != nil {
+		return taxonomyErrorResponse(err), nil
+	}
+
 	// Parse Content-Type and extract boundary
 	contentType := request.Headers["Content-Type"]
 	if contentType == "" {
@@ -94,16 +121,30 @@ func HandleQuizUploadV2(request events.APIGatewayProxyRequest) (events.APIGatewa
 		return CreateErrorResponse(500, fmt.Sprintf("Failed to process Excel file: %v", err)), nil
 	}
 
+	quizData.AvailableUntil = availableUntil
+	quizData.HideAnswers = hideAnswers
+
 	log.Printf("📌 Uploading quiz: %s", quizData.QuizName)
 
-	err = SaveQuizToDynamoDB(quizData)
+	// Link questions to the bank, reusing questions already in it
+	questionIDs, created, err := AddQuestionsToBank(tenantID, quizData, time.Now())
+	if err != nil {
+		log.Printf("❌ Error adding questions to bank: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	quizData.QuestionIDs = questionIDs
+
+	version, err := SaveQuizToDynamoDB(tenantID, quizData, expectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse("quiz"), nil
+	}
 	if err != nil {
 		log.Printf("❌ Error saving quiz: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
-	responseJSON := fmt.Sprintf(`{"message":"%s","quizName":"%s","className":"%s","subjectName":"%s","topic":"%s","duration":%v,"questionCount":%d}`,
-		"Quiz uploaded successfully", quizData.QuizName, quizData.ClassName, quizData.SubjectName, quizData.Topic, quizData.Duration, len(quizData.Questions))
+	responseJSON := fmt.Sprintf(`{"message":"%s","quizName":"%s","className":"%s","subjectName":"%s","topic":"%s","duration":%v,"questionCount":%d,"newQuestions":%d,"reusedQuestions":%d,"version":%d}`,
+		"Quiz uploaded successfully", quizData.QuizName, quizData.ClassName, quizData.SubjectName, quizData.Topic, quizData.Duration, len(quizData.Questions), created, len(questionIDs)-created, version)
 	return events.APIGatewayProxyResponse{
 		StatusCode: 201,
 		Headers:    GetCORSHeaders(),
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"strings"
+	"time"
+)
+
+type QuizRank struct {
+	Rank          int     `json:"rank"`
+	TotalStudents int     `json:"totalStudents"`
+	Percentile    float64 `json:"percentile"`
+}
+
+// quizClosed reports whether the quiz's availability window has ended. A
+// plain date closes at the end of that day.
+func quizClosed(quiz *QuizItem, now time.Time) bool {
+	until, ok := parseDueDate(quiz.AvailableUntil)
+	return ok && now.After(until)
+}
+
+// answersHidden reports whether results must leave out correct answers and
+// explanations for now
+func answersHidden(quiz *QuizItem, now time.Time) bool {
+	return quiz.HideAnswers && quiz.AvailableUntil != "" && !quizClosed(quiz, now)
+}
+
+// hideAnswers removes what gives the answers away from results
+func hideAnswers(results []QuestionResult) {
+	for i := range results {
+		results[i].CorrectAnswer = []string{}
+		results[i].Explanation = ""
+		results[i].MostChosenWrong = nil
+	}
+}
+
+// addClassComparison sets, per result, the share of the class answering it
+// correctly, the most chosen wrong option and the class median time
+func addClassComparison(results []QuestionResult, quiz *QuizItem, stats map[int]map[string]int) {
+	for i := range results {
+		result := &results[i]
+		counters := stats[result.Qno]
+		result.ClassMedianTimeSec = medianTimeSec(counters)
+		if counters["attempts"] > 0 {
+			percent := roundTo(float64(counters["correct"])/float64(counters["attempts"])*100, 1)
+			result.ClassCorrectPercent = &percent
+		}
+		if result.Qno >= 1 && result.Qno <= len(quiz.Questions) {
+			result.MostChosenWrong = mostChosenWrongOption(quiz.Questions[result.Qno-1], counters)
+		}
+	}
+}
+
+// mostChosenWrongOption returns the wrong option picked by most students, or
+// nil if no one picked a wrong option
+func mostChosenWrongOption(question Question, counters map[string]int) *OptionStat {
+	correctLetters := strings.Split(strings.ToUpper(question.CorrectAnswer), ",")
+	for i := range correctLetters {
+		correctLetters[i] = strings.TrimSpace(correctLetters[i])
+	}
+
+	var most *OptionStat
+	for i, text := range question.AllAnswers {
+		letter := optionLetter(i)
+		count := counters["opt_"+letter]
+		if containsString(correctLetters, letter) || count == 0 {
+			continue
+		}
+		if most == nil || count > most.Count {
+			most = &OptionStat{Option: letter, Text: text, Count: count}
+			if attempts := counters["attempts"]; attempts > 0 {
+				most.Frequency = roundTo(float64(count)/float64(attempts), 3)
+			}
+		}
+	}
+	return most
+}
+
+// quizRank returns the student's rank on the quiz leaderboard, or nil if the
+// student is not on it
+func quizRank(tenantID, quizName, uid string) (*QuizRank, error) {
+	entry, rank, total, err := LeaderboardRank(quizBoardID(tenantID, quizName), uid)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return &QuizRank{
+		Rank:          rank,
+		TotalStudents: total,
+		Percentile:    leaderboardPercentile(rank, total),
+	}, nil
+}
@@ -0,0 +1,256 @@
+package handlers
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// SM-2 scheduling constants
+const (
+	reviewInitialEase = 2.5
+	reviewMinimumEase = 1.3
+	reviewPassQuality = 3
+)
+
+// Review card structure, one per student and quiz question
+type ReviewCard struct {
+	UID            string  `json:"uid" dynamodbav:"uid"`
+	CardID         string  `json:"card_id" dynamodbav:"card_id"`
+	QuizName       string  `json:"quiz_name" dynamodbav:"quiz_name"`
+	ClassName      string  `json:"class_name" dynamodbav:"class_name"`
+	Category       string  `json:"category" dynamodbav:"category"`
+	Topic          string  `json:"topic" dynamodbav:"topic"`
+	Qno            int     `json:"qno" dynamodbav:"qno"`
+	QuestionID     string  `json:"question_id,omitempty" dynamodbav:"question_id,omitempty"`
+	EaseFactor     float64 `json:"ease_factor" dynamodbav:"ease_factor"`
+	IntervalDays   int     `json:"interval_days" dynamodbav:"interval_days"`
+	Repetitions    int     `json:"repetitions" dynamodbav:"repetitions"`
+	Lapses         int     `json:"lapses" dynamodbav:"lapses"`
+	DueAt          string  `json:"due_at" dynamodbav:"due_at"`
+	LastReviewedAt string  `json:"last_reviewed_at,omitempty" dynamodbav:"last_reviewed_at,omitempty"`
+	TenantID       string  `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+}
+
+// questionKey identifies a question of a quiz by its number
+func questionKey(quizName string, qno int) string {
+	return quizName + "#" + strconv.Itoa(qno)
+}
+
+// reviewCardID identifies a question of a quiz by its bank ID when it has one,
+// which survives the quiz being reordered, otherwise by its number
+func reviewCardID(quizName, questionID string, qno int) string {
+	if questionID != "" {
+		return quizName + "#" + questionID
+	}
+	return questionKey(quizName, qno)
+}
+
+// quizQuestionID returns the bank ID of a quiz question, or "" for questions
+// that are not in the bank
+func quizQuestionID(quiz *QuizItem, qno int) string {
+	if len(quiz.QuestionIDs) != len(quiz.Questions) || qno < 1 || qno > len(quiz.QuestionIDs) {
+		return ""
+	}
+	return quiz.QuestionIDs[qno-1]
+}
+
+// reviewQuestionNumber finds a card's question in its quiz, by bank ID when
+// the card has one
+func reviewQuestionNumber(quiz *QuizItem, card ReviewCard) (int, bool) {
+	if quiz == nil {
+		return 0, false
+	}
+	if card.QuestionID != "" {
+		for qno := 1; qno <= len(quiz.Questions); qno++ {
+			if quizQuestionID(quiz, qno) == card.QuestionID {
+				return qno, true
+			}
+		}
+		return 0, false
+	}
+	return card.Qno, card.Qno >= 1 && card.Qno <= len(quiz.Questions)
+}
+
+// isAnswerCorrect compares submitted option letters with the question's
+// comma-separated correct letters, ignoring case, spacing and order
+func isAnswerCorrect(question Question, options []string) bool {
+	correctAnswers := strings.Split(question.CorrectAnswer, ",")
+	if len(options) != len(correctAnswers) {
+		return false
+	}
+	for i := range correctAnswers {
+		correctAnswers[i] = strings.ToLower(strings.TrimSpace(correctAnswers[i]))
+	}
+	for _, option := range options {
+		if !containsString(correctAnswers, strings.ToLower(strings.TrimSpace(option))) {
+			return false
+		}
+	}
+	return true
+}
+
+// correctAnswerText maps the question's correct letters to the answer text
+func correctAnswerText(question Question) []string {
+	return optionsText(question, strings.Split(question.CorrectAnswer, ","))
+}
+
+// optionsText maps option letters to the answer text, skipping unknown letters
+func optionsText(question Question, letters []string) []string {
+	text := []string{}
+	for _, letter := range letters {
+		letter = strings.ToUpper(strings.TrimSpace(letter))
+		if len(letter) != 1 {
+			continue
+		}
+		if index := int(letter[0] - 'A'); index >= 0 && index < len(question.AllAnswers) {
+			text = append(text, question.AllAnswers[index])
+		}
+	}
+	return text
+}
+
+// ScheduleReview applies an SM-2 review with quality 0-5 to a card
+func ScheduleReview(card *ReviewCard, quality int, now time.Time) {
+	if card.EaseFactor == 0 {
+		card.EaseFactor = reviewInitialEase
+	}
+
+	if quality < reviewPassQuality {
+		if card.Repetitions > 0 {
+			card.Lapses++
+		}
+		card.Repetitions = 0
+		card.IntervalDays = 1
+	} else {
+		card.Repetitions++
+		switch card.Repetitions {
+		case 1:
+			card.IntervalDays = 1
+		case 2:
+			card.IntervalDays = 6
+		default:
+			card.IntervalDays = int(math.Round(float64(card.IntervalDays) * card.EaseFactor))
+		}
+	}
+
+	miss := float64(5 - quality)
+	card.EaseFactor = math.Max(reviewMinimumEase, card.EaseFactor+0.1-miss*(0.08+miss*0.02))
+	card.EaseFactor = roundTo(card.EaseFactor, 2)
+	card.LastReviewedAt = now.UTC().Format(subExpDateLayout)
+	card.DueAt = now.UTC().AddDate(0, 0, card.IntervalDays).Format(subExpDateLayout)
+}
+
+// QueueWrongAnswers adds wrong and skipped questions of an attempt to the
+// student's review queue. Questions already queued are due again immediately
+// and lose ease, as a failed review would. Practice questions are queued
+// under the quiz they were taken from.
+func QueueWrongAnswers(tenantID string, quiz *QuizItem, attempt AttemptItem, now time.Time) error {
+	for _, result := range attempt.Results {
+		if result.Status != "wrong" && result.Status != "skipped" {
+			continue
+		}
+
+		source := questionSource(quiz, result.Qno)
+		questionID := quizQuestionID(quiz, result.Qno)
+		cardID := reviewCardID(source.QuizName, questionID, source.Qno)
+		card, err := GetReviewCard(attempt.UID, cardID)
+		if err != nil {
+			return err
+		}
+		if card == nil {
+			card = &ReviewCard{
+				UID:        attempt.UID,
+				CardID:     cardID,
+				QuizName:   source.QuizName,
+				ClassName:  source.ClassName,
+				Category:   source.SubjectName,
+				Topic:      source.Topic,
+				Qno:        source.Qno,
+				QuestionID: questionID,
+				EaseFactor: reviewInitialEase,
+			}
+		} else {
+			ScheduleReview(card, 0, now)
+		}
+		card.DueAt = now.UTC().Format(subExpDateLayout)
+
+		if err := SaveReviewCard(tenantID, *card); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save review card to DynamoDB
+func SaveReviewCard(tenantID string, card ReviewCard) error {
+	card.TenantID = normalizeTenantID(tenantID)
+	av, err := dynamodbattribute.MarshalMap(card)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("review_queue"),
+		Item:      av,
+	})
+	return err
+}
+
+// Get a student's review card
+func GetReviewCard(uid, cardID string) (*ReviewCard, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("review_queue"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"uid":     {S: aws.String(uid)},
+			"card_id": {S: aws.String(cardID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var card ReviewCard
+	err = dynamodbattribute.UnmarshalMap(result.Item, &card)
+	return &card, err
+}
+
+// Visit a student's cards due by now, oldest first, using the due GSI, until
+// visit returns false
+func FetchDueReviewCards(uid string, now time.Time, pageSize int, visit func(card ReviewCard) bool) error {
+	var unmarshalErr error
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("review_queue"),
+		IndexName:              aws.String("uid-due-index"),
+		KeyConditionExpression: aws.String("uid = :uid AND due_at <= :now"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+			":now": {S: aws.String(now.UTC().Format(subExpDateLayout))},
+		},
+		Limit: aws.Int64(int64(pageSize)),
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var cards []ReviewCard
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &cards); unmarshalErr != nil {
+			return false
+		}
+		for _, card := range cards {
+			if !visit(card) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return unmarshalErr
+}
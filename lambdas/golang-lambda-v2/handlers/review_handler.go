@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultReviewLimit = 20
+	maxReviewLimit     = 100
+)
+
+type ReviewAnswerRequest struct {
+	CardID  string   `json:"cardId"`
+	Options []string `json:"options"`
+	// Optional self-rating 0-5; defaults to 4 when correct and 1 when wrong
+	Quality *int `json:"quality,omitempty"`
+}
+
+type DueReview struct {
+	CardID      string   `json:"cardId"`
+	QuizName    string   `json:"quizName"`
+	ClassName   string   `json:"className"`
+	SubjectName string   `json:"subjectName"`
+	Topic       string   `json:"topic"`
+	Qno         int      `json:"qno"`
+	Question    string   `json:"question"`
+	AllAnswers  []string `json:"allAnswers"`
+	DueAt       string   `json:"dueAt"`
+	Repetitions int      `json:"repetitions"`
+}
+
+// HandleDueReviews returns the caller's review questions due today across quizzes
+func HandleDueReviews(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	limit := defaultReviewLimit
+	if limitStr := request.QueryStringParameters["limit"]; limitStr != "" {
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit <= 0 || limit > maxReviewLimit {
+			return CreateErrorResponse(400, "'limit' must be between 1 and 100"), nil
+		}
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	// Cards whose question cannot be shown are skipped, not counted, so keep
+	// reading until the limit is reached
+	now := time.Now()
+	quizzes := make(map[string]*QuizItem)
+	reviews := []DueReview{}
+	var quizErr error
+	err = FetchDueReviewCards(uid, now, limit, func(card ReviewCard) bool {
+		quiz, cached := quizzes[card.QuizName]
+		if !cached {
+			quiz, quizErr = GetQuizByName(tenantID, card.QuizName)
+			if quizErr != nil {
+				return false
+			}
+			quizzes[card.QuizName] = quiz
+		}
+
+		// The quiz was deleted or the question removed since the card was
+		// queued; the card is kept in case the quiz comes back
+		qno, ok := reviewQuestionNumber(quiz, card)
+		if !ok {
+			return true
+		}
+
+		// Keep the card until the quiz reveals its answers
+		if answersHidden(quiz, now) {
+			return true
+		}
+
+		question := quiz.Questions[qno-1]
+		reviews = append(reviews, DueReview{
+			CardID:      card.CardID,
+			QuizName:    card.QuizName,
+			ClassName:   quiz.ClassName,
+			SubjectName: quiz.SubjectName,
+			Topic:       quiz.Topic,
+			Qno:         qno,
+			Question:    question.Question,
+			AllAnswers:  question.AllAnswers,
+			DueAt:       card.DueAt,
+			Repetitions: card.Repetitions,
+		})
+		return len(reviews) < limit
+	})
+	if quizErr != nil {
+		log.Printf("❌ Error fetching quiz: %v", quizErr)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if err != nil {
+		log.Printf("❌ Error fetching due reviews: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	response := map[string]interface{}{
+		"uid":     uid,
+		"reviews": reviews,
+		"count":   len(reviews),
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleReviewAnswer grades a review answer and reschedules the card
+func HandleReviewAnswer(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	var req ReviewAnswerRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid JSON format"), nil
+	}
+	if req.CardID == "" {
+		return CreateErrorResponse(400, "Missing 'cardId' parameter"), nil
+	}
+	if req.Quality != nil && (*req.Quality < 0 || *req.Quality > 5) {
+		return CreateErrorResponse(400, "'quality' must be between 0 and 5"), nil
+	}
+
+	card, err := GetReviewCard(uid, req.CardID)
+	if err != nil {
+		log.Printf("❌ Error fetching review card: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if card == nil {
+		return CreateErrorResponse(404, "Review card not found"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	quiz, err := GetQuizByName(tenantID, card.QuizName)
+	if err != nil {
+		log.Printf("❌ Error fetching quiz: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	qno, ok := reviewQuestionNumber(quiz, *card)
+	if !ok {
+		return CreateErrorResponse(404, "Question no longer exists"), nil
+	}
+
+	if answersHidden(quiz, time.Now()) {
+		return CreateErrorResponse(403, "Answers are hidden until the quiz closes"), nil
+	}
+
+	question := quiz.Questions[qno-1]
+	correct := len(req.Options) > 0 && isAnswerCorrect(question, req.Options)
+
+	quality := 1
+	if len(req.Options) == 0 {
+		quality = 0
+	} else if correct {
+		quality = 4
+	}
+	// A self-rating can fine-tune the grade but not pass a wrong answer
+	if req.Quality != nil && (correct || *req.Quality < reviewPassQuality) {
+		quality = *req.Quality
+	}
+
+	card.Qno = qno
+	ScheduleReview(card, quality, time.Now())
+	if err := SaveReviewCard(tenantID, *card); err != nil {
+		log.Printf("❌ Error saving review card: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	response := map[string]interface{}{
+		"cardId":        card.CardID,
+		"correct":       correct,
+		"quality":       quality,
+		"correctAnswer": correctAnswerText(question),
+		"explanation":   question.Explanation,
+		"nextDueAt":     card.DueAt,
+		"intervalDays":  card.IntervalDays,
+		"easeFactor":    card.EaseFactor,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
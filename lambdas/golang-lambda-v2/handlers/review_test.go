@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleReview(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		card    ReviewCard
+		quality int
+		want    ReviewCard
+	}{
+		{
+			name:    "new card, perfect answer",
+			card:    ReviewCard{},
+			quality: 5,
+			want:    ReviewCard{EaseFactor: 2.6, IntervalDays: 1, Repetitions: 1},
+		},
+		{
+			name:    "second pass",
+			card:    ReviewCard{EaseFactor: 2.6, IntervalDays: 1, Repetitions: 1},
+			quality: 4,
+			want:    ReviewCard{EaseFactor: 2.6, IntervalDays: 6, Repetitions: 2},
+		},
+		{
+			name:    "third pass multiplies by the ease",
+			card:    ReviewCard{EaseFactor: 2.6, IntervalDays: 6, Repetitions: 2},
+			quality: 4,
+			want:    ReviewCard{EaseFactor: 2.6, IntervalDays: 16, Repetitions: 3},
+		},
+		{
+			name:    "hard pass lowers the ease",
+			card:    ReviewCard{EaseFactor: 2.5, IntervalDays: 6, Repetitions: 2},
+			quality: 3,
+			want:    ReviewCard{EaseFactor: 2.36, IntervalDays: 15, Repetitions: 3},
+		},
+		{
+			name:    "lapse resets the repetitions",
+			card:    ReviewCard{EaseFactor: 2.5, IntervalDays: 16, Repetitions: 3},
+			quality: 1,
+			want:    ReviewCard{EaseFactor: 1.96, IntervalDays: 1, Repetitions: 0, Lapses: 1},
+		},
+		{
+			name:    "failing a new card is not a lapse",
+			card:    ReviewCard{},
+			quality: 2,
+			want:    ReviewCard{EaseFactor: 2.18, IntervalDays: 1, Repetitions: 0},
+		},
+		{
+			name:    "ease stops at the minimum",
+			card:    ReviewCard{EaseFactor: 1.4, IntervalDays: 1, Repetitions: 1, Lapses: 2},
+			quality: 0,
+			want:    ReviewCard{EaseFactor: reviewMinimumEase, IntervalDays: 1, Repetitions: 0, Lapses: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := tt.card
+			ScheduleReview(&card, tt.quality, now)
+			if card.EaseFactor != tt.want.EaseFactor || card.IntervalDays != tt.want.IntervalDays ||
+				card.Repetitions != tt.want.Repetitions || card.Lapses != tt.want.Lapses {
+				t.Errorf("got ease %v, interval %d, repetitions %d, lapses %d; want ease %v, interval %d, repetitions %d, lapses %d",
+					card.EaseFactor, card.IntervalDays, card.Repetitions, card.Lapses,
+					tt.want.EaseFactor, tt.want.IntervalDays, tt.want.Repetitions, tt.want.Lapses)
+			}
+			wantDue := now.AddDate(0, 0, tt.want.IntervalDays).Format(subExpDateLayout)
+			if card.DueAt != wantDue || card.LastReviewedAt != now.Format(subExpDateLayout) {
+				t.Errorf("got due %s, reviewed %s; want due %s", card.DueAt, card.LastReviewedAt, wantDue)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	googleTokenURL       = "https://oauth2.googleapis.com/token"
+	identityToolkitURL   = "https://identitytoolkit.googleapis.com/v1/projects/"
+	identityToolkitScope = "https://www.googleapis.com/auth/identitytoolkit"
+)
+
+// FirebaseClaimSource sets custom claims through the Identity Toolkit API,
+// the REST API behind the Admin SDK's setCustomUserClaims
+type FirebaseClaimSource struct {
+	ProjectID   string
+	ClientEmail string
+	key         *rsa.PrivateKey
+	client      *http.Client
+
+	mu          sync.Mutex
+	accessToken string
+	expires     time.Time
+}
+
+// NewFirebaseClaimSource takes the service account's PEM private key; literal
+// \n sequences are accepted as in the authorizer's environment
+func NewFirebaseClaimSource(projectID, clientEmail, privateKeyPEM string) (*FirebaseClaimSource, error) {
+	block, _ := pem.Decode([]byte(strings.ReplaceAll(privateKeyPEM, `\n`, "\n")))
+	if block == nil {
+		return nil, fmt.Errorf("private key is not PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+	return &FirebaseClaimSource{
+		ProjectID:   projectID,
+		ClientEmail: clientEmail,
+		key:         key,
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}, nil
+}
+
+// SetRoleClaim replaces the role claims and keeps the user's other custom
+// claims, since Firebase overwrites all of them at once
+func (s *FirebaseClaimSource) SetRoleClaim(uid, tenantID, role string) error {
+	var lookup struct {
+		Users []struct {
+			CustomAttributes string `json:"customAttributes"`
+		} `json:"users"`
+	}
+	if err := s.call("accounts:lookup", map[string]interface{}{"localId": []string{uid}}, &lookup); err != nil {
+		return err
+	}
+	if len(lookup.Users) == 0 {
+		return fmt.Errorf("no Firebase user %s", uid)
+	}
+
+	claims := map[string]interface{}{}
+	if attributes := lookup.Users[0].CustomAttributes; attributes != "" {
+		if err := json.Unmarshal([]byte(attributes), &claims); err != nil {
+			return fmt.Errorf("invalid custom claims of %s: %w", uid, err)
+		}
+	}
+	claims["role"] = role
+	claims["role_tenant"] = tenantID
+	attributes, _ := json.Marshal(claims)
+
+	return s.call("accounts:update", map[string]interface{}{
+		"localId":          uid,
+		"customAttributes": string(attributes),
+	}, nil)
+}
+
+// call posts to an Identity Toolkit accounts method of the project
+func (s *FirebaseClaimSource) call(method string, body interface{}, out interface{}) error {
+	token, err := s.token()
+	if err != nil {
+		return err
+	}
+
+	payload, _ := json.Marshal(body)
+	req, err := http.NewRequest("POST", identityToolkitURL+s.ProjectID+"/"+method, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", method, resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// token returns a cached OAuth access token for the service account
+func (s *FirebaseClaimSource) token() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.accessToken != "" && now.Before(s.expires) {
+		return s.accessToken, nil
+	}
+
+	assertion, err := SignJWT(s.key, "", map[string]interface{}{
+		"iss":   s.ClientEmail,
+		"scope": identityToolkitScope,
+		"aud":   googleTokenURL,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := s.client.PostForm(googleTokenURL, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token request returned %s", resp.Status)
+	}
+
+	var result struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	s.accessToken = result.AccessToken
+	// Renew a minute early
+	s.expires = now.Add(time.Duration(result.ExpiresIn)*time.Second - time.Minute)
+	return s.accessToken, nil
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type UserRoleRequest struct {
+	UID  string `json:"uid"`
+	Role string `json:"role"`
+}
+
+// HandleUserRoleSet changes a user's role within the caller's tenant. Only a
+// super may grant or take away the super role.
+func HandleUserRoleSet(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userRole, err := CheckAdminRole(request)
+	if err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var req UserRoleRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.UID == "" {
+		return CreateErrorResponse(400, "Missing 'uid'"), nil
+	}
+	if !containsString(Roles, req.Role) {
+		return CreateErrorResponse(400, fmt.Sprintf("Invalid 'role', expected one of %s", strings.Join(Roles, ", "))), nil
+	}
+
+	currentRole, err := storedRole(tenantID, req.UID)
+	if err != nil {
+		log.Printf("❌ Error fetching role of %s: %v", req.UID, err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if (req.Role == "super" || currentRole == "super") && userRole != "super" {
+		return CreateErrorResponse(403, "Only 'super' role can grant or revoke 'super'"), nil
+	}
+
+	log.Printf("📌 Setting role of %s from %s to %s", req.UID, currentRole, req.Role)
+	err = SetUserRole(tenantID, req.UID, req.Role)
+	if errors.Is(err, ErrStudentNotFound) {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+	if errors.Is(err, ErrRoleClaimNotUpdated) {
+		// The claim outranks students_info, so a stale one would keep the user
+		// at their old role; make the caller retry
+		log.Printf("❌ Error updating role claim: %v", err)
+		return CreateErrorResponse(502, "Role saved but the sign-in claim could not be updated; please retry"), nil
+	}
+	if err != nil {
+		log.Printf("❌ Error setting role: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"message": "Role updated successfully",
+		"uid":     req.UID,
+		"role":    req.Role,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
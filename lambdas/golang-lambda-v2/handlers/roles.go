@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// A caller's role comes from the role custom claim of their verified token
+// when its role_tenant claim names the caller's tenant. Otherwise it comes from
+// their students_info record, cached for ROLE_CACHE_TTL_SECONDS. SetUserRole
+// updates both and drops the cached entry; a changed claim reaches the caller
+// with their next token refresh, until which the old claim stands.
+
+const defaultRoleCacheTTL = time.Minute
+
+var Roles = []string{"student", "teacher", "admin", "super"}
+
+type roleCacheEntry struct {
+	role    string
+	expires time.Time
+}
+
+var (
+	roleCache   = map[string]roleCacheEntry{}
+	roleCacheMu sync.Mutex
+)
+
+// getRoleCacheTTL reads ROLE_CACHE_TTL_SECONDS; 0 disables the cache
+func getRoleCacheTTL() time.Duration {
+	seconds, err := strconv.Atoi(os.Getenv("ROLE_CACHE_TTL_SECONDS"))
+	if err != nil || seconds < 0 {
+		return defaultRoleCacheTTL
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+func roleCacheKey(tenantID, uid string) string {
+	return normalizeTenantID(tenantID) + "#" + uid
+}
+
+// InvalidateCachedRole drops a user's cached role so the next request reads
+// students_info again
+func InvalidateCachedRole(tenantID, uid string) {
+	roleCacheMu.Lock()
+	defer roleCacheMu.Unlock()
+	delete(roleCache, roleCacheKey(tenantID, uid))
+}
+
+// InvalidateRoleCache drops every cached role
+func InvalidateRoleCache() {
+	roleCacheMu.Lock()
+	defer roleCacheMu.Unlock()
+	roleCache = map[string]roleCacheEntry{}
+}
+
+// roleFromClaim returns the role claim the authorizer passed on, if it names
+// a known role granted in the caller's tenant
+func roleFromClaim(request events.APIGatewayProxyRequest, tenantID string) (string, bool) {
+	if request.RequestContext.Authorizer == nil {
+		return "", false
+	}
+	role, _ := request.RequestContext.Authorizer["role"].(string)
+	roleTenant, _ := request.RequestContext.Authorizer["role_tenant"].(string)
+	if !containsString(Roles, role) || roleTenant == "" {
+		return "", false
+	}
+	if normalizeTenantID(roleTenant) != normalizeTenantID(tenantID) {
+		return "", false
+	}
+	return role, true
+}
+
+// storedRole returns a user's role from students_info through the cache. A
+// user without a record in the tenant is a student; a failed read is an
+// error rather than a silent downgrade.
+func storedRole(tenantID, uid string) (string, error) {
+	key := roleCacheKey(tenantID, uid)
+	now := time.Now()
+
+	roleCacheMu.Lock()
+	entry, ok := roleCache[key]
+	roleCacheMu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.role, nil
+	}
+
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		return "", fmt.Errorf("resolving role: %w", err)
+	}
+	role := "student"
+	if student != nil {
+		if roleStr, ok := student.Role.(string); ok && roleStr != "" {
+			role = roleStr
+		}
+	}
+
+	if ttl := getRoleCacheTTL(); ttl > 0 {
+		roleCacheMu.Lock()
+		roleCache[key] = roleCacheEntry{role: role, expires: now.Add(ttl)}
+		roleCacheMu.Unlock()
+	}
+	return role, nil
+}
+
+// SetUserRole stores a user's role in students_info and in their token claims
+func SetUserRole(tenantID, uid, role string) error {
+	if !containsString(Roles, role) {
+		return fmt.Errorf("unknown role %q", role)
+	}
+
+	values := map[string]*dynamodb.AttributeValue{
+		":role": {S: aws.String(role)},
+	}
+	condition := "attribute_exists(uid) AND " + tenantCondition(tenantID, values)
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String("students_info"),
+		Key:                       map[string]*dynamodb.AttributeValue{"uid": {S: aws.String(uid)}},
+		UpdateExpression:          aws.String("SET #role = :role"),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  map[string]*string{"#role": aws.String("role")},
+		ExpressionAttributeValues: values,
+	})
+	if isConditionFailure(err) {
+		return ErrStudentNotFound
+	}
+	if err != nil {
+		return err
+	}
+	InvalidateCachedRole(tenantID, uid)
+
+	if err := GetRoleClaimSource().SetRoleClaim(uid, normalizeTenantID(tenantID), role); err != nil {
+		return fmt.Errorf("%w: %v", ErrRoleClaimNotUpdated, err)
+	}
+	return nil
+}
+
+var (
+	ErrStudentNotFound     = errors.New("student not found")
+	ErrRoleClaimNotUpdated = errors.New("role saved but token claim not updated")
+)
+
+// RoleClaimSource keeps the role and role_tenant custom claims of a user's
+// tokens in sync
+type RoleClaimSource interface {
+	SetRoleClaim(uid, tenantID, role string) error
+}
+
+// Used when no service account is configured: tokens carry no role claim,
+// so roles are only read from students_info
+type noRoleClaimSource struct{}
+
+func (noRoleClaimSource) SetRoleClaim(uid, tenantID, role string) error {
+	log.Printf("⚠️ No Firebase service account configured; role of %s kept in students_info only", uid)
+	return nil
+}
+
+var (
+	roleClaimSource     RoleClaimSource
+	roleClaimSourceOnce sync.Once
+)
+
+// GetRoleClaimSource uses the Firebase service account in FIREBASE_PROJECT_ID,
+// FIREBASE_CLIENT_EMAIL and FIREBASE_PRIVATE_KEY, like the Node authorizer
+func GetRoleClaimSource() RoleClaimSource {
+	roleClaimSourceOnce.Do(func() {
+		projectID := os.Getenv("FIREBASE_PROJECT_ID")
+		clientEmail := os.Getenv("FIREBASE_CLIENT_EMAIL")
+		privateKey := os.Getenv("FIREBASE_PRIVATE_KEY")
+		if projectID == "" || clientEmail == "" || privateKey == "" {
+			roleClaimSource = noRoleClaimSource{}
+			return
+		}
+		source, err := NewFirebaseClaimSource(projectID, clientEmail, privateKey)
+		if err != nil {
+			log.Printf("❌ Invalid Firebase service account: %v", err)
+			roleClaimSource = noRoleClaimSource{}
+			return
+		}
+		roleClaimSource = source
+	})
+	return roleClaimSource
+}
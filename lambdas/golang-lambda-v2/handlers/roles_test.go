@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestRoleFromClaim(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorizer map[string]interface{}
+		wantRole   string
+		wantOK     bool
+	}{
+		{"granted in the caller's tenant", map[string]interface{}{"tenant_id": "t1", "role": "admin", "role_tenant": "t1"}, "admin", true},
+		{"granted in another tenant", map[string]interface{}{"tenant_id": "t2", "role": "admin", "role_tenant": "t1"}, "admin", false},
+		{"granted in the default tenant", map[string]interface{}{"tenant_id": DefaultTenantID, "role": "super", "role_tenant": DefaultTenantID}, "super", true},
+		{"claim without tenant", map[string]interface{}{"tenant_id": "t1", "role": "admin"}, "", false},
+		{"unknown role", map[string]interface{}{"tenant_id": "t1", "role": "owner", "role_tenant": "t1"}, "", false},
+		{"no claims", nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request events.APIGatewayProxyRequest
+			request.RequestContext.Authorizer = tt.authorizer
+			tenantID, err := GetTenantFromContext(request)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			role, ok := roleFromClaim(request, tenantID)
+			if ok != tt.wantOK || (ok && role != tt.wantRole) {
+				t.Errorf("got %q, %v; want %q, %v", role, ok, tt.wantRole, tt.wantOK)
+			}
+		})
+	}
+}
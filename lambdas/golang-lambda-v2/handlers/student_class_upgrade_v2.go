@@ -2,11 +2,11 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 type ClassUpgradeRequest struct {
@@ -35,7 +35,12 @@ func HandleStudentClassUpgradeV2(request events.APIGatewayProxyRequest) (events.
 	log.Printf("📌 Upgrading class for student: %s to %s", userUID, upgradeRequest.NewClass)
 
 	// Get existing student
-	student, err := GetStudentInfoByUID(userUID)
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, userUID)
 	if err != nil {
 		log.Printf("❌ Error fetching student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -45,53 +50,28 @@ func HandleStudentClassUpgradeV2(request events.APIGatewayProxyRequest) (events.
 		return CreateErrorResponse(404, "Student not found"), nil
 	}
 
-	currentClass := student.StudentClass
 	newClass := upgradeRequest.NewClass
 
-	// Validate upgrade path
-	if !isValidUpgrade(currentClass, newClass) {
+	// Attempts of the old class are archived as history, see class_upgrade.go
+	event, err := UpgradeStudentClass(tenantID, student, newClass, "", time.Now())
+	if errors.Is(err, ErrInvalidUpgrade) {
 		return CreateErrorResponse(400, "Invalid class upgrade path"), nil
 	}
-
-	// Delete all quiz attempts for this student
-	log.Printf("🗑️ Deleting all quiz attempts for student: %s", userUID)
-	queryResult, err := dynamoClient.Query(&dynamodb.QueryInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		KeyConditionExpression: aws.String("uid = :uid"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":uid": {S: aws.String(userUID)},
-		},
-	})
-
-	if err == nil {
-		for _, item := range queryResult.Items {
-			if quizName := item["quiz_name"]; quizName != nil && quizName.S != nil {
-				_, _ = dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
-					TableName: aws.String("student_quiz_attempts_v2"),
-					Key: map[string]*dynamodb.AttributeValue{
-						"uid": {S: aws.String(userUID)},
-						"quiz_name": {S: quizName.S},
-					},
-				})
-			}
-		}
+	if errors.Is(err, ErrUpgradeConflict) {
+		return CreateErrorResponse(409, err.Error()), nil
 	}
-
-	// Update student class
-	student.StudentClass = newClass
-
-	// Save updated student
-	err = SaveStudentInfoToDynamoDB(*student)
 	if err != nil {
-		log.Printf("❌ Error updating student: %v", err)
+		log.Printf("❌ Error upgrading student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
 
 	response := map[string]interface{}{
-		"message":     "Class upgraded successfully",
-		"uid":         student.UID,
-		"oldClass":    currentClass,
-		"newClass":    newClass,
+		"message":          "Class upgraded successfully",
+		"uid":              student.UID,
+		"oldClass":         event.OldClass,
+		"newClass":         event.NewClass,
+		"upgradedAt":       event.UpgradedAt,
+		"attemptsArchived": event.AttemptsArchived,
 	}
 
 	responseJSON, _ := json.Marshal(response)
@@ -101,32 +81,3 @@ func HandleStudentClassUpgradeV2(request events.APIGatewayProxyRequest) (events.
 		Body:       string(responseJSON),
 	}, nil
 }
-
-func getUpgradableClasses(currentClass string) []string {
-	validUpgrades := map[string][]string{
-		"CLS6":       {"CLS7"},
-		"CLS7":       {"CLS8"},
-		"CLS8":       {"CLS9"},
-		"CLS9":       {"CLS10"},
-		"CLS10":      {"CLS11-MPC", "CLS11-BIPC"},
-		"CLS11-MPC":  {"CLS12-MPC"},
-		"CLS11-BIPC": {"CLS12-BIPC"},
-	}
-
-	allowedUpgrades, exists := validUpgrades[currentClass]
-	if !exists {
-		return []string{}
-	}
-
-	return allowedUpgrades
-}
-
-func isValidUpgrade(currentClass, newClass string) bool {
-	upgradableClasses := getUpgradableClasses(currentClass)
-	for _, allowed := range upgradableClasses {
-		if newClass == allowed {
-			return true
-		}
-	}
-	return false
-}
\ No newline at end of file
@@ -22,7 +22,12 @@ func HandleStudentGetProfile(request events.APIGatewayProxyRequest) (events.APIG
 
 	log.Printf("📌 Fetching student: %s", userUID)
 
-	student, err := GetStudentInfoByUID(userUID)
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, userUID)
 	if err != nil {
 		log.Printf("❌ Error fetching student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -82,16 +87,9 @@ func HandleStudentGetProfile(request events.APIGatewayProxyRequest) (events.APIG
 	}
 
 	// Calculate payment status with proper expiration check
-	if student.SubExpDate != nil {
-		if subExpStr, ok := student.SubExpDate.(string); ok && subExpStr != "" {
-			if subExpTime, err := time.Parse(time.RFC3339, subExpStr); err == nil {
-				if subExpTime.After(time.Now()) {
-					studentData["payment_status"] = "PAID"
-				} else {
-					studentData["payment_status"] = "EXPIRED"
-				}
-			}
-		}
+	studentData["payment_status"] = GetPaymentStatus(student, time.Now())
+	if student.PlanID != "" {
+		studentData["plan_id"] = student.PlanID
 	}
 
 	// Add subjects like v1 using VALID_CATEGORIES
@@ -103,7 +101,7 @@ func HandleStudentGetProfile(request events.APIGatewayProxyRequest) (events.APIG
 	}
 
 	// Add upgradable classes
-	studentData["upgradable_classes"] = getUpgradableClasses(student.StudentClass)
+	studentData["upgradable_classes"] = getUpgradableClasses(tenantID, student.StudentClass)
 
 	responseJSON, _ := json.Marshal(studentData)
 	return events.APIGatewayProxyResponse{
@@ -7,9 +7,6 @@ import (
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
 )
 
 func HandleStudentLookup(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -29,23 +26,18 @@ func HandleStudentLookup(request events.APIGatewayProxyRequest) (events.APIGatew
 	log.Printf("🔍 Looking up student: %s", identifier)
 
 	var student *StudentInfoItem
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
 
 	// Try email lookup first
 	if strings.Contains(identifier, "@") {
-		student, err = GetStudentInfoByEmail(identifier)
+		student, err = GetStudentInfoByEmail(tenantID, identifier)
 	} else {
 		// Phone number lookup - scan table
-		result, err := dynamoClient.Scan(&dynamodb.ScanInput{
-			TableName:        aws.String("students_info"),
-			FilterExpression: aws.String("phone_number = :phone"),
-			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-				":phone": {S: aws.String(identifier)},
-			},
-		})
-		if err == nil && len(result.Items) > 0 {
-			student = &StudentInfoItem{}
-			err = dynamodbattribute.UnmarshalMap(result.Items[0], student)
-		}
+		student, err = FindStudentInfoByPhone(tenantID, identifier)
 	}
 
 	if err != nil {
@@ -58,8 +50,8 @@ func HandleStudentLookup(request events.APIGatewayProxyRequest) (events.APIGatew
 	}
 
 	// Get subjects for student class
-	subjects, _ := FetchSubjects(student.StudentClass)
-	upgradableClasses := getUpgradableClasses(student.StudentClass)
+	subjects, _ := FetchSubjects(tenantID, student.StudentClass)
+	upgradableClasses := getUpgradableClasses(tenantID, student.StudentClass)
 
 	studentData := map[string]interface{}{
 		"id":                1,
@@ -74,16 +66,10 @@ func HandleStudentLookup(request events.APIGatewayProxyRequest) (events.APIGatew
 
 	if student.SubExpDate != nil {
 		studentData["sub_exp_date"] = student.SubExpDate
-		// Check if subscription is not expired
-		if subExpStr, ok := student.SubExpDate.(string); ok {
-			if subExpTime, err := time.Parse(time.RFC3339, subExpStr); err == nil {
-				if subExpTime.After(time.Now()) {
-					studentData["payment_status"] = "PAID"
-				} else {
-					studentData["payment_status"] = "EXPIRED"
-				}
-			}
-		}
+		studentData["payment_status"] = GetPaymentStatus(student, time.Now())
+	}
+	if student.PlanID != "" {
+		studentData["plan_id"] = student.PlanID
 	}
 	if student.UpdatedBy != nil {
 		studentData["updated_by"] = student.UpdatedBy
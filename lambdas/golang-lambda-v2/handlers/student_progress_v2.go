@@ -3,18 +3,18 @@ package handlers
 import (
 	"encoding/json"
 	"log"
-	"strconv"
+	"time"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 type ProgressSummary struct {
-	SubjectName  string  `json:"subjectName"`
-	Percentage   float64 `json:"percentage"`
-	Attempted    int     `json:"attempted"`
-	Unattempted  int     `json:"unattempted"`
+	SubjectName     string   `json:"subjectName"`
+	Percentage      float64  `json:"percentage"`
+	Attempted       int      `json:"attempted"`
+	Unattempted     int      `json:"unattempted"`
+	WeakestTopics   []string `json:"weakestTopics"`
+	StrongestTopics []string `json:"strongestTopics"`
 }
 
 type TestScore struct {
@@ -36,6 +36,7 @@ type ProgressResponse struct {
 	ClassName       string                       `json:"className"`
 	SubjectSummary  []ProgressSummary            `json:"subjectSummary"`
 	IndividualTests map[string][]TestScore       `json:"individualTests"`
+	TopicBreakdown  map[string][]TopicMastery    `json:"topicBreakdown"`
 }
 
 func HandleStudentProgressV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -45,32 +46,47 @@ func HandleStudentProgressV2(request events.APIGatewayProxyRequest) (events.APIG
 	}
 
 	// Get student's enrolled subjects
-	student, err := GetStudentInfoByUID(uid)
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
 	if err != nil || student == nil {
 		log.Printf("❌ Student not found: %v", err)
 		return CreateErrorResponse(404, "Student not found"), nil
 	}
 
-	// Get enrolled subjects for this student class from class_subjects table
-	subjects, err := FetchSubjects(student.StudentClass)
+	// Get enrolled subjects for this student class from the taxonomy
+	subjects, err := FetchSubjects(tenantID, student.StudentClass)
 	if err != nil || len(subjects) == 0 {
 		log.Printf("❌ No subjects found for class %s: %v", student.StudentClass, err)
 		return CreateErrorResponse(404, "No subjects found for student class"), nil
 	}
 
 	// Get all attempts for student
-	result, err := dynamoClient.Query(&dynamodb.QueryInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		KeyConditionExpression: aws.String("uid = :uid"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":uid": {S: aws.String(uid)},
-		},
-	})
-
+	attempts, err := GetStudentAttempts(tenantID, uid)
 	if err != nil {
 		log.Printf("❌ Error querying attempts: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
+	attempts = withoutPracticeAttempts(attempts)
+
+	// Get quizzes per enrolled subject; they give quiz counts and the topic of
+	// attempts saved before topics were recorded
+	quizzesBySubject := make(map[string][]QuizItem)
+	quizTopics := make(map[string]string)
+	for _, subject := range subjects {
+		quizzes, err := ListQuizzes(tenantID, student.StudentClass, subject, "")
+		if err != nil {
+			log.Printf("⚠️ Error listing quizzes for %s: %v", subject, err)
+			continue
+		}
+		quizzesBySubject[subject] = quizzes
+		for _, quiz := range quizzes {
+			quizTopics[quiz.QuizName] = quiz.Topic
+		}
+	}
 
 	// Create maps to track subject stats
 	attemptedQuizzes := make(map[string]map[string]bool) // subject -> quiz names
@@ -79,45 +95,15 @@ func HandleStudentProgressV2(request events.APIGatewayProxyRequest) (events.APIG
 	individualTests := make(map[string][]TestScore)
 
 	// Process attempts
-	log.Printf("📊 Found %d attempts in DynamoDB", len(result.Items))
-	for _, item := range result.Items {
-		var className, subjectName, topic, quizName, attemptedAt string
-		var correctCount, wrongCount, skippedCount, totalCount, attemptNumber int
-		var percentage float64
-		
-		if cn := item["class_name"]; cn != nil && cn.S != nil {
-			className = *cn.S
-		}
-		if sn := item["category"]; sn != nil && sn.S != nil {
-			subjectName = *sn.S
-		}
-		if qn := item["quiz_name"]; qn != nil && qn.S != nil {
-			quizName = *qn.S
-		}
-		if cc := item["correct_count"]; cc != nil && cc.N != nil {
-			correctCount, _ = strconv.Atoi(*cc.N)
-		}
-		if wc := item["wrong_count"]; wc != nil && wc.N != nil {
-			wrongCount, _ = strconv.Atoi(*wc.N)
-		}
-		if sc := item["skipped_count"]; sc != nil && sc.N != nil {
-			skippedCount, _ = strconv.Atoi(*sc.N)
-		}
-		if tc := item["total_count"]; tc != nil && tc.N != nil {
-			totalCount, _ = strconv.Atoi(*tc.N)
-		}
-		if pct := item["percentage"]; pct != nil {
-			if pct.N != nil {
-				percentage, _ = strconv.ParseFloat(*pct.N, 64)
-			} else if pct.S != nil {
-				percentage, _ = strconv.ParseFloat(*pct.S, 64)
-			}
-		}
-		if an := item["attempt_number"]; an != nil && an.N != nil {
-			attemptNumber, _ = strconv.Atoi(*an.N)
-		}
-		if at := item["attempted_at"]; at != nil && at.S != nil {
-			attemptedAt = *at.S
+	log.Printf("📊 Found %d attempts in DynamoDB", len(attempts))
+	for _, attempt := range attempts {
+		className := attempt.ClassName
+		subjectName := attempt.Category
+		quizName := attempt.QuizName
+		percentage := attemptPercentage(attempt)
+		topic := attempt.Topic
+		if topic == "" {
+			topic = quizTopics[quizName]
 		}
 
 		// Only include student's class and enrolled subjects
@@ -151,35 +137,49 @@ func HandleStudentProgressV2(request events.APIGatewayProxyRequest) (events.APIG
 			QuizName:      quizName,
 			SubjectName:   subjectName,
 			Topic:         topic,
-			CorrectCount:  correctCount,
-			WrongCount:    wrongCount,
-			SkippedCount:  skippedCount,
-			TotalCount:    totalCount,
+			CorrectCount:  attempt.CorrectCount,
+			WrongCount:    attempt.WrongCount,
+			SkippedCount:  attempt.SkippedCount,
+			TotalCount:    attempt.TotalCount,
 			Percentage:    roundedPercentage,
-			TotalAttempts: attemptNumber,
+			TotalAttempts: attempt.AttemptNumber,
 			LatestScore:   roundedPercentage,
-			AttemptedAt:   attemptedAt,
+			AttemptedAt:   attempt.AttemptedAt,
 		}
 		individualTests[subjectName] = append(individualTests[subjectName], test)
 	}
 
-	// Create subject summary for all enrolled subjects
+	// Topic mastery weighs every attempt, not only the latest of each quiz
+	history, err := GetAttemptHistory(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error querying attempt history: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	subjectAttempts := make(map[string][]AttemptItem)
+	for _, attempt := range withoutPracticeAttempts(history) {
+		if attempt.ClassName != student.StudentClass || !containsString(subjects, attempt.Category) {
+			continue
+		}
+		if attempt.Topic == "" {
+			attempt.Topic = quizTopics[attempt.QuizName]
+		}
+		subjectAttempts[attempt.Category] = append(subjectAttempts[attempt.Category], attempt)
+	}
+
+	// Create subject summary and topic breakdown for all enrolled subjects
 	var subjectSummary []ProgressSummary
+	topicBreakdown := make(map[string][]TopicMastery)
+	now := time.Now()
 	for _, subject := range subjects {
-		// Get total quiz count for this class and subject
-		totalQuizzes := 0
-		quizResult, err := dynamoClient.Scan(&dynamodb.ScanInput{
-			TableName: aws.String("quiz_questions"),
-			FilterExpression: aws.String("class_name = :className AND subject_name = :subjectName"),
-			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-				":className":   {S: aws.String(student.StudentClass)},
-				":subjectName": {S: aws.String(subject)},
-			},
-			Select: aws.String("COUNT"),
-		})
-		if err == nil {
-			totalQuizzes = int(*quizResult.Count)
+		totalQuizzes := len(quizzesBySubject[subject])
+
+		topics, err := FetchTopics(tenantID, student.StudentClass, subject)
+		if err != nil {
+			log.Printf("⚠️ Error fetching topics for %s: %v", subject, err)
 		}
+		breakdown := ComputeTopicMastery(topics, quizzesBySubject[subject], subjectAttempts[subject], now)
+		topicBreakdown[subject] = breakdown
+		weakest, strongest := WeakestAndStrongestTopics(breakdown)
 
 		attempted := len(attemptedQuizzes[subject])
 		unattempted := totalQuizzes - attempted
@@ -195,10 +195,12 @@ func HandleStudentProgressV2(request events.APIGatewayProxyRequest) (events.APIG
 		}
 
 		subjectSummary = append(subjectSummary, ProgressSummary{
-			SubjectName:  subject,
-			Percentage:   avgPercentage,
-			Attempted:    attempted,
-			Unattempted:  unattempted,
+			SubjectName:     subject,
+			Percentage:      avgPercentage,
+			Attempted:       attempted,
+			Unattempted:     unattempted,
+			WeakestTopics:   weakest,
+			StrongestTopics: strongest,
 		})
 	}
 
@@ -207,6 +209,7 @@ func HandleStudentProgressV2(request events.APIGatewayProxyRequest) (events.APIG
 		ClassName:       student.StudentClass,
 		SubjectSummary:  subjectSummary,
 		IndividualTests: individualTests,
+		TopicBreakdown:  topicBreakdown,
 	}
 
 	responseJSON, _ := json.Marshal(response)
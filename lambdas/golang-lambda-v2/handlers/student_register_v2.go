@@ -26,13 +26,32 @@ func HandleStudentRegisterV2(request events.APIGatewayProxyRequest) (events.APIG
 	normalizedEmail := strings.ToLower(studentRegister.Email)
 	studentClass := studentRegister.StudentClass
 	if studentClass == "" {
-		studentClass = "DEMO"
+		studentClass = DemoClass
 	}
 
 
 
-	// Check if student already exists by UID
-	existingStudent, err := GetStudentInfoByUID(studentRegister.UID)
+	// Registration is unauthenticated, so joining an institute needs its join code
+	tenantID := normalizeTenantID(studentRegister.TenantID)
+	if tenantID != DefaultTenantID {
+		tenant, err := GetTenant(tenantID)
+		if err != nil {
+			log.Printf("❌ Error fetching tenant: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		if tenant == nil || !tenant.Active || tenant.JoinCode == "" || tenant.JoinCode != studentRegister.JoinCode {
+			return CreateErrorResponse(403, "Invalid institute or join code"), nil
+		}
+	}
+
+	if studentClass != DemoClass {
+		if err := ValidateTaxonomy(tenantID, studentClass, "", ""); err != nil {
+			return taxonomyErrorResponse(err), nil
+		}
+	}
+
+	// Check if student already exists by UID in any tenant
+	existingStudent, err := getStudentInfoByUIDAnyTenant(studentRegister.UID)
 	if err != nil {
 		log.Printf("❌ Error checking existing student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -50,11 +69,12 @@ func HandleStudentRegisterV2(request events.APIGatewayProxyRequest) (events.APIG
 	}
 
 	// Save new student
-	err = SaveStudentInfoToDynamoDB(studentInfo)
+	err = SaveStudentInfoToDynamoDB(tenantID, studentInfo)
 	if err != nil {
 		log.Printf("❌ Error saving student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
+	InvalidateCachedTenant(studentInfo.UID)
 
 	studentData := map[string]interface{}{
 		"uid":          studentInfo.UID,
@@ -62,6 +82,7 @@ func HandleStudentRegisterV2(request events.APIGatewayProxyRequest) (events.APIG
 		"name":         studentInfo.Name,
 		"phoneNumber":  studentInfo.PhoneNumber,
 		"studentClass": studentInfo.StudentClass,
+		"tenantId":     tenantID,
 	}
 
 	response := map[string]interface{}{
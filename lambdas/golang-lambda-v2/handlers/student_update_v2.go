@@ -2,10 +2,13 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 func HandleStudentUpdateV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -30,13 +33,18 @@ func HandleStudentUpdateV2(request events.APIGatewayProxyRequest) (events.APIGat
 	log.Printf("📌 Updating student: %s", updateRequest.UID)
 
 	// Additional check for subscription updates - only super
-	isSubscriptionUpdate := updateRequest.Amount > 0
+	isSubscriptionUpdate := updateRequest.Amount > 0 || updateRequest.PlanID != ""
 	if isSubscriptionUpdate && userRole != "super" {
 		return CreateErrorResponse(403, "Only 'super' role can update subscription amounts"), nil
 	}
 
 	// Get existing student
-	student, err := GetStudentInfoByUID(updateRequest.UID)
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, updateRequest.UID)
 	if err != nil {
 		log.Printf("❌ Error fetching student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -56,40 +64,83 @@ func HandleStudentUpdateV2(request events.APIGatewayProxyRequest) (events.APIGat
 	if updateRequest.StudentClass != "" {
 		student.StudentClass = updateRequest.StudentClass
 	}
+	profileChanged := updateRequest.Name != "" || updateRequest.PhoneNumber != "" || updateRequest.StudentClass != ""
+
+	if isSubscriptionUpdate {
+		var plan *SubscriptionPlanItem
+		amount := updateRequest.Amount
+		if updateRequest.PlanID != "" {
+			plan, err = GetPlanByID(updateRequest.PlanID)
+			if err != nil {
+				log.Printf("❌ Error fetching plan: %v", err)
+				return CreateErrorResponse(500, "Internal Server Error"), nil
+			}
+			if plan == nil {
+				return CreateErrorResponse(404, "Plan not found"), nil
+			}
+			if amount == 0 {
+				amount = plan.Price
+			}
+		}
 
-	if updateRequest.Amount > 0 {
-		student.Amount = updateRequest.Amount
-		// Auto-update payment_time and extend sub_exp_date like v1
 		now := time.Now()
-		student.PaymentTime = now.Format("2006-01-02T15:04:05.000Z")
-		
-		// Extend subscription by 1 year from existing date or today
-		today := now.Format("2006-01-02")
-		var newExpiry time.Time
-		
-		if student.SubExpDate != nil {
-			if dateStr, ok := student.SubExpDate.(string); ok && dateStr != "" {
-				if existingDate, err := time.Parse("2006-01-02T15:04:05Z", dateStr); err == nil && existingDate.Format("2006-01-02") >= today {
-					newExpiry = existingDate.AddDate(1, 0, 0)
-				} else {
-					newExpiry = now.AddDate(1, 0, 0)
-				}
-			} else {
-				newExpiry = now.AddDate(1, 0, 0)
+		payment := PaymentItem{
+			PaymentID:  fmt.Sprintf("manual-%d", now.UnixNano()),
+			Amount:     amount,
+			Source:     "manual",
+			RecordedBy: updateRequest.UpdatedBy,
+		}
+
+		// Coupons are priced against a plan and redeemed against this payment
+		var couponWrites []*dynamodb.TransactWriteItem
+		if updateRequest.CouponCode != "" {
+			if plan == nil {
+				return CreateErrorResponse(400, "'planId' is required when applying a coupon"), nil
 			}
-		} else {
-			newExpiry = now.AddDate(1, 0, 0)
+			quote, err := QuoteCoupon(updateRequest.CouponCode, plan, student.StudentClass, now)
+			if err != nil {
+				return couponErrorResponse(err), nil
+			}
+			if updateRequest.Amount == 0 {
+				payment.Amount = quote.FinalPrice
+			}
+			payment.CouponCode = quote.Code
+			payment.Discount = quote.Discount
+			couponWrites, err = couponRedemptionWrites(quote.Code, student.UID, payment.PaymentID, quote.Discount, now)
+			if err != nil {
+				log.Printf("❌ Error preparing coupon redemption: %v", err)
+				return CreateErrorResponse(500, "Internal Server Error"), nil
+			}
+		}
+
+		// The payment only writes the subscription fields; save any profile
+		// changes first
+		if profileChanged {
+			if err := SaveStudentInfoToDynamoDB(tenantID, *student); err != nil {
+				log.Printf("❌ Error updating student: %v", err)
+				return CreateErrorResponse(500, "Internal Server Error"), nil
+			}
+		}
+
+		// Ledger row, renewed subscription and coupon redemption are written together
+		recorded, err := ApplySubscriptionPayment(student, plan, payment, now, couponWrites...)
+		if couponErr := couponRedemptionError(err); couponErr != nil {
+			return couponErrorResponse(couponErr), nil
 		}
-		
-		student.SubExpDate = newExpiry.Format("2006-01-02T15:04:05Z")
-		
-		if updateRequest.UpdatedBy != "" {
-			student.UpdatedBy = updateRequest.UpdatedBy
+		if errors.Is(err, ErrSubscriptionConflict) {
+			return CreateErrorResponse(409, err.Error()), nil
 		}
+		if err != nil {
+			log.Printf("❌ Error recording payment: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+
+		log.Printf("✅ Payment %s recorded, subscription valid until %s", recorded.PaymentID, recorded.ValidUntil)
+		return CreateSuccessResponse("Student updated successfully"), nil
 	}
 
 	// Save updated student
-	err = SaveStudentInfoToDynamoDB(*student)
+	err = SaveStudentInfoToDynamoDB(tenantID, *student)
 	if err != nil {
 		log.Printf("❌ Error updating student: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -0,0 +1,465 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Layout used for sub_exp_date and payment timestamps
+const subExpDateLayout = "2006-01-02T15:04:05Z"
+
+// Duration used for payments recorded without a plan (old one-year behaviour)
+const legacyPlanDurationDays = 365
+
+var (
+	ErrPaymentAlreadyRecorded = errors.New("payment already recorded")
+	ErrSubscriptionConflict   = errors.New("subscription changed by another payment")
+	ErrSubscriptionExpired    = errors.New("subscription expired")
+	ErrPlanNotIncluded        = errors.New("quiz not included in subscription plan")
+)
+
+// Subscription plan item structure
+type SubscriptionPlanItem struct {
+	PlanID       string   `json:"plan_id" dynamodbav:"plan_id"`
+	Name         string   `json:"name" dynamodbav:"name"`
+	DurationDays int      `json:"duration_days" dynamodbav:"duration_days"`
+	Price        float64  `json:"price" dynamodbav:"price"`
+	Classes      []string `json:"classes" dynamodbav:"classes"`
+	Subjects     []string `json:"subjects" dynamodbav:"subjects"`
+	Active       bool     `json:"active" dynamodbav:"active"`
+}
+
+// Payment ledger item structure, one row per payment
+type PaymentItem struct {
+	UID        string  `json:"uid" dynamodbav:"uid"`
+	PaymentID  string  `json:"payment_id" dynamodbav:"payment_id"`
+	PlanID     string  `json:"plan_id,omitempty" dynamodbav:"plan_id,omitempty"`
+	OrderID    string  `json:"order_id,omitempty" dynamodbav:"order_id,omitempty"`
+	Amount     float64 `json:"amount" dynamodbav:"amount"`
+	Currency   string  `json:"currency,omitempty" dynamodbav:"currency,omitempty"`
+	CouponCode string  `json:"coupon_code,omitempty" dynamodbav:"coupon_code,omitempty"`
+	Discount   float64 `json:"discount,omitempty" dynamodbav:"discount,omitempty"`
+	Source     string  `json:"source" dynamodbav:"source"`
+	RecordedBy string  `json:"recorded_by,omitempty" dynamodbav:"recorded_by,omitempty"`
+	PaidAt     string  `json:"paid_at" dynamodbav:"paid_at"`
+	ValidFrom  string  `json:"valid_from" dynamodbav:"valid_from"`
+	ValidUntil string  `json:"valid_until" dynamodbav:"valid_until"`
+}
+
+// Payment order item structure, created at checkout and settled by the webhook
+type PaymentOrderItem struct {
+	OrderID    string  `json:"order_id" dynamodbav:"order_id"`
+	UID        string  `json:"uid" dynamodbav:"uid"`
+	PlanID     string  `json:"plan_id" dynamodbav:"plan_id"`
+	Amount     int64   `json:"amount" dynamodbav:"amount"`
+	Currency   string  `json:"currency" dynamodbav:"currency"`
+	Provider   string  `json:"provider" dynamodbav:"provider"`
+	TenantID   string  `json:"tenant_id,omitempty" dynamodbav:"tenant_id,omitempty"`
+	CouponCode string  `json:"coupon_code,omitempty" dynamodbav:"coupon_code,omitempty"`
+	Discount   float64 `json:"discount,omitempty" dynamodbav:"discount,omitempty"`
+	Status     string  `json:"status" dynamodbav:"status"`
+	PaymentID  string  `json:"payment_id,omitempty" dynamodbav:"payment_id,omitempty"`
+	CreatedAt  string  `json:"created_at" dynamodbav:"created_at"`
+	// Why a captured payment could not be applied and must be refunded
+	RefundReason string `json:"refund_reason,omitempty" dynamodbav:"refund_reason,omitempty"`
+}
+
+// Save subscription plan to DynamoDB
+func SavePlanToDynamoDB(plan SubscriptionPlanItem) error {
+	av, err := dynamodbattribute.MarshalMap(plan)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("subscription_plans"),
+		Item:      av,
+	})
+	return err
+}
+
+// Get subscription plan by ID
+func GetPlanByID(planID string) (*SubscriptionPlanItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("subscription_plans"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"plan_id": {S: aws.String(planID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var plan SubscriptionPlanItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &plan)
+	return &plan, err
+}
+
+// Fetch all subscription plans
+func FetchPlans() ([]SubscriptionPlanItem, error) {
+	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
+		TableName: aws.String("subscription_plans"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	plans := []SubscriptionPlanItem{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &plans)
+	return plans, err
+}
+
+// Fetch payment ledger for a student
+func FetchPayments(uid string) ([]PaymentItem, error) {
+	result, err := dynamoClient.Query(&dynamodb.QueryInput{
+		TableName:              aws.String("student_payments"),
+		KeyConditionExpression: aws.String("uid = :uid"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":uid": {S: aws.String(uid)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	payments := []PaymentItem{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &payments)
+	return payments, err
+}
+
+// Save payment order to DynamoDB
+func SavePaymentOrder(order PaymentOrderItem) error {
+	av, err := dynamodbattribute.MarshalMap(order)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("payment_orders"),
+		Item:      av,
+	})
+	return err
+}
+
+// Get payment order by provider order ID
+func GetPaymentOrder(orderID string) (*PaymentOrderItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("payment_orders"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"order_id": {S: aws.String(orderID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var order PaymentOrderItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &order)
+	return &order, err
+}
+
+// Mark payment order as paid
+func MarkPaymentOrderPaid(orderID, paymentID string) error {
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("payment_orders"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"order_id": {S: aws.String(orderID)},
+		},
+		UpdateExpression: aws.String("SET #status = :paid, payment_id = :paymentId"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":paid":      {S: aws.String("paid")},
+			":paymentId": {S: aws.String(paymentID)},
+		},
+	})
+	return err
+}
+
+// Mark payment order as captured but not applied, for a refund
+func MarkPaymentOrderRefundRequired(orderID, paymentID, reason string) error {
+	_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName: aws.String("payment_orders"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"order_id": {S: aws.String(orderID)},
+		},
+		UpdateExpression: aws.String("SET #status = :refund, payment_id = :paymentId, refund_reason = :reason"),
+		ExpressionAttributeNames: map[string]*string{
+			"#status": aws.String("status"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":refund":    {S: aws.String("refund_required")},
+			":paymentId": {S: aws.String(paymentID)},
+			":reason":    {S: aws.String(reason)},
+		},
+	})
+	return err
+}
+
+// Index of the first extra write in ApplySubscriptionPayment's transaction
+const paymentExtraWriteIndex = 2
+
+// Times a payment is re-applied after another payment renewed the subscription
+const subscriptionUpdateAttempts = 3
+
+// ApplySubscriptionPayment writes the ledger row and the renewed subscription
+// in one transaction, along with any extra writes such as a coupon redemption.
+// The ledger row is keyed by payment ID, so replaying the same payment returns
+// ErrPaymentAlreadyRecorded and leaves the student untouched. Only the
+// subscription fields of the student are written, and only if sub_exp_date is
+// still the one the renewal was computed from; otherwise the student is read
+// again and the payment re-applied, up to subscriptionUpdateAttempts times.
+func ApplySubscriptionPayment(student *StudentInfoItem, plan *SubscriptionPlanItem, payment PaymentItem, now time.Time, extra ...*dynamodb.TransactWriteItem) (*PaymentItem, error) {
+	for attempt := 1; ; attempt++ {
+		recorded, err := applySubscriptionPayment(student, plan, payment, now, extra)
+		if !isTransactionConditionFailure(err, 1) {
+			return recorded, err
+		}
+		if attempt == subscriptionUpdateAttempts {
+			return nil, ErrSubscriptionConflict
+		}
+
+		log.Printf("⚠️ Subscription of %s changed while recording payment %s, retrying", student.UID, payment.PaymentID)
+		current, err := GetStudentInfoByUID(student.TenantID, student.UID)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			return nil, ErrSubscriptionConflict
+		}
+		*student = *current
+	}
+}
+
+func applySubscriptionPayment(student *StudentInfoItem, plan *SubscriptionPlanItem, payment PaymentItem, now time.Time, extra []*dynamodb.TransactWriteItem) (*PaymentItem, error) {
+	durationDays := legacyPlanDurationDays
+	if plan != nil {
+		durationDays = plan.DurationDays
+		payment.PlanID = plan.PlanID
+	}
+
+	validFrom, validUntil := computeRenewal(student.SubExpDate, durationDays, now)
+	payment.UID = student.UID
+	payment.PaidAt = now.UTC().Format(subExpDateLayout)
+	payment.ValidFrom = validFrom.Format(subExpDateLayout)
+	payment.ValidUntil = validUntil.Format(subExpDateLayout)
+
+	paymentAV, err := dynamodbattribute.MarshalMap(payment)
+	if err != nil {
+		return nil, err
+	}
+
+	update := "SET amount = :amount, payment_time = :paidAt, sub_exp_date = :validUntil"
+	values := map[string]*dynamodb.AttributeValue{
+		":amount":     {N: aws.String(formatNumber(payment.Amount))},
+		":paidAt":     {S: aws.String(payment.PaidAt)},
+		":validUntil": {S: aws.String(payment.ValidUntil)},
+	}
+	if payment.PlanID != "" {
+		update += ", plan_id = :planId"
+		values[":planId"] = &dynamodb.AttributeValue{S: aws.String(payment.PlanID)}
+	}
+	if payment.RecordedBy != "" {
+		update += ", updated_by = :updatedBy"
+		values[":updatedBy"] = &dynamodb.AttributeValue{S: aws.String(payment.RecordedBy)}
+	}
+
+	// The renewal was computed from this expiry; a concurrent payment moves it
+	condition := "attribute_exists(uid) AND attribute_not_exists(sub_exp_date)"
+	if student.SubExpDate != nil {
+		previous, err := dynamodbattribute.Marshal(student.SubExpDate)
+		if err != nil {
+			return nil, err
+		}
+		condition = "sub_exp_date = :previousExpiry"
+		values[":previousExpiry"] = previous
+	}
+	condition += " AND " + tenantCondition(student.TenantID, values)
+
+	items := []*dynamodb.TransactWriteItem{
+		{
+			Put: &dynamodb.Put{
+				TableName:           aws.String("student_payments"),
+				Item:                paymentAV,
+				ConditionExpression: aws.String("attribute_not_exists(payment_id)"),
+			},
+		},
+		{
+			Update: &dynamodb.Update{
+				TableName: aws.String("students_info"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"uid": {S: aws.String(student.UID)},
+				},
+				UpdateExpression:          aws.String(update),
+				ConditionExpression:       aws.String(condition),
+				ExpressionAttributeValues: values,
+			},
+		},
+	}
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: append(items, extra...),
+	})
+	if err != nil {
+		if isTransactionConditionFailure(err, 0) {
+			return nil, ErrPaymentAlreadyRecorded
+		}
+		return nil, err
+	}
+
+	student.Amount = payment.Amount
+	student.PaymentTime = payment.PaidAt
+	student.SubExpDate = payment.ValidUntil
+	if payment.PlanID != "" {
+		student.PlanID = payment.PlanID
+	}
+	if payment.RecordedBy != "" {
+		student.UpdatedBy = payment.RecordedBy
+	}
+	return &payment, nil
+}
+
+// computeRenewal extends from the current expiry when it is still in the
+// future, otherwise from now.
+func computeRenewal(currentExpiry interface{}, durationDays int, now time.Time) (time.Time, time.Time) {
+	from := now.UTC()
+	if expiry, ok := parseSubExpDate(currentExpiry); ok && expiry.After(from) {
+		from = expiry
+	}
+	return from, from.AddDate(0, 0, durationDays)
+}
+
+// parseSubExpDate accepts the v2 timestamp format and the v1 date-only format
+func parseSubExpDate(value interface{}) (time.Time, bool) {
+	dateStr, ok := value.(string)
+	if !ok || dateStr == "" {
+		return time.Time{}, false
+	}
+	if t, err := time.Parse(time.RFC3339, dateStr); err == nil {
+		return t.UTC(), true
+	}
+	if t, err := time.Parse("2006-01-02", dateStr); err == nil {
+		return t.UTC(), true
+	}
+	return time.Time{}, false
+}
+
+// getGracePeriod reads SUBSCRIPTION_GRACE_DAYS, defaulting to no grace
+func getGracePeriod() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("SUBSCRIPTION_GRACE_DAYS"))
+	if err != nil || days < 0 {
+		return 0
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// GetPaymentStatus returns PAID, GRACE, EXPIRED or UNPAID for a student
+func GetPaymentStatus(student *StudentInfoItem, now time.Time) string {
+	expiry, ok := parseSubExpDate(student.SubExpDate)
+	if !ok {
+		return "UNPAID"
+	}
+	if expiry.After(now) {
+		return "PAID"
+	}
+	if expiry.Add(getGracePeriod()).After(now) {
+		return "GRACE"
+	}
+	return "EXPIRED"
+}
+
+// CheckSubscriptionAccess verifies the student's subscription is active (within
+// the grace period) and that their plan covers the class and subject.
+// Admin and super users are not subject to subscription checks.
+func CheckSubscriptionAccess(student *StudentInfoItem, className, subjectName string) error {
+	if role, ok := student.Role.(string); ok && (role == "admin" || role == "super") {
+		return nil
+	}
+
+	status := GetPaymentStatus(student, time.Now())
+	if status != "PAID" && status != "GRACE" {
+		return ErrSubscriptionExpired
+	}
+
+	if student.PlanID == "" {
+		return nil
+	}
+
+	plan, err := GetPlanByID(student.PlanID)
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		// A deleted plan should not lock out a paying student; the
+		// subscription dates checked above still apply
+		log.Printf("⚠️ Plan %s of student %s not found, checking subscription dates only", student.PlanID, student.UID)
+		return nil
+	}
+
+	if len(plan.Classes) > 0 && !containsString(plan.Classes, className) {
+		return ErrPlanNotIncluded
+	}
+	if len(plan.Subjects) > 0 && !containsString(plan.Subjects, subjectName) {
+		return ErrPlanNotIncluded
+	}
+	return nil
+}
+
+// subscriptionDeniedResponse maps CheckSubscriptionAccess errors to API responses
+func subscriptionDeniedResponse(student *StudentInfoItem, className, subjectName string) (events.APIGatewayProxyResponse, bool) {
+	err := CheckSubscriptionAccess(student, className, subjectName)
+	switch {
+	case err == nil:
+		return events.APIGatewayProxyResponse{}, false
+	case errors.Is(err, ErrSubscriptionExpired):
+		return CreateErrorResponse(403, "Subscription expired"), true
+	case errors.Is(err, ErrPlanNotIncluded):
+		return CreateErrorResponse(403, "Quiz not included in subscription plan"), true
+	default:
+		log.Printf("❌ Error checking subscription: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), true
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isTransactionConditionFailure reports whether the transaction was cancelled
+// because the condition on the item at index failed.
+func isTransactionConditionFailure(err error, index int) bool {
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		if index < len(canceled.CancellationReasons) {
+			reason := canceled.CancellationReasons[index]
+			return reason.Code != nil && *reason.Code == "ConditionalCheckFailed"
+		}
+		return false
+	}
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type PlanRequest struct {
+	PlanID       string   `json:"planId"`
+	Name         string   `json:"name"`
+	DurationDays int      `json:"durationDays"`
+	Price        float64  `json:"price"`
+	Classes      []string `json:"classes"`
+	Subjects     []string `json:"subjects"`
+	Active       bool     `json:"active"`
+}
+
+// Plan APIs
+func HandlePlanUpsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userRole, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	// Plans are shared by every tenant
+	if userRole != "super" || tenantID != DefaultTenantID {
+		return CreateErrorResponse(403, "Only 'super' role can manage plans"), nil
+	}
+
+	var req PlanRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+
+	if req.PlanID == "" {
+		return CreateErrorResponse(400, "Missing 'planId' parameter"), nil
+	}
+	if req.DurationDays <= 0 {
+		return CreateErrorResponse(400, "'durationDays' must be positive"), nil
+	}
+	if req.Price < 0 {
+		return CreateErrorResponse(400, "'price' must not be negative"), nil
+	}
+
+	plan := SubscriptionPlanItem{
+		PlanID:       req.PlanID,
+		Name:         req.Name,
+		DurationDays: req.DurationDays,
+		Price:        req.Price,
+		Classes:      req.Classes,
+		Subjects:     req.Subjects,
+		Active:       req.Active,
+	}
+
+	if err := SavePlanToDynamoDB(plan); err != nil {
+		log.Printf("Failed to save plan: %v", err)
+		return CreateErrorResponse(500, "Failed to save plan"), nil
+	}
+
+	return CreateSuccessResponse("Plan saved successfully"), nil
+}
+
+func HandlePlanFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	plans, err := FetchPlans()
+	if err != nil {
+		log.Printf("Failed to fetch plans: %v", err)
+		return CreateErrorResponse(500, "Failed to fetch plans"), nil
+	}
+
+	// Students only see plans that are on sale
+	if _, err := CheckAdminRole(request); err != nil {
+		activePlans := []SubscriptionPlanItem{}
+		for _, plan := range plans {
+			if plan.Active {
+				activePlans = append(activePlans, plan)
+			}
+		}
+		plans = activePlans
+	}
+
+	response, _ := json.Marshal(plans)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(response),
+	}, nil
+}
+
+// Payment ledger API: students see their own payments, admins can pass uid
+func HandlePaymentHistory(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userUID, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	uid := request.QueryStringParameters["uid"]
+	if uid != "" && uid != userUID {
+		if _, err := CheckAdminRole(request); err != nil {
+			return CreateErrorResponse(403, err.Error()), nil
+		}
+		// Admins only see payments of students in their own tenant
+		tenantID, err := GetTenantFromContext(request)
+		if err != nil {
+			log.Printf("❌ Error resolving tenant: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		student, err := GetStudentInfoByUID(tenantID, uid)
+		if err != nil {
+			log.Printf("❌ Error fetching student: %v", err)
+			return CreateErrorResponse(500, "Internal Server Error"), nil
+		}
+		if student == nil {
+			return CreateErrorResponse(404, "Student not found"), nil
+		}
+	} else {
+		uid = userUID
+	}
+
+	payments, err := FetchPayments(uid)
+	if err != nil {
+		log.Printf("❌ Error fetching payments: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	response := map[string]interface{}{
+		"uid":      uid,
+		"payments": payments,
+		"count":    len(payments),
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
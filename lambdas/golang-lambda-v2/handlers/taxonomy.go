@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Class of students who registered without choosing one; it is not part of
+// the taxonomy
+const DemoClass = "DEMO"
+
+// TaxonomyError reports a class, subject or topic that is not in the
+// taxonomy, with the valid options at that level
+type TaxonomyError struct {
+	Field   string
+	Value   string
+	Options []string
+}
+
+func (e *TaxonomyError) Error() string {
+	return fmt.Sprintf("Unknown %s '%s'", e.Field, e.Value)
+}
+
+// ValidateTaxonomy checks that the class exists and, when given, that the
+// subject is under the class and the topic is listed under the subject.
+// Inactive nodes, hidden from the app's tree, are refused like missing ones.
+func ValidateTaxonomy(tenantID, className, subjectName, topic string) error {
+	return validateTaxonomy(tenantID, className, subjectName, topic, false)
+}
+
+// validateTaxonomy is ValidateTaxonomy, optionally accepting inactive nodes
+// for admin changes such as renames
+func validateTaxonomy(tenantID, className, subjectName, topic string, includeInactive bool) error {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return err
+	}
+	visible := func(node *TaxonomyNodeItem) bool {
+		return node != nil && (node.Active || includeInactive)
+	}
+	options := t.activeChildNames
+	if includeInactive {
+		options = t.childNames
+	}
+
+	class := t.child("", className)
+	if !visible(class) {
+		return &TaxonomyError{Field: "className", Value: className, Options: options("")}
+	}
+	if subjectName == "" {
+		return nil
+	}
+
+	subject := t.child(class.NodeID, subjectName)
+	if !visible(subject) {
+		return &TaxonomyError{Field: "subjectName", Value: subjectName, Options: options(class.NodeID)}
+	}
+	if topic == "" {
+		return nil
+	}
+
+	node := t.child(subject.NodeID, topic)
+	if !visible(node) {
+		return &TaxonomyError{Field: "topic", Value: topic, Options: options(subject.NodeID)}
+	}
+	return nil
+}
+
+// taxonomyErrorResponse returns 422 listing the valid options for a
+// TaxonomyError, and 500 for any other error
+func taxonomyErrorResponse(err error) events.APIGatewayProxyResponse {
+	var taxonomyErr *TaxonomyError
+	if !errors.As(err, &taxonomyErr) {
+		log.Printf("❌ Error validating taxonomy: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error")
+	}
+
+	options := append([]string{}, taxonomyErr.Options...)
+	sort.Strings(options)
+	response := map[string]interface{}{
+		"error":        taxonomyErr.Error(),
+		"field":        taxonomyErr.Field,
+		"value":        taxonomyErr.Value,
+		"validOptions": options,
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 422,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}
+}
@@ -0,0 +1,430 @@
+package handlers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Ways to delete a class, subject or topic that still has dependents
+const (
+	// Delete its quizzes with their attempts and item statistics
+	TaxonomyCascade = "cascade"
+	// Keep its quizzes and attempts, hiding the quizzes from listings
+	TaxonomyArchive = "archive"
+)
+
+// Most items a DynamoDB transaction accepts; larger renames are applied in
+// steps, see RenameTaxonomyNode
+const maxTransactItems = 100
+
+var (
+	errTaxonomyConflict  = errors.New("taxonomy changed during rename")
+	errTaxonomyNodeEmpty = errors.New("missing class name")
+)
+
+// TaxonomyNode names a class, a subject of a class or a topic of a subject
+type TaxonomyNode struct {
+	ClassName   string
+	SubjectName string
+	Topic       string
+}
+
+func (n TaxonomyNode) level() string {
+	switch {
+	case n.Topic != "":
+		return LevelTopic
+	case n.SubjectName != "":
+		return LevelSubject
+	default:
+		return LevelClass
+	}
+}
+
+// TaxonomyDependents lists what points at a class, subject or topic.
+// Students depend on classes only.
+type TaxonomyDependents struct {
+	Quizzes  []string `json:"quizzes"`
+	Attempts int      `json:"attempts"`
+	Students int      `json:"students"`
+
+	// Filled by FindTaxonomyReferences, for renames only
+	Assignments    int `json:"assignments,omitempty"`
+	ReviewCards    int `json:"reviewCards,omitempty"`
+	LoggedAttempts int `json:"loggedAttempts,omitempty"`
+
+	quizItems   []QuizItem
+	attemptKeys []map[string]*dynamodb.AttributeValue
+	studentUIDs []string
+
+	assignmentKeys []map[string]*dynamodb.AttributeValue
+	reviewCardKeys []map[string]*dynamodb.AttributeValue
+	attemptLogKeys []map[string]*dynamodb.AttributeValue
+	sessionKeys    []map[string]*dynamodb.AttributeValue
+	batchKeys      []map[string]*dynamodb.AttributeValue
+}
+
+func (d *TaxonomyDependents) empty() bool {
+	return len(d.Quizzes) == 0 && d.Attempts == 0 && d.Students == 0
+}
+
+// FindTaxonomyDependents returns the quizzes, including archived ones,
+// attempts and students under a class, subject or topic
+func FindTaxonomyDependents(tenantID string, node TaxonomyNode) (*TaxonomyDependents, error) {
+	if node.ClassName == "" {
+		return nil, errTaxonomyNodeEmpty
+	}
+	dependents := &TaxonomyDependents{Quizzes: []string{}}
+
+	quizzes, err := listQuizzes(tenantID, node.ClassName, node.SubjectName, node.Topic, true)
+	if err != nil {
+		return nil, err
+	}
+	dependents.quizItems = quizzes
+	for _, quiz := range quizzes {
+		dependents.Quizzes = append(dependents.Quizzes, quiz.QuizName)
+	}
+
+	filter, values := taxonomyFilter(tenantID, node, "class_name", "category", "topic")
+	dependents.attemptKeys, err = scanKeys("student_quiz_attempts_v2", filter, values, "uid, quiz_name")
+	if err != nil {
+		return nil, err
+	}
+	dependents.Attempts = len(dependents.attemptKeys)
+
+	if node.level() != LevelClass {
+		return dependents, nil
+	}
+
+	studentValues := map[string]*dynamodb.AttributeValue{
+		":className": {S: aws.String(node.ClassName)},
+	}
+	err = dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String("students_info"),
+		FilterExpression:          aws.String("student_class = :className AND " + tenantCondition(tenantID, studentValues)),
+		ExpressionAttributeValues: studentValues,
+		ProjectionExpression:      aws.String("uid"),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		for _, item := range page.Items {
+			if uid, ok := item["uid"]; ok && uid.S != nil {
+				dependents.studentUIDs = append(dependents.studentUIDs, *uid.S)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	dependents.Students = len(dependents.studentUIDs)
+	return dependents, nil
+}
+
+// FindTaxonomyReferences adds the assignments, review cards, logged attempts,
+// adaptive sessions and, for a class, batches naming a node to its dependents. They
+// follow a rename but do not keep a node from being deleted.
+func FindTaxonomyReferences(tenantID string, node TaxonomyNode, dependents *TaxonomyDependents) error {
+	var err error
+	filter, values := taxonomyFilter(tenantID, node, "class_name", "category", "topic")
+	dependents.assignmentKeys, err = scanKeys("assignments", filter, values, "batch_id, assignment_id")
+	if err != nil {
+		return err
+	}
+	dependents.Assignments = len(dependents.assignmentKeys)
+
+	dependents.reviewCardKeys, err = scanKeys("review_queue", filter, values, "uid, card_id")
+	if err != nil {
+		return err
+	}
+	dependents.ReviewCards = len(dependents.reviewCardKeys)
+
+	dependents.attemptLogKeys, err = scanKeys("attempt_log", filter, values, "uid, attempt_key")
+	if err != nil {
+		return err
+	}
+	dependents.LoggedAttempts = len(dependents.attemptLogKeys)
+
+	// Adaptive sessions span all topics of a subject
+	if node.level() != LevelTopic {
+		filter, values := taxonomyFilter(tenantID, node, "class_name", "subject_name", "")
+		dependents.sessionKeys, err = scanKeys("adaptive_sessions", filter, values, "uid, session_id")
+		if err != nil {
+			return err
+		}
+	}
+
+	if node.level() == LevelClass {
+		filter, values := taxonomyFilter(tenantID, node, "class_name", "", "")
+		dependents.batchKeys, err = scanKeys("batches", filter, values, "batch_id")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// taxonomyFilter matches a tenant's items naming a node in the given
+// attributes
+func taxonomyFilter(tenantID string, node TaxonomyNode, classAttribute, subjectAttribute, topicAttribute string) (string, map[string]*dynamodb.AttributeValue) {
+	values := map[string]*dynamodb.AttributeValue{
+		":className": {S: aws.String(node.ClassName)},
+	}
+	filter := classAttribute + " = :className AND " + tenantCondition(tenantID, values)
+	if node.SubjectName != "" {
+		filter += " AND " + subjectAttribute + " = :subjectName"
+		values[":subjectName"] = &dynamodb.AttributeValue{S: aws.String(node.SubjectName)}
+	}
+	if node.Topic != "" {
+		filter += " AND " + topicAttribute + " = :topic"
+		values[":topic"] = &dynamodb.AttributeValue{S: aws.String(node.Topic)}
+	}
+	return filter, values
+}
+
+// scanKeys returns the projected keys of the items matching a filter
+func scanKeys(tableName, filter string, values map[string]*dynamodb.AttributeValue, projection string) ([]map[string]*dynamodb.AttributeValue, error) {
+	var keys []map[string]*dynamodb.AttributeValue
+	err := dynamoClient.ScanPages(&dynamodb.ScanInput{
+		TableName:                 aws.String(tableName),
+		FilterExpression:          aws.String(filter),
+		ExpressionAttributeValues: values,
+		ProjectionExpression:      aws.String(projection),
+	}, func(page *dynamodb.ScanOutput, lastPage bool) bool {
+		keys = append(keys, page.Items...)
+		return true
+	})
+	return keys, err
+}
+
+// CascadeDeleteDependents deletes the quizzes under a node with their
+// attempts and item statistics, and moves its students to the demo class
+func CascadeDeleteDependents(tenantID string, dependents *TaxonomyDependents) error {
+	for _, quiz := range dependents.quizItems {
+		if err := DeleteQuizFromDynamoDB(tenantID, quiz.QuizName, nil); err != nil {
+			return err
+		}
+		if err := DeleteItemStats(tenantID, quiz.QuizName, len(quiz.Questions)); err != nil {
+			return err
+		}
+	}
+	for _, key := range dependents.attemptKeys {
+		_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("student_quiz_attempts_v2"),
+			Key:       key,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return moveStudentsToDemoClass(dependents.studentUIDs)
+}
+
+// ArchiveDependents hides the quizzes under a node from listings, keeping
+// them and their attempts for results, and moves its students to the demo
+// class
+func ArchiveDependents(tenantID string, dependents *TaxonomyDependents, now time.Time) error {
+	for _, quiz := range dependents.quizItems {
+		if quiz.ArchivedAt != "" {
+			continue
+		}
+		names := map[string]*string{}
+		values := map[string]*dynamodb.AttributeValue{
+			":now": {S: aws.String(now.UTC().Format(subExpDateLayout))},
+		}
+		_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("quiz_questions"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"quiz_name": {S: aws.String(scopedKey(tenantID, quiz.QuizName))},
+			},
+			UpdateExpression:          aws.String("SET archived_at = :now " + versionIncrement(names, values)),
+			ConditionExpression:       aws.String("attribute_exists(quiz_name)"),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		})
+		if err != nil && !isConditionFailure(err) {
+			return err
+		}
+	}
+	return moveStudentsToDemoClass(dependents.studentUIDs)
+}
+
+func moveStudentsToDemoClass(uids []string) error {
+	for _, uid := range uids {
+		_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName: aws.String("students_info"),
+			Key: map[string]*dynamodb.AttributeValue{
+				"uid": {S: aws.String(uid)},
+			},
+			UpdateExpression:    aws.String("SET student_class = :demo"),
+			ConditionExpression: aws.String("attribute_exists(uid)"),
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":demo": {S: aws.String(DemoClass)},
+			},
+		})
+		if err != nil && !isConditionFailure(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// renameAttribute rewrites one attribute of an item, provided it still holds
+// the old value
+func renameAttribute(tableName string, key map[string]*dynamodb.AttributeValue, attribute, oldValue, newValue string) *dynamodb.TransactWriteItem {
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:                aws.String(tableName),
+			Key:                      key,
+			UpdateExpression:         aws.String("SET #attr = :new"),
+			ConditionExpression:      aws.String("#attr = :old"),
+			ExpressionAttributeNames: map[string]*string{"#attr": aws.String(attribute)},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":old": {S: aws.String(oldValue)},
+				":new": {S: aws.String(newValue)},
+			},
+		},
+	}
+}
+
+// taxonomyNodeRename renames the taxonomy record of a class, subject or
+// topic, provided it is unchanged since it was read; its ID and everything
+// under it stay as they are
+func taxonomyNodeRename(tenantID string, node TaxonomyNode, newName string, expectedVersion *int) (*dynamodb.TransactWriteItem, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	item := t.resolve(node)
+	if item == nil || item.Level != node.level() {
+		return nil, errTaxonomyConflict
+	}
+	if err := checkVersion(item.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	names := map[string]*string{"#name": aws.String("name")}
+	values := map[string]*dynamodb.AttributeValue{
+		":old": {S: aws.String(item.Name)},
+		":new": {S: aws.String(newName)},
+	}
+	condition := "#name = :old AND " + versionCondition(item.Version, names, values)
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:                 aws.String("taxonomy_nodes"),
+			Key:                       taxonomyNodeKey(tenantID, item.NodeID),
+			UpdateExpression:          aws.String("SET #name = :new " + versionIncrement(names, values)),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		},
+	}, nil
+}
+
+// taxonomyRewrites lists the updates pointing a node's dependents at its new
+// name; quizzes are versioned, see version.go
+func taxonomyRewrites(tenantID string, node TaxonomyNode, newName string, dependents *TaxonomyDependents) []*dynamodb.TransactWriteItem {
+	quizAttribute, attribute, sessionAttribute, oldName := "class_name", "class_name", "class_name", node.ClassName
+	switch node.level() {
+	case LevelSubject:
+		quizAttribute, attribute, sessionAttribute, oldName = "subject_name", "category", "subject_name", node.SubjectName
+	case LevelTopic:
+		quizAttribute, attribute, oldName = "topic", "topic", node.Topic
+	}
+
+	items := []*dynamodb.TransactWriteItem{}
+	for _, quiz := range dependents.quizItems {
+		key := map[string]*dynamodb.AttributeValue{
+			"quiz_name": {S: aws.String(scopedKey(tenantID, quiz.QuizName))},
+		}
+		rename := renameAttribute("quiz_questions", key, quizAttribute, oldName, newName)
+		update := rename.Update
+		update.UpdateExpression = aws.String(*update.UpdateExpression + " " + versionIncrement(update.ExpressionAttributeNames, update.ExpressionAttributeValues))
+		items = append(items, rename)
+	}
+	for _, key := range dependents.attemptKeys {
+		items = append(items, renameAttribute("student_quiz_attempts_v2", key, attribute, oldName, newName))
+	}
+	for _, uid := range dependents.studentUIDs {
+		key := map[string]*dynamodb.AttributeValue{"uid": {S: aws.String(uid)}}
+		items = append(items, renameAttribute("students_info", key, "student_class", oldName, newName))
+	}
+	for _, key := range dependents.assignmentKeys {
+		items = append(items, renameAttribute("assignments", key, attribute, oldName, newName))
+	}
+	for _, key := range dependents.reviewCardKeys {
+		items = append(items, renameAttribute("review_queue", key, attribute, oldName, newName))
+	}
+	for _, key := range dependents.attemptLogKeys {
+		items = append(items, renameAttribute("attempt_log", key, attribute, oldName, newName))
+	}
+	for _, key := range dependents.sessionKeys {
+		items = append(items, renameAttribute("adaptive_sessions", key, sessionAttribute, oldName, newName))
+	}
+	for _, key := range dependents.batchKeys {
+		items = append(items, renameAttribute("batches", key, "class_name", oldName, newName))
+	}
+	return items
+}
+
+// RenameTaxonomyNode renames a class, subject or topic together with its
+// dependents and references. Up to maxTransactItems writes this happens in
+// one transaction, so a rename either fully happens or not at all. A larger
+// rename renames the node first and then its dependents one by one until
+// the deadline, returning how many are left; ResumeTaxonomyRename carries on
+// from there. Leaderboards keep the old name. A non-nil expectedVersion must
+// match the node's version.
+func RenameTaxonomyNode(tenantID string, node TaxonomyNode, newName string, dependents *TaxonomyDependents, expectedVersion *int, deadline time.Time) (int, error) {
+	nodeRename, err := taxonomyNodeRename(tenantID, node, newName, expectedVersion)
+	if err != nil {
+		return 0, err
+	}
+	rewrites := taxonomyRewrites(tenantID, node, newName, dependents)
+
+	items := []*dynamodb.TransactWriteItem{nodeRename}
+	if len(rewrites) < maxTransactItems {
+		items = append(items, rewrites...)
+	}
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{TransactItems: items})
+	if err != nil {
+		var canceled *dynamodb.TransactionCanceledException
+		if errors.As(err, &canceled) {
+			return 0, errTaxonomyConflict
+		}
+		return 0, err
+	}
+	if len(rewrites) < maxTransactItems {
+		return 0, nil
+	}
+	return applyRewrites(rewrites, deadline)
+}
+
+// ResumeTaxonomyRename points the dependents still naming a renamed node at
+// its new name, returning how many are left at the deadline
+func ResumeTaxonomyRename(tenantID string, node TaxonomyNode, newName string, dependents *TaxonomyDependents, deadline time.Time) (int, error) {
+	return applyRewrites(taxonomyRewrites(tenantID, node, newName, dependents), deadline)
+}
+
+// applyRewrites writes renames one at a time. An item no longer holding the
+// old name was renamed or changed since and is skipped, which makes a
+// repeated run safe.
+func applyRewrites(rewrites []*dynamodb.TransactWriteItem, deadline time.Time) (int, error) {
+	for i, rewrite := range rewrites {
+		if time.Now().After(deadline) {
+			return len(rewrites) - i, nil
+		}
+		update := rewrite.Update
+		_, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:                 update.TableName,
+			Key:                       update.Key,
+			UpdateExpression:          update.UpdateExpression,
+			ConditionExpression:       update.ConditionExpression,
+			ExpressionAttributeNames:  update.ExpressionAttributeNames,
+			ExpressionAttributeValues: update.ExpressionAttributeValues,
+		})
+		if err != nil && !isConditionFailure(err) {
+			return len(rewrites) - i, err
+		}
+	}
+	return 0, nil
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type TaxonomyUpdateRequest struct {
+	ClassName   string `json:"className"`
+	SubjectName string `json:"subjectName"`
+	Topic       string `json:"topic"`
+	TaxonomyMetadata
+	// Optional version the update is based on, from the expectedVersion
+	// query parameter; see version.go
+	ExpectedVersion *int `json:"-"`
+}
+
+// HandleTaxonomyTree returns the classes with their subjects and topics for
+// the app's home screen. lang picks the display names (en, te or hi); admins
+// may pass includeInactive=true to see hidden nodes as well.
+func HandleTaxonomyTree(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	lang := request.QueryStringParameters["lang"]
+	if lang == "" {
+		lang = defaultTaxonomyLanguage
+	}
+	if !containsString(TaxonomyLanguages, lang) {
+		return CreateErrorResponse(400, fmt.Sprintf("Invalid 'lang', expected one of %s", strings.Join(TaxonomyLanguages, ", "))), nil
+	}
+
+	includeInactive := request.QueryStringParameters["includeInactive"] == "true"
+	if includeInactive {
+		if _, err := CheckAdminRole(request); err != nil {
+			return CreateErrorResponse(403, err.Error()), nil
+		}
+	}
+
+	classes, err := FetchTaxonomyTree(tenantID, lang, includeInactive)
+	if err != nil {
+		log.Printf("❌ Error fetching taxonomy: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"lang":    lang,
+		"classes": classes,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
+
+// HandleTaxonomyUpdate sets the display names, sort order, icon, active flag
+// or description of a class, subject or topic
+func HandleTaxonomyUpdate(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	// Taxonomy changes are limited to admins of the caller's tenant
+	if _, err := CheckAdminRole(request); err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	var req TaxonomyUpdateRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+	if req.ExpectedVersion, err = parseExpectedVersion(request); err != nil {
+		return CreateErrorResponse(400, err.Error()), nil
+	}
+	if req.ClassName == "" || (req.Topic != "" && req.SubjectName == "") {
+		return CreateErrorResponse(400, "Missing 'className', or 'subjectName' for a topic"), nil
+	}
+	for lang := range req.DisplayNames {
+		if !containsString(TaxonomyLanguages, lang) {
+			return CreateErrorResponse(400, fmt.Sprintf("Invalid display name language '%s', expected one of %s", lang, strings.Join(TaxonomyLanguages, ", "))), nil
+		}
+	}
+
+	node := TaxonomyNode{ClassName: req.ClassName, SubjectName: req.SubjectName, Topic: req.Topic}
+	updated, err := UpdateTaxonomyMetadata(tenantID, node, req.TaxonomyMetadata, req.ExpectedVersion)
+	if errors.Is(err, ErrVersionConflict) {
+		return versionConflictResponse(node.level()), nil
+	}
+	if errors.Is(err, ErrTaxonomyNodeNotFound) {
+		return CreateErrorResponse(404, fmt.Sprintf("Unknown %s", node.level())), nil
+	}
+	if err != nil {
+		log.Printf("❌ Error updating taxonomy: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	responseJSON, _ := json.Marshal(map[string]interface{}{
+		"message": "Taxonomy updated successfully",
+		"node":    updated,
+	})
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
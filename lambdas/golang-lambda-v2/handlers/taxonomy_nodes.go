@@ -0,0 +1,644 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Levels of the class > subject > topic taxonomy
+const (
+	LevelClass   = "class"
+	LevelSubject = "subject"
+	LevelTopic   = "topic"
+)
+
+// Languages the app shows display names in; English is the fallback
+var TaxonomyLanguages = []string{"en", "te", "hi"}
+
+const defaultTaxonomyLanguage = "en"
+
+var ErrTaxonomyNodeNotFound = errors.New("taxonomy node not found")
+
+// Node ID of the record whose version guards a tenant's list of classes, as
+// each node's version guards its children
+const taxonomyRootID = "root"
+
+// Times an insert or delete is retried after a concurrent taxonomy change
+const taxonomyWriteRetries = 3
+
+// Taxonomy node item structure, one per class, subject and topic, keyed by
+// tenant and a node ID that survives renames. Name is what quizzes, attempts
+// and students refer to.
+type TaxonomyNodeItem struct {
+	TenantID     string            `json:"tenant_id" dynamodbav:"tenant_id"`
+	NodeID       string            `json:"node_id" dynamodbav:"node_id"`
+	Level        string            `json:"level" dynamodbav:"level"`
+	Name         string            `json:"name" dynamodbav:"name"`
+	ParentID     string            `json:"parent_id,omitempty" dynamodbav:"parent_id,omitempty"`
+	DisplayNames map[string]string `json:"display_names,omitempty" dynamodbav:"display_names,omitempty"`
+	SortOrder    int               `json:"sort_order" dynamodbav:"sort_order"`
+	Icon         string            `json:"icon,omitempty" dynamodbav:"icon,omitempty"`
+	Active       bool              `json:"active" dynamodbav:"active"`
+	Description  string            `json:"description,omitempty" dynamodbav:"description,omitempty"`
+	// Node IDs of the classes a class upgrades to, see class_upgrade.go
+	UpgradeTo []string `json:"upgrade_to,omitempty" dynamodbav:"upgrade_to,omitempty"`
+	// Raised on every change to the node or to its list of children
+	Version int `json:"version" dynamodbav:"version"`
+}
+
+// displayName returns the name in lang, falling back to English and then to
+// the node's name
+func (n *TaxonomyNodeItem) displayName(lang string) string {
+	if name := n.DisplayNames[lang]; name != "" {
+		return name
+	}
+	if name := n.DisplayNames[defaultTaxonomyLanguage]; name != "" {
+		return name
+	}
+	return n.Name
+}
+
+// taxonomy is the whole taxonomy of one tenant, which is small enough to be
+// read with one query
+type taxonomy struct {
+	nodes       []TaxonomyNodeItem
+	rootVersion int
+}
+
+func loadTaxonomy(tenantID string) (*taxonomy, error) {
+	t := &taxonomy{}
+	var unmarshalErr error
+	err := dynamoClient.QueryPages(&dynamodb.QueryInput{
+		TableName:              aws.String("taxonomy_nodes"),
+		KeyConditionExpression: aws.String("tenant_id = :tenantId"),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":tenantId": {S: aws.String(normalizeTenantID(tenantID))},
+		},
+	}, func(page *dynamodb.QueryOutput, lastPage bool) bool {
+		var nodes []TaxonomyNodeItem
+		if unmarshalErr = dynamodbattribute.UnmarshalListOfMaps(page.Items, &nodes); unmarshalErr != nil {
+			return false
+		}
+		for _, node := range nodes {
+			if node.NodeID == taxonomyRootID {
+				t.rootVersion = node.Version
+				continue
+			}
+			t.nodes = append(t.nodes, node)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t, unmarshalErr
+}
+
+// children returns the nodes under parentID (empty for classes) in sort order
+func (t *taxonomy) children(parentID string) []TaxonomyNodeItem {
+	var children []TaxonomyNodeItem
+	for _, node := range t.nodes {
+		if node.ParentID == parentID {
+			children = append(children, node)
+		}
+	}
+	sort.SliceStable(children, func(i, j int) bool {
+		if children[i].SortOrder != children[j].SortOrder {
+			return children[i].SortOrder < children[j].SortOrder
+		}
+		return children[i].Name < children[j].Name
+	})
+	return children
+}
+
+func (t *taxonomy) child(parentID, name string) *TaxonomyNodeItem {
+	for i := range t.nodes {
+		if t.nodes[i].ParentID == parentID && t.nodes[i].Name == name {
+			return &t.nodes[i]
+		}
+	}
+	return nil
+}
+
+// resolve returns the record of a class, subject or topic, or nil when it or
+// one of its parents does not exist
+func (t *taxonomy) resolve(node TaxonomyNode) *TaxonomyNodeItem {
+	current := t.child("", node.ClassName)
+	for _, name := range []string{node.SubjectName, node.Topic} {
+		if current == nil || name == "" {
+			break
+		}
+		current = t.child(current.NodeID, name)
+	}
+	return current
+}
+
+// subtree returns a node and everything under it
+func (t *taxonomy) subtree(node *TaxonomyNodeItem) []TaxonomyNodeItem {
+	nodes := []TaxonomyNodeItem{*node}
+	for _, child := range t.children(node.NodeID) {
+		nodes = append(nodes, t.subtree(&child)...)
+	}
+	return nodes
+}
+
+func (t *taxonomy) childNames(parentID string) []string {
+	names := []string{}
+	for _, child := range t.children(parentID) {
+		names = append(names, child.Name)
+	}
+	return names
+}
+
+// activeChildNames leaves out the children hidden from the app's tree
+func (t *taxonomy) activeChildNames(parentID string) []string {
+	names := []string{}
+	for _, child := range t.children(parentID) {
+		if child.Active {
+			names = append(names, child.Name)
+		}
+	}
+	return names
+}
+
+func newTaxonomyNodeID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// ensureTaxonomyNode returns the node named name under parent, creating it
+// last in sort order when missing
+func ensureTaxonomyNode(tenantID string, t *taxonomy, level string, parent *TaxonomyNodeItem, name string) (*TaxonomyNodeItem, error) {
+	parentID := ""
+	if parent != nil {
+		parentID = parent.NodeID
+	}
+	if existing := t.child(parentID, name); existing != nil {
+		return existing, nil
+	}
+
+	nodeID, err := newTaxonomyNodeID()
+	if err != nil {
+		return nil, err
+	}
+	node := TaxonomyNodeItem{
+		TenantID: normalizeTenantID(tenantID),
+		NodeID:   nodeID,
+		Level:    level,
+		Name:     name,
+		ParentID: parentID,
+		Active:   true,
+	}
+	if siblings := t.children(parentID); len(siblings) > 0 {
+		node.SortOrder = siblings[len(siblings)-1].SortOrder + 1
+	}
+	node.Version = 1
+
+	av, err := dynamodbattribute.MarshalMap(node)
+	if err != nil {
+		return nil, err
+	}
+	// Raising the parent's version in the same transaction makes a
+	// concurrent insert of the same name fail instead of adding it twice
+	_, err = dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Put: &dynamodb.Put{
+					TableName:           aws.String("taxonomy_nodes"),
+					Item:                av,
+					ConditionExpression: aws.String("attribute_not_exists(node_id)"),
+				},
+			},
+			t.parentVersionBump(tenantID, parent),
+		},
+	})
+	if err != nil {
+		return nil, taxonomyWriteError(err)
+	}
+	if parent != nil {
+		parent.Version++
+	} else {
+		t.rootVersion++
+	}
+	t.nodes = append(t.nodes, node)
+	return &t.nodes[len(t.nodes)-1], nil
+}
+
+// parentVersionBump raises the version of a node's parent, or of the root
+// for a class, provided it is still the version that was read
+func (t *taxonomy) parentVersionBump(tenantID string, parent *TaxonomyNodeItem) *dynamodb.TransactWriteItem {
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	parentID, version := taxonomyRootID, t.rootVersion
+	condition := ""
+	if parent != nil {
+		parentID, version = parent.NodeID, parent.Version
+		condition = "attribute_exists(node_id) AND "
+	}
+	condition += versionCondition(version, names, values)
+
+	return &dynamodb.TransactWriteItem{
+		Update: &dynamodb.Update{
+			TableName:                 aws.String("taxonomy_nodes"),
+			Key:                       taxonomyNodeKey(tenantID, parentID),
+			UpdateExpression:          aws.String(versionIncrement(names, values)),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		},
+	}
+}
+
+// taxonomyWriteError reports a cancelled taxonomy transaction as a version
+// conflict
+func taxonomyWriteError(err error) error {
+	var canceled *dynamodb.TransactionCanceledException
+	if errors.As(err, &canceled) {
+		return ErrVersionConflict
+	}
+	return err
+}
+
+// retryTaxonomyWrite runs an idempotent taxonomy change against a freshly
+// read taxonomy, again if it conflicted with a concurrent change
+func retryTaxonomyWrite(tenantID string, write func(t *taxonomy) error) error {
+	for attempt := 0; ; attempt++ {
+		t, err := loadTaxonomy(tenantID)
+		if err != nil {
+			return err
+		}
+		err = write(t)
+		if !errors.Is(err, ErrVersionConflict) || attempt == taxonomyWriteRetries {
+			return err
+		}
+	}
+}
+
+func (t *taxonomy) parent(node *TaxonomyNodeItem) *TaxonomyNodeItem {
+	for i := range t.nodes {
+		if t.nodes[i].NodeID == node.ParentID {
+			return &t.nodes[i]
+		}
+	}
+	return nil
+}
+
+// deleteTaxonomySubtree deletes a node, provided it is still at version and
+// its parent's children did not change, and then everything under it, which
+// can no longer be reached
+func deleteTaxonomySubtree(tenantID string, t *taxonomy, node *TaxonomyNodeItem, version int) error {
+	names := map[string]*string{}
+	values := map[string]*dynamodb.AttributeValue{}
+	condition := versionCondition(version, names, values)
+	_, err := dynamoClient.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{
+				Delete: &dynamodb.Delete{
+					TableName:                 aws.String("taxonomy_nodes"),
+					Key:                       taxonomyNodeKey(tenantID, node.NodeID),
+					ConditionExpression:       aws.String(condition),
+					ExpressionAttributeNames:  names,
+					ExpressionAttributeValues: values,
+				},
+			},
+			t.parentVersionBump(tenantID, t.parent(node)),
+		},
+	})
+	if err != nil {
+		return taxonomyWriteError(err)
+	}
+
+	for _, item := range t.subtree(node)[1:] {
+		_, err := dynamoClient.DeleteItem(&dynamodb.DeleteItemInput{
+			TableName: aws.String("taxonomy_nodes"),
+			Key:       taxonomyNodeKey(tenantID, item.NodeID),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func taxonomyNodeKey(tenantID, nodeID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		"tenant_id": {S: aws.String(normalizeTenantID(tenantID))},
+		"node_id":   {S: aws.String(nodeID)},
+	}
+}
+
+// Class operations
+func InsertClass(tenantID, className string) error {
+	return retryTaxonomyWrite(tenantID, func(t *taxonomy) error {
+		_, err := ensureTaxonomyNode(tenantID, t, LevelClass, nil, className)
+		return err
+	})
+}
+
+// DeleteClass deletes the class with its subjects and topics
+func DeleteClass(tenantID, className string) error {
+	return DeleteTaxonomyNode(tenantID, TaxonomyNode{ClassName: className}, nil)
+}
+
+func FetchClasses(tenantID string) ([]string, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return t.childNames(""), nil
+}
+
+// Subject operations. Inserting a subject creates its class when missing.
+func InsertSubject(tenantID, className, subjectName string) error {
+	return retryTaxonomyWrite(tenantID, func(t *taxonomy) error {
+		class, err := ensureTaxonomyNode(tenantID, t, LevelClass, nil, className)
+		if err != nil {
+			return err
+		}
+		_, err = ensureTaxonomyNode(tenantID, t, LevelSubject, class, subjectName)
+		return err
+	})
+}
+
+// DeleteSubject deletes the subject with its topics
+func DeleteSubject(tenantID, className, subjectName string) error {
+	return DeleteTaxonomyNode(tenantID, TaxonomyNode{ClassName: className, SubjectName: subjectName}, nil)
+}
+
+func FetchSubjects(tenantID, className string) ([]string, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	class := t.resolve(TaxonomyNode{ClassName: className})
+	if class == nil {
+		return []string{}, nil
+	}
+	return t.childNames(class.NodeID), nil
+}
+
+// Topic operations. Inserting a topic creates its class and subject when
+// missing.
+func InsertTopic(tenantID, className, subjectName, topic string) error {
+	return retryTaxonomyWrite(tenantID, func(t *taxonomy) error {
+		class, err := ensureTaxonomyNode(tenantID, t, LevelClass, nil, className)
+		if err != nil {
+			return err
+		}
+		subject, err := ensureTaxonomyNode(tenantID, t, LevelSubject, class, subjectName)
+		if err != nil {
+			return err
+		}
+		_, err = ensureTaxonomyNode(tenantID, t, LevelTopic, subject, topic)
+		return err
+	})
+}
+
+func DeleteTopic(tenantID, className, subjectName, topic string) error {
+	return DeleteTaxonomyNode(tenantID, TaxonomyNode{ClassName: className, SubjectName: subjectName, Topic: topic}, nil)
+}
+
+func FetchTopics(tenantID, className, subjectName string) ([]string, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	subject := t.resolve(TaxonomyNode{ClassName: className, SubjectName: subjectName})
+	if subject == nil || subject.Level != LevelSubject {
+		return []string{}, nil
+	}
+	return t.childNames(subject.NodeID), nil
+}
+
+// DeleteTaxonomyNode deletes a class, subject or topic with everything under
+// it. A non-nil expectedVersion must match the node's version; without one
+// the delete is retried after concurrent changes. Deleting a missing node
+// does nothing.
+func DeleteTaxonomyNode(tenantID string, node TaxonomyNode, expectedVersion *int) error {
+	write := func(t *taxonomy) error {
+		item := t.resolve(node)
+		if item == nil || item.Level != node.level() {
+			return nil
+		}
+		if err := checkVersion(item.Version, expectedVersion); err != nil {
+			return err
+		}
+		return deleteTaxonomySubtree(tenantID, t, item, item.Version)
+	}
+	if expectedVersion != nil {
+		t, err := loadTaxonomy(tenantID)
+		if err != nil {
+			return err
+		}
+		return write(t)
+	}
+	return retryTaxonomyWrite(tenantID, write)
+}
+
+// CheckTaxonomyVersion returns ErrVersionConflict when a class, subject or
+// topic is no longer at expectedVersion, so that a change can be refused
+// before touching its dependents. A nil expectedVersion always passes.
+func CheckTaxonomyVersion(tenantID string, node TaxonomyNode, expectedVersion *int) error {
+	if expectedVersion == nil {
+		return nil
+	}
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return err
+	}
+	item := t.resolve(node)
+	if item == nil || item.Level != node.level() {
+		return ErrTaxonomyNodeNotFound
+	}
+	return checkVersion(item.Version, expectedVersion)
+}
+
+// TaxonomyMetadata holds the presentation fields of a node. Nil fields are
+// left as they are, and an empty display name removes that language.
+type TaxonomyMetadata struct {
+	DisplayNames map[string]string `json:"displayNames"`
+	SortOrder    *int              `json:"sortOrder"`
+	Icon         *string           `json:"icon"`
+	Active       *bool             `json:"active"`
+	Description  *string           `json:"description"`
+}
+
+// UpdateTaxonomyMetadata changes the presentation fields of a class, subject
+// or topic and returns the updated record
+func UpdateTaxonomyMetadata(tenantID string, node TaxonomyNode, metadata TaxonomyMetadata, expectedVersion *int) (*TaxonomyNodeItem, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	item := t.resolve(node)
+	if item == nil || item.Level != node.level() {
+		return nil, ErrTaxonomyNodeNotFound
+	}
+	if err := checkVersion(item.Version, expectedVersion); err != nil {
+		return nil, err
+	}
+
+	names := map[string]*string{"#name": aws.String("name")}
+	values := map[string]*dynamodb.AttributeValue{
+		":name": {S: aws.String(item.Name)},
+	}
+	var set, remove []string
+
+	if metadata.DisplayNames != nil {
+		displayNames := make(map[string]string)
+		for lang, name := range item.DisplayNames {
+			displayNames[lang] = name
+		}
+		for lang, name := range metadata.DisplayNames {
+			if name = strings.TrimSpace(name); name == "" {
+				delete(displayNames, lang)
+			} else {
+				displayNames[lang] = name
+			}
+		}
+		if len(displayNames) == 0 {
+			remove = append(remove, "display_names")
+		} else {
+			av, err := dynamodbattribute.Marshal(displayNames)
+			if err != nil {
+				return nil, err
+			}
+			set = append(set, "display_names = :displayNames")
+			values[":displayNames"] = av
+		}
+	}
+	if metadata.SortOrder != nil {
+		av, _ := dynamodbattribute.Marshal(*metadata.SortOrder)
+		set = append(set, "sort_order = :sortOrder")
+		values[":sortOrder"] = av
+	}
+	if metadata.Active != nil {
+		set = append(set, "active = :active")
+		values[":active"] = &dynamodb.AttributeValue{BOOL: aws.Bool(*metadata.Active)}
+	}
+	for attribute, value := range map[string]*string{"icon": metadata.Icon, "description": metadata.Description} {
+		if value == nil {
+			continue
+		}
+		if *value == "" {
+			remove = append(remove, attribute)
+			continue
+		}
+		set = append(set, attribute+" = :"+attribute)
+		values[":"+attribute] = &dynamodb.AttributeValue{S: aws.String(*value)}
+	}
+
+	if len(set) == 0 && len(remove) == 0 {
+		return item, nil
+	}
+	var update []string
+	if len(set) > 0 {
+		update = append(update, "SET "+strings.Join(set, ", "))
+	}
+	if len(remove) > 0 {
+		update = append(update, "REMOVE "+strings.Join(remove, ", "))
+	}
+	update = append(update, versionIncrement(names, values))
+	condition := "#name = :name"
+	if expectedVersion != nil {
+		condition += " AND " + versionCondition(*expectedVersion, names, values)
+	}
+
+	result, err := dynamoClient.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:                 aws.String("taxonomy_nodes"),
+		Key:                       taxonomyNodeKey(tenantID, item.NodeID),
+		UpdateExpression:          aws.String(strings.Join(update, " ")),
+		ConditionExpression:       aws.String(condition),
+		ExpressionAttributeNames:  names,
+		ExpressionAttributeValues: values,
+		ReturnValues:              aws.String("ALL_NEW"),
+	})
+	if err != nil {
+		if isConditionFailure(err) && expectedVersion != nil {
+			return nil, ErrVersionConflict
+		}
+		if isConditionFailure(err) {
+			return nil, ErrTaxonomyNodeNotFound
+		}
+		return nil, err
+	}
+
+	var updated TaxonomyNodeItem
+	if err := dynamodbattribute.UnmarshalMap(result.Attributes, &updated); err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+// TaxonomyTreeNode is a class, subject or topic as the app shows it
+type TaxonomyTreeNode struct {
+	ID           string             `json:"id"`
+	Name         string             `json:"name"`
+	DisplayName  string             `json:"displayName"`
+	DisplayNames map[string]string  `json:"displayNames"`
+	SortOrder    int                `json:"sortOrder"`
+	Icon         string             `json:"icon,omitempty"`
+	Active       bool               `json:"active"`
+	Description  string             `json:"description,omitempty"`
+	Version      int                `json:"version"`
+	UpgradeTo    []string           `json:"upgradeTo,omitempty"`
+	Subjects     []TaxonomyTreeNode `json:"subjects,omitempty"`
+	Topics       []TaxonomyTreeNode `json:"topics,omitempty"`
+}
+
+// FetchTaxonomyTree returns the tenant's classes with their subjects and
+// topics nested, in sort order, named in lang. Inactive nodes and everything
+// under them are left out unless includeInactive is set.
+func FetchTaxonomyTree(tenantID, lang string, includeInactive bool) ([]TaxonomyTreeNode, error) {
+	t, err := loadTaxonomy(tenantID)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := upgradeGraph(t)
+
+	var build func(parentID string) []TaxonomyTreeNode
+	build = func(parentID string) []TaxonomyTreeNode {
+		nodes := []TaxonomyTreeNode{}
+		for _, child := range t.children(parentID) {
+			if !child.Active && !includeInactive {
+				continue
+			}
+			displayNames := child.DisplayNames
+			if displayNames == nil {
+				displayNames = map[string]string{}
+			}
+			node := TaxonomyTreeNode{
+				ID:           child.NodeID,
+				Name:         child.Name,
+				DisplayName:  child.displayName(lang),
+				DisplayNames: displayNames,
+				SortOrder:    child.SortOrder,
+				Icon:         child.Icon,
+				Active:       child.Active,
+				Description:  child.Description,
+				Version:      child.Version,
+			}
+			switch child.Level {
+			case LevelClass:
+				node.UpgradeTo = graph[child.Name]
+				node.Subjects = build(child.NodeID)
+			case LevelSubject:
+				node.Topics = build(child.NodeID)
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes
+	}
+	return build(""), nil
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
+)
+
+// Tenant for rows written before institutes existed; they carry no tenant_id
+const DefaultTenantID = "default"
+
+// Tenant (institute) item structure
+type TenantItem struct {
+	TenantID string `json:"tenant_id" dynamodbav:"tenant_id"`
+	Name     string `json:"name" dynamodbav:"name"`
+	JoinCode string `json:"join_code,omitempty" dynamodbav:"join_code,omitempty"`
+	Active   bool   `json:"active" dynamodbav:"active"`
+}
+
+// GetTenantFromContext returns the institute of the tenant_id claim set by the
+// authorizer. Tokens without the claim fall back to the tenant of the caller's
+// students_info record, set when they registered with a join code, and then
+// to the default tenant. A failed lookup is returned rather than treated as
+// the default tenant, which would let the caller see its rows.
+func GetTenantFromContext(request events.APIGatewayProxyRequest) (string, error) {
+	if request.RequestContext.Authorizer != nil {
+		if tenantID, ok := request.RequestContext.Authorizer["tenant_id"].(string); ok && tenantID != "" {
+			return tenantID, nil
+		}
+	}
+	if uid, err := GetUserUIDFromContext(request); err == nil {
+		tenantID, ok, err := storedTenant(uid)
+		if err != nil {
+			return "", fmt.Errorf("looking up tenant of %s: %w", uid, err)
+		}
+		if ok {
+			return tenantID, nil
+		}
+	}
+	return DefaultTenantID, nil
+}
+
+// How long a tenant read from students_info is reused
+const tenantCacheTTL = 5 * time.Minute
+
+type tenantCacheEntry struct {
+	tenantID string
+	expires  time.Time
+}
+
+var (
+	tenantCache   = map[string]tenantCacheEntry{}
+	tenantCacheMu sync.Mutex
+)
+
+// storedTenant returns the tenant of a user's students_info record. Users
+// without a record are not cached, so registering takes effect at once.
+func storedTenant(uid string) (string, bool, error) {
+	now := time.Now()
+	tenantCacheMu.Lock()
+	entry, ok := tenantCache[uid]
+	tenantCacheMu.Unlock()
+	if ok && now.Before(entry.expires) {
+		return entry.tenantID, true, nil
+	}
+
+	student, err := getStudentInfoByUIDAnyTenant(uid)
+	if err != nil {
+		return "", false, err
+	}
+	if student == nil {
+		return "", false, nil
+	}
+
+	tenantID := normalizeTenantID(student.TenantID)
+	tenantCacheMu.Lock()
+	tenantCache[uid] = tenantCacheEntry{tenantID: tenantID, expires: now.Add(tenantCacheTTL)}
+	tenantCacheMu.Unlock()
+	return tenantID, true, nil
+}
+
+// InvalidateCachedTenant drops a user's cached tenant
+func InvalidateCachedTenant(uid string) {
+	tenantCacheMu.Lock()
+	defer tenantCacheMu.Unlock()
+	delete(tenantCache, uid)
+}
+
+func normalizeTenantID(tenantID string) string {
+	if tenantID == "" {
+		return DefaultTenantID
+	}
+	return tenantID
+}
+
+// scopedKey prefixes a key attribute with the tenant so that tenants cannot
+// collide on class or quiz names. Default tenant keys stay unprefixed.
+func scopedKey(tenantID, name string) string {
+	tenantID = normalizeTenantID(tenantID)
+	if tenantID == DefaultTenantID {
+		return name
+	}
+	return tenantID + "#" + name
+}
+
+// unscopedKey strips the tenant prefix added by scopedKey
+func unscopedKey(tenantID, key string) string {
+	tenantID = normalizeTenantID(tenantID)
+	if tenantID == DefaultTenantID {
+		return key
+	}
+	return strings.TrimPrefix(key, tenantID+"#")
+}
+
+// belongsToTenant treats rows without tenant_id as belonging to the default tenant
+func belongsToTenant(itemTenantID, tenantID string) bool {
+	return normalizeTenantID(itemTenantID) == normalizeTenantID(tenantID)
+}
+
+// tenantCondition returns a filter/condition expression restricting rows to the
+// tenant, and adds its placeholder value to values.
+func tenantCondition(tenantID string, values map[string]*dynamodb.AttributeValue) string {
+	tenantID = normalizeTenantID(tenantID)
+	values[":tenantId"] = &dynamodb.AttributeValue{S: aws.String(tenantID)}
+	if tenantID == DefaultTenantID {
+		return "(attribute_not_exists(tenant_id) OR tenant_id = :tenantId)"
+	}
+	return "tenant_id = :tenantId"
+}
+
+// Save tenant to DynamoDB
+func SaveTenantToDynamoDB(tenant TenantItem) error {
+	av, err := dynamodbattribute.MarshalMap(tenant)
+	if err != nil {
+		return err
+	}
+
+	_, err = dynamoClient.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String("tenants"),
+		Item:      av,
+	})
+	return err
+}
+
+// Get tenant by ID
+func GetTenant(tenantID string) (*TenantItem, error) {
+	result, err := dynamoClient.GetItem(&dynamodb.GetItemInput{
+		TableName: aws.String("tenants"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"tenant_id": {S: aws.String(tenantID)},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Item == nil {
+		return nil, nil
+	}
+
+	var tenant TenantItem
+	err = dynamodbattribute.UnmarshalMap(result.Item, &tenant)
+	return &tenant, err
+}
+
+// Fetch all tenants
+func FetchTenants() ([]TenantItem, error) {
+	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
+		TableName: aws.String("tenants"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tenants := []TenantItem{}
+	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &tenants)
+	return tenants, err
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type TenantRequest struct {
+	TenantID string `json:"tenantId"`
+	Name     string `json:"name"`
+	JoinCode string `json:"joinCode"`
+	Active   bool   `json:"active"`
+}
+
+// Tenant APIs
+func HandleTenantUpsert(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userRole, err := CheckAdminRole(request)
+	if err != nil {
+		log.Printf("❌ Permission denied: %v", err)
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	// Tenant admins' super role only covers their own institute
+	if userRole != "super" || tenantID != DefaultTenantID {
+		return CreateErrorResponse(403, "Only 'super' role of the main tenant can manage tenants"), nil
+	}
+
+	var req TenantRequest
+	if err := json.Unmarshal([]byte(request.Body), &req); err != nil {
+		return CreateErrorResponse(400, "Invalid request body"), nil
+	}
+
+	if req.TenantID == "" || req.Name == "" {
+		return CreateErrorResponse(400, "Missing 'tenantId' or 'name' parameter"), nil
+	}
+	// '#' separates the tenant from scoped key values
+	if strings.Contains(req.TenantID, "#") {
+		return CreateErrorResponse(400, "'tenantId' must not contain '#'"), nil
+	}
+	if req.TenantID != DefaultTenantID && req.JoinCode == "" {
+		return CreateErrorResponse(400, "Missing 'joinCode' parameter"), nil
+	}
+
+	tenant := TenantItem{
+		TenantID: req.TenantID,
+		Name:     req.Name,
+		JoinCode: req.JoinCode,
+		Active:   req.Active,
+	}
+
+	if err := SaveTenantToDynamoDB(tenant); err != nil {
+		log.Printf("Failed to save tenant: %v", err)
+		return CreateErrorResponse(500, "Failed to save tenant"), nil
+	}
+
+	return CreateSuccessResponse("Tenant saved successfully"), nil
+}
+
+func HandleTenantFetch(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	userRole, err := CheckAdminRole(request)
+	if err != nil {
+		return CreateErrorResponse(403, err.Error()), nil
+	}
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	// Tenant admins' super role only covers their own institute
+	if userRole != "super" || tenantID != DefaultTenantID {
+		return CreateErrorResponse(403, "Only 'super' role of the main tenant can view tenants"), nil
+	}
+
+	tenants, err := FetchTenants()
+	if err != nil {
+		log.Printf("Failed to fetch tenants: %v", err)
+		return CreateErrorResponse(500, "Failed to fetch tenants"), nil
+	}
+
+	response, _ := json.Marshal(tenants)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(response),
+	}, nil
+}
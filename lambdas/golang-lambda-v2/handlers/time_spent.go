@@ -0,0 +1,54 @@
+package handlers
+
+import "strconv"
+
+// Slack on the quiz duration for client clock drift and network delay
+const timeSpentGraceSec = 30
+
+// quizDurationSeconds reads a quiz duration in minutes, stored as a number or
+// as a string by older uploads
+func quizDurationSeconds(duration interface{}) (int, bool) {
+	var minutes float64
+	switch value := duration.(type) {
+	case float64:
+		minutes = value
+	case int:
+		minutes = float64(value)
+	case string:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, false
+		}
+		minutes = parsed
+	default:
+		return 0, false
+	}
+	if minutes <= 0 {
+		return 0, false
+	}
+	return int(minutes * 60), true
+}
+
+// validateTimeSpent checks reported times and answer changes, and that the
+// total time fits in the quiz duration. It returns a message for the first
+// problem found.
+func validateTimeSpent(answers []Answer, duration interface{}) string {
+	total := 0
+	for _, answer := range answers {
+		if answer.AnswerChanges < 0 {
+			return "'answerChanges' must not be negative"
+		}
+		if answer.TimeSpentSec == nil {
+			continue
+		}
+		if *answer.TimeSpentSec < 0 {
+			return "'timeSpentSec' must not be negative"
+		}
+		total += *answer.TimeSpentSec
+	}
+
+	if limit, ok := quizDurationSeconds(duration); ok && total > limit+timeSpentGraceSec {
+		return "Total 'timeSpentSec' exceeds the quiz duration"
+	}
+	return ""
+}
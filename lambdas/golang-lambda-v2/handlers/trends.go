@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"sort"
+	"time"
+)
+
+// Trend bucket sizes
+const (
+	TrendBucketDay  = "day"
+	TrendBucketWeek = "week"
+)
+
+type TrendPoint struct {
+	Bucket        string   `json:"bucket"` // day, or Monday of the ISO week
+	Attempts      int      `json:"attempts"`
+	Average       float64  `json:"average"`
+	MovingAverage float64  `json:"movingAverage"`
+	ClassAverage  *float64 `json:"classAverage"`
+}
+
+type SubjectTrend struct {
+	SubjectName  string       `json:"subjectName"`
+	Series       []TrendPoint `json:"series"`
+	Average      float64      `json:"average"`
+	ClassAverage *float64     `json:"classAverage"`
+}
+
+type Streaks struct {
+	Current    int    `json:"current"`
+	Longest    int    `json:"longest"`
+	ActiveDays int    `json:"activeDays"`
+	LastActive string `json:"lastActive,omitempty"`
+}
+
+// trendBucket returns the bucket an attempt time falls in
+func trendBucket(t time.Time, bucket string) string {
+	t = t.UTC()
+	if bucket == TrendBucketWeek {
+		// Back to Monday
+		offset := (int(t.Weekday()) + 6) % 7
+		t = t.AddDate(0, 0, -offset)
+	}
+	return t.Format("2006-01-02")
+}
+
+type bucketSum struct {
+	sum   float64
+	count int
+}
+
+func (b bucketSum) average() float64 {
+	if b.count == 0 {
+		return 0
+	}
+	return roundTo(b.sum/float64(b.count), 1)
+}
+
+// bucketAttempts groups attempt percentages by bucket, skipping attempts
+// before since or without a usable time
+func bucketAttempts(attempts []AttemptItem, bucket string, since time.Time) map[string]*bucketSum {
+	buckets := make(map[string]*bucketSum)
+	for _, attempt := range attempts {
+		at, ok := parseSubExpDate(attempt.AttemptedAt)
+		if !ok || at.Before(since) {
+			continue
+		}
+		key := trendBucket(at, bucket)
+		if buckets[key] == nil {
+			buckets[key] = &bucketSum{}
+		}
+		buckets[key].sum += attemptPercentage(attempt)
+		buckets[key].count++
+	}
+	return buckets
+}
+
+// BuildSubjectTrend builds a subject's series with a trailing moving average
+// over the last window buckets that have attempts, and the class average per
+// bucket when class attempts are given
+func BuildSubjectTrend(subjectName string, attempts, classAttempts []AttemptItem, bucket string, window int, since time.Time) SubjectTrend {
+	own := bucketAttempts(attempts, bucket, since)
+	class := bucketAttempts(classAttempts, bucket, since)
+
+	keys := make([]string, 0, len(own))
+	for key := range own {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	trend := SubjectTrend{SubjectName: subjectName, Series: []TrendPoint{}}
+	var total bucketSum
+	for i, key := range keys {
+		var moving bucketSum
+		for j := i; j >= 0 && j > i-window; j-- {
+			moving.sum += own[keys[j]].average()
+			moving.count++
+		}
+
+		point := TrendPoint{
+			Bucket:        key,
+			Attempts:      own[key].count,
+			Average:       own[key].average(),
+			MovingAverage: moving.average(),
+		}
+		if classBucket := class[key]; classBucket != nil {
+			classAverage := classBucket.average()
+			point.ClassAverage = &classAverage
+		}
+		trend.Series = append(trend.Series, point)
+
+		total.sum += own[key].sum
+		total.count += own[key].count
+	}
+	trend.Average = total.average()
+
+	var classTotal bucketSum
+	for _, classBucket := range class {
+		classTotal.sum += classBucket.sum
+		classTotal.count += classBucket.count
+	}
+	if classTotal.count > 0 {
+		classAverage := classTotal.average()
+		trend.ClassAverage = &classAverage
+	}
+	return trend
+}
+
+// ComputeStreaks counts consecutive days with at least one attempt. The current
+// streak is still alive if the last active day was today or yesterday.
+func ComputeStreaks(attempts []AttemptItem, now time.Time) Streaks {
+	days := make(map[string]bool)
+	for _, attempt := range attempts {
+		if at, ok := parseSubExpDate(attempt.AttemptedAt); ok {
+			days[at.Format("2006-01-02")] = true
+		}
+	}
+
+	sorted := make([]string, 0, len(days))
+	for day := range days {
+		sorted = append(sorted, day)
+	}
+	sort.Strings(sorted)
+
+	streaks := Streaks{ActiveDays: len(sorted)}
+	if len(sorted) == 0 {
+		return streaks
+	}
+	streaks.LastActive = sorted[len(sorted)-1]
+
+	run := 0
+	var previous time.Time
+	for _, day := range sorted {
+		t, _ := time.Parse("2006-01-02", day)
+		if run > 0 && t.Sub(previous) == 24*time.Hour {
+			run++
+		} else {
+			run = 1
+		}
+		if run > streaks.Longest {
+			streaks.Longest = run
+		}
+		previous = t
+	}
+
+	today := now.UTC().Format("2006-01-02")
+	yesterday := now.UTC().AddDate(0, 0, -1).Format("2006-01-02")
+	if streaks.LastActive == today || streaks.LastActive == yesterday {
+		streaks.Current = run
+	}
+	return streaks
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	defaultTrendDays   = 90
+	maxTrendDays       = 365
+	defaultTrendWindow = 3
+)
+
+// HandleStudentTrends returns per-subject score series for the caller.
+// Optional parameters: subjectName, bucket (day|week), days (history length)
+// and window (buckets in the moving average).
+func HandleStudentTrends(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	params := request.QueryStringParameters
+	bucket := params["bucket"]
+	if bucket == "" {
+		bucket = TrendBucketDay
+	}
+	if bucket != TrendBucketDay && bucket != TrendBucketWeek {
+		return CreateErrorResponse(400, "'bucket' must be 'day' or 'week'"), nil
+	}
+
+	days := defaultTrendDays
+	if daysStr := params["days"]; daysStr != "" {
+		days, err = strconv.Atoi(daysStr)
+		if err != nil || days <= 0 || days > maxTrendDays {
+			return CreateErrorResponse(400, "'days' must be between 1 and 365"), nil
+		}
+	}
+
+	window := defaultTrendWindow
+	if windowStr := params["window"]; windowStr != "" {
+		window, err = strconv.Atoi(windowStr)
+		if err != nil || window <= 0 {
+			return CreateErrorResponse(400, "'window' must be positive"), nil
+		}
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+
+	subjects, err := FetchSubjects(tenantID, student.StudentClass)
+	if err != nil {
+		log.Printf("❌ Error fetching subjects: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if subjectName := params["subjectName"]; subjectName != "" {
+		if !containsString(subjects, subjectName) {
+			return CreateErrorResponse(404, "Subject not found for student class"), nil
+		}
+		subjects = []string{subjectName}
+	}
+
+	attempts, err := GetAttemptHistory(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error querying attempt history: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	attempts = withoutPracticeAttempts(attempts)
+
+	now := time.Now()
+	since := now.UTC().AddDate(0, 0, -days)
+
+	enrolledAttempts := []AttemptItem{}
+	subjectAttempts := make(map[string][]AttemptItem)
+	for _, attempt := range attempts {
+		if attempt.ClassName == student.StudentClass && containsString(subjects, attempt.Category) {
+			subjectAttempts[attempt.Category] = append(subjectAttempts[attempt.Category], attempt)
+			enrolledAttempts = append(enrolledAttempts, attempt)
+		}
+	}
+
+	trends := []SubjectTrend{}
+	for _, subject := range subjects {
+		classSubjectAttempts, err := FetchClassSubjectAttempts(tenantID, student.StudentClass, subject, since)
+		if err != nil {
+			log.Printf("⚠️ Error fetching class attempts for %s: %v", subject, err)
+		}
+		trends = append(trends, BuildSubjectTrend(subject, subjectAttempts[subject], classSubjectAttempts, bucket, window, since))
+	}
+
+	response := map[string]interface{}{
+		"uid":       uid,
+		"className": student.StudentClass,
+		"bucket":    bucket,
+		"since":     since.Format("2006-01-02"),
+		"subjects":  trends,
+		"streaks":   ComputeStreaks(enrolledAttempts, now),
+	}
+
+	responseJSON, _ := json.Marshal(response)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}, nil
+}
@@ -5,8 +5,6 @@ import (
 	"log"
 
 	"github.com/aws/aws-lambda-go/events"
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
 
 func HandleUnattemptedQuizzesV2(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
@@ -29,33 +27,13 @@ func HandleUnattemptedQuizzesV2(request events.APIGatewayProxyRequest) (events.A
 
 	log.Printf("📌 Fetching unattempted quizzes for: %s, Class: %s, Subject: %s, Topic: %s", uid, className, subjectName, topic)
 
-	// Build filter expression based on parameters
-	var filterExpression string
-	var expressionAttributeValues map[string]*dynamodb.AttributeValue
-
-	if topic != "" {
-		// Filter by class, subject, and topic
-		filterExpression = "class_name = :className AND subject_name = :subjectName AND topic = :topic"
-		expressionAttributeValues = map[string]*dynamodb.AttributeValue{
-			":className":   {S: aws.String(className)},
-			":subjectName": {S: aws.String(subjectName)},
-			":topic":       {S: aws.String(topic)},
-		}
-	} else {
-		// Filter by class and subject only
-		filterExpression = "class_name = :className AND subject_name = :subjectName"
-		expressionAttributeValues = map[string]*dynamodb.AttributeValue{
-			":className":   {S: aws.String(className)},
-			":subjectName": {S: aws.String(subjectName)},
-		}
+	// Get all quizzes matching criteria (topic is optional)
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
 	}
-
-	// Get all quizzes matching criteria
-	result, err := dynamoClient.Scan(&dynamodb.ScanInput{
-		TableName:                 aws.String("quiz_questions"),
-		FilterExpression:          aws.String(filterExpression),
-		ExpressionAttributeValues: expressionAttributeValues,
-	})
+	quizzes, err := ListQuizzes(tenantID, className, subjectName, topic)
 
 	if err != nil {
 		log.Printf("❌ Error scanning quizzes: %v", err)
@@ -63,14 +41,7 @@ func HandleUnattemptedQuizzesV2(request events.APIGatewayProxyRequest) (events.A
 	}
 
 	// Get attempted quizzes for student
-	attemptResult, err := dynamoClient.Query(&dynamodb.QueryInput{
-		TableName: aws.String("student_quiz_attempts_v2"),
-		KeyConditionExpression: aws.String("uid = :uid"),
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":uid": {S: aws.String(uid)},
-		},
-	})
-
+	attempts, err := GetStudentAttempts(tenantID, uid)
 	if err != nil {
 		log.Printf("❌ Error querying attempts: %v", err)
 		return CreateErrorResponse(500, "Internal Server Error"), nil
@@ -78,18 +49,14 @@ func HandleUnattemptedQuizzesV2(request events.APIGatewayProxyRequest) (events.A
 
 	// Create map of attempted quiz names
 	attemptedQuizzes := make(map[string]bool)
-	for _, item := range attemptResult.Items {
-		if quizName := item["quiz_name"]; quizName != nil && quizName.S != nil {
-			attemptedQuizzes[*quizName.S] = true
-		}
+	for _, attempt := range attempts {
+		attemptedQuizzes[attempt.QuizName] = true
 	}
 
 	// Return all quizzes (allow retakes)
 	var unattemptedQuizzes []string
-	for _, item := range result.Items {
-		if quizName := item["quiz_name"]; quizName != nil && quizName.S != nil {
-			unattemptedQuizzes = append(unattemptedQuizzes, *quizName.S)
-		}
+	for _, quiz := range quizzes {
+		unattemptedQuizzes = append(unattemptedQuizzes, quiz.QuizName)
 	}
 
 	response := map[string]interface{}{
@@ -0,0 +1,330 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// The v1 routes below are still called by old app versions. They are served
+// from v2 storage by translating to the v2 handlers: v1 names a quiz's class
+// and subject with one category such as CLS10-MATHS, and passes the caller's
+// email where v2 uses the uid of the token.
+
+// v1 categories whose quizzes are named <category>-<month>-<day>-..., of
+// which only today's are listed
+var v1DateFilteredCategories = map[string]bool{
+	"CLS11-MPC-EAMCET": true, "CLS11-MPC-JEEMAINS": true, "CLS11-MPC-JEEADV": true,
+	"CLS12-MPC-EAMCET": true, "CLS12-MPC-JEEMAINS": true, "CLS12-MPC-JEEADV": true,
+	"CLS11-BIPC-EAPCET": true, "CLS11-BIPC-NEET": true,
+	"CLS12-BIPC-EAPCET": true, "CLS12-BIPC-NEET": true,
+}
+
+type V1QuestionResult struct {
+	Qno           int      `json:"qno"`
+	Question      string   `json:"question"`
+	Status        string   `json:"status"`
+	StudentAnswer []string `json:"studentAnswer"`
+	CorrectAnswer []string `json:"correctAnswer"`
+	Explanation   string   `json:"explanation"`
+}
+
+type V1SubmitResponse struct {
+	CorrectCount int                `json:"correctCount"`
+	WrongCount   int                `json:"wrongCount"`
+	SkippedCount int                `json:"skippedCount"`
+	TotalCount   int                `json:"totalCount"`
+	Percentage   float64            `json:"percentage"`
+	Results      []V1QuestionResult `json:"results"`
+}
+
+type V1ProgressSummary struct {
+	Category    string  `json:"category"`
+	Percentage  float64 `json:"percentage"`
+	Attempted   int     `json:"attempted"`
+	Unattempted int     `json:"unattempted"`
+}
+
+type V1TestScore struct {
+	QuizName      string  `json:"quizName"`
+	Category      string  `json:"category"`
+	CorrectCount  int     `json:"correctCount"`
+	WrongCount    int     `json:"wrongCount"`
+	SkippedCount  int     `json:"skippedCount"`
+	TotalCount    int     `json:"totalCount"`
+	Percentage    float64 `json:"percentage"`
+	TotalAttempts int     `json:"totalAttempts"`
+	LatestScore   float64 `json:"latestScore"`
+	AttemptedAt   string  `json:"attemptedAt"`
+}
+
+type V1ProgressResponse struct {
+	Email           string                   `json:"email"`
+	CategorySummary []V1ProgressSummary      `json:"categorySummary"`
+	IndividualTests map[string][]V1TestScore `json:"individualTests"`
+}
+
+// v1Category joins a class and subject into a v1 category
+func v1Category(className, subjectName string) string {
+	return className + "-" + subjectName
+}
+
+// v1EmailDenied rejects a request whose email parameter is not the caller's.
+// The email is optional; the token decides who the caller is.
+func v1EmailDenied(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, bool) {
+	email := request.QueryStringParameters["email"]
+	if email == "" {
+		return events.APIGatewayProxyResponse{}, false
+	}
+	callerEmail, err := GetUserFromContext(request)
+	if err != nil || !strings.EqualFold(strings.TrimSpace(email), callerEmail) {
+		return CreateErrorResponse(403, "Email does not match the signed-in user"), true
+	}
+	return events.APIGatewayProxyResponse{}, false
+}
+
+// v1QuizRequest looks up the quiz a v1 request names and returns the request
+// with the quiz's class, subject and topic added for the v2 handlers
+func v1QuizRequest(request events.APIGatewayProxyRequest) (events.APIGatewayProxyRequest, *QuizItem, events.APIGatewayProxyResponse, bool) {
+	quizName := request.QueryStringParameters["quizName"]
+	if quizName == "" {
+		return request, nil, CreateErrorResponse(400, "Missing 'quizName' parameter"), true
+	}
+	if resp, denied := v1EmailDenied(request); denied {
+		return request, nil, resp, true
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return request, nil, CreateErrorResponse(500, "Internal Server Error"), true
+	}
+	quiz, err := getQuizItem(tenantID, quizName)
+	if err != nil {
+		log.Printf("❌ Error fetching quiz: %v", err)
+		return request, nil, CreateErrorResponse(500, "Internal Server Error"), true
+	}
+	if quiz == nil {
+		return request, nil, CreateErrorResponse(404, fmt.Sprintf("Quiz not found: %s", quizName)), true
+	}
+
+	params := map[string]string{
+		"quizName":    quizName,
+		"className":   quiz.ClassName,
+		"subjectName": quiz.SubjectName,
+		"topic":       quiz.Topic,
+	}
+	request.QueryStringParameters = params
+	return request, quiz, events.APIGatewayProxyResponse{}, false
+}
+
+// v1JSONResponse returns a v1 response body
+func v1JSONResponse(body interface{}) events.APIGatewayProxyResponse {
+	responseJSON, _ := json.Marshal(body)
+	return events.APIGatewayProxyResponse{
+		StatusCode: 200,
+		Headers:    GetCORSHeaders(),
+		Body:       string(responseJSON),
+	}
+}
+
+// HandleV1QuizGetByName serves /quiz/get-by-name with the v2 quiz handler
+func HandleV1QuizGetByName(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	v2Request, quiz, resp, done := v1QuizRequest(request)
+	if done {
+		return resp, nil
+	}
+
+	v2Response, err := HandleQuizGetByNameV2(v2Request)
+	if err != nil || v2Response.StatusCode != 200 {
+		return v2Response, err
+	}
+
+	var fetched struct {
+		Quiz struct {
+			QuizName  string      `json:"quizName"`
+			Duration  interface{} `json:"duration"`
+			Questions []struct {
+				Question   string   `json:"question"`
+				AllAnswers []string `json:"allAnswers"`
+			} `json:"questions"`
+		} `json:"quiz"`
+	}
+	if err := json.Unmarshal([]byte(v2Response.Body), &fetched); err != nil {
+		log.Printf("❌ Error reading v2 quiz response: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	questions := []map[string]interface{}{}
+	for _, question := range fetched.Quiz.Questions {
+		questions = append(questions, map[string]interface{}{
+			"question":   question.Question,
+			"allAnswers": question.AllAnswers,
+		})
+	}
+
+	return v1JSONResponse(map[string]interface{}{
+		"message": "Quiz fetched and updated successfully",
+		"quiz": map[string]interface{}{
+			"quizName":  fetched.Quiz.QuizName,
+			"duration":  fetched.Quiz.Duration,
+			"category":  v1Category(quiz.ClassName, quiz.SubjectName),
+			"questions": questions,
+		},
+	}), nil
+}
+
+// HandleV1QuizSubmit serves /quiz/submit with the v2 submit handler, so the
+// attempt is stored like any v2 attempt
+func HandleV1QuizSubmit(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	v2Request, _, resp, done := v1QuizRequest(request)
+	if done {
+		return resp, nil
+	}
+
+	v2Response, err := HandleQuizSubmitV2(v2Request)
+	if err != nil || v2Response.StatusCode != 200 {
+		return v2Response, err
+	}
+
+	var submitted V1SubmitResponse
+	if err := json.Unmarshal([]byte(v2Response.Body), &submitted); err != nil {
+		log.Printf("❌ Error reading v2 submit response: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	return v1JSONResponse(submitted), nil
+}
+
+// HandleV1StudentProgress serves /students/progress with the v2 progress
+// handler, keyed by category instead of subject
+func HandleV1StudentProgress(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	email, err := GetUserFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	v2Response, err := HandleStudentProgressV2(request)
+	if err != nil || v2Response.StatusCode != 200 {
+		return v2Response, err
+	}
+
+	var progress ProgressResponse
+	if err := json.Unmarshal([]byte(v2Response.Body), &progress); err != nil {
+		log.Printf("❌ Error reading v2 progress response: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	response := V1ProgressResponse{
+		Email:           strings.ToLower(email),
+		CategorySummary: []V1ProgressSummary{},
+		IndividualTests: make(map[string][]V1TestScore),
+	}
+	for _, summary := range progress.SubjectSummary {
+		response.CategorySummary = append(response.CategorySummary, V1ProgressSummary{
+			Category:    v1Category(progress.ClassName, summary.SubjectName),
+			Percentage:  summary.Percentage,
+			Attempted:   summary.Attempted,
+			Unattempted: summary.Unattempted,
+		})
+	}
+	for subject, tests := range progress.IndividualTests {
+		category := v1Category(progress.ClassName, subject)
+		for _, test := range tests {
+			response.IndividualTests[category] = append(response.IndividualTests[category], V1TestScore{
+				QuizName:      test.QuizName,
+				Category:      category,
+				CorrectCount:  test.CorrectCount,
+				WrongCount:    test.WrongCount,
+				SkippedCount:  test.SkippedCount,
+				TotalCount:    test.TotalCount,
+				Percentage:    test.Percentage,
+				TotalAttempts: test.TotalAttempts,
+				LatestScore:   test.LatestScore,
+				AttemptedAt:   test.AttemptedAt,
+			})
+		}
+		// v1 listed the latest attempts first
+		sort.SliceStable(response.IndividualTests[category], func(i, j int) bool {
+			return response.IndividualTests[category][i].AttemptedAt > response.IndividualTests[category][j].AttemptedAt
+		})
+	}
+
+	return v1JSONResponse(response), nil
+}
+
+// HandleV1UnattemptedQuizzes serves /quiz/unattempted-quizzes. Unlike v2,
+// which lists every quiz to allow retakes, v1 leaves out attempted quizzes.
+func HandleV1UnattemptedQuizzes(request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	category := request.QueryStringParameters["category"]
+	if category == "" || request.QueryStringParameters["email"] == "" {
+		return CreateErrorResponse(400, "Category and student email are required"), nil
+	}
+	if resp, denied := v1EmailDenied(request); denied {
+		return resp, nil
+	}
+	className, subjectName, ok := SplitCategory(category)
+	if !ok {
+		return CreateErrorResponse(400, "Invalid 'category' parameter"), nil
+	}
+
+	uid, err := GetUserUIDFromContext(request)
+	if err != nil {
+		return CreateErrorResponse(401, "Unauthorized"), nil
+	}
+
+	tenantID, err := GetTenantFromContext(request)
+	if err != nil {
+		log.Printf("❌ Error resolving tenant: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	student, err := GetStudentInfoByUID(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error fetching student: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	if student == nil {
+		return CreateErrorResponse(404, "Student not found"), nil
+	}
+	if resp, denied := subscriptionDeniedResponse(student, className, subjectName); denied {
+		return resp, nil
+	}
+
+	quizzes, err := ListQuizzes(tenantID, className, subjectName, "")
+	if err != nil {
+		log.Printf("❌ Error fetching quizzes: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+	attempts, err := GetStudentAttempts(tenantID, uid)
+	if err != nil {
+		log.Printf("❌ Error querying attempts: %v", err)
+		return CreateErrorResponse(500, "Internal Server Error"), nil
+	}
+
+	attempted := make(map[string]bool)
+	for _, attempt := range attempts {
+		attempted[attempt.QuizName] = true
+	}
+
+	var todayPrefix string
+	if v1DateFilteredCategories[category] {
+		now := time.Now()
+		todayPrefix = fmt.Sprintf("%s-%d-%d-", category, int(now.Month()), now.Day())
+	}
+
+	unattempted := []string{}
+	for _, quiz := range quizzes {
+		if attempted[quiz.QuizName] || !strings.HasPrefix(quiz.QuizName, todayPrefix) {
+			continue
+		}
+		unattempted = append(unattempted, quiz.QuizName)
+	}
+
+	return v1JSONResponse(map[string]interface{}{
+		"unattempted_quizzes": unattempted,
+	}), nil
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Quizzes and taxonomy nodes carry a version that every write increments.
+// An edit may pass the version it was based on in the expectedVersion query
+// parameter, whatever the shape of its body, and is refused with
+// ErrVersionConflict when the item changed in the meantime.
+// Items written before versioning count as version 0.
+
+var ErrVersionConflict = errors.New("item was changed by someone else")
+
+// versionCondition returns a condition that the item is still at version
+// expected, and adds its placeholders to names and values
+func versionCondition(expected int, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	names["#version"] = aws.String("version")
+	values[":expectedVersion"] = &dynamodb.AttributeValue{N: aws.String(strconv.Itoa(expected))}
+	if expected == 0 {
+		return "(attribute_not_exists(#version) OR #version = :expectedVersion)"
+	}
+	return "#version = :expectedVersion"
+}
+
+// versionIncrement returns an ADD clause raising the item's version by one,
+// and adds its placeholders to names and values
+func versionIncrement(names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	names["#version"] = aws.String("version")
+	values[":versionStep"] = &dynamodb.AttributeValue{N: aws.String("1")}
+	return "ADD #version :versionStep"
+}
+
+// checkVersion compares an item's current version with the one an edit was
+// based on; a nil expected version skips the check
+func checkVersion(current int, expected *int) error {
+	if expected != nil && *expected != current {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// parseExpectedVersion reads the optional expectedVersion query parameter
+func parseExpectedVersion(request events.APIGatewayProxyRequest) (*int, error) {
+	value := request.QueryStringParameters["expectedVersion"]
+	if value == "" {
+		return nil, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 0 {
+		return nil, fmt.Errorf("invalid 'expectedVersion' parameter")
+	}
+	return &version, nil
+}
+
+// versionConflictResponse returns 409 for an edit based on an outdated
+// version
+func versionConflictResponse(what string) events.APIGatewayProxyResponse {
+	return CreateErrorResponse(409, fmt.Sprintf("The %s was changed by someone else; reload it and retry", what))
+}
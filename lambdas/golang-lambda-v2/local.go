@@ -0,0 +1,59 @@
+package main
+
+import (
+	"io"
+	"log"
+	"net/http"
+
+	"go-upload-excel/handlers"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// serveLocal runs lambdaHandler behind a plain HTTP server for development.
+// Without API Gateway there is no authorizer, so set FIREBASE_VERIFY_TOKENS
+// (and FIREBASE_JWKS_URL for test keys) to authenticate requests:
+//
+//	LOCAL_ADDR=:8080 FIREBASE_VERIFY_TOKENS=true FIREBASE_PROJECT_ID=demo \
+//	  FIREBASE_JWKS_URL=dev-jwks.json DYNAMODB_ENDPOINT=http://localhost:8000 go run .
+func serveLocal(addr string) {
+	if handlers.GetFirebaseVerifier() == nil {
+		log.Printf("⚠️ FIREBASE_VERIFY_TOKENS is not set; requests will have no user")
+	}
+
+	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		request := events.APIGatewayProxyRequest{
+			Path:                  r.URL.Path,
+			HTTPMethod:            r.Method,
+			Headers:               map[string]string{},
+			QueryStringParameters: map[string]string{},
+			Body:                  string(body),
+		}
+		for name := range r.Header {
+			request.Headers[name] = r.Header.Get(name)
+		}
+		for name := range r.URL.Query() {
+			request.QueryStringParameters[name] = r.URL.Query().Get(name)
+		}
+
+		response, err := lambdaHandler(request)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for name, value := range response.Headers {
+			w.Header().Set(name, value)
+		}
+		w.WriteHeader(response.StatusCode)
+		w.Write([]byte(response.Body))
+	})
+
+	log.Printf("🚀 Serving on %s", addr)
+	log.Fatal(http.ListenAndServe(addr, nil))
+}
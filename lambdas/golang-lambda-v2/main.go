@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"os"
 
 	"go-upload-excel/handlers"
 
@@ -24,6 +26,14 @@ func lambdaHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProx
 		}, nil
 	}
 
+	// Verify the ID token here when not relying on the API Gateway authorizer
+	if verifier := handlers.GetFirebaseVerifier(); verifier != nil {
+		if _, err := verifier.AuthenticateRequest(&request); err != nil && !errors.Is(err, handlers.ErrNoIDToken) {
+			log.Printf("❌ Token verification failed: %v", err)
+			return handlers.CreateErrorResponse(401, "Unauthorized"), nil
+		}
+	}
+
 	switch request.Path {
 	case "/v2/upload/questions":
 		return handlers.HandleQuizUploadV2(request)
@@ -49,26 +59,119 @@ func lambdaHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProx
 		return handlers.HandleQuizResultV2(request)
 	case "/v2/students/upgrade-class":
 		return handlers.HandleStudentClassUpgradeV2(request)
+	case "/v2/students/history":
+		return handlers.HandleStudentHistory(request)
+	case "/v2/class/upgrades":
+		return handlers.HandleUpgradeGraphFetch(request)
+	case "/v2/class/upgrades/update":
+		return handlers.HandleUpgradeGraphUpdate(request)
+	case "/v2/class/promote":
+		return handlers.HandleClassPromote(request)
 	case "/v2/class/insert":
 		return handlers.HandleClassInsert(request)
 	case "/v2/class/delete":
 		return handlers.HandleClassDelete(request)
+	case "/v2/class/rename":
+		return handlers.HandleClassRename(request)
 	case "/v2/class/fetch":
 		return handlers.HandleClassFetch(request)
 	case "/v2/subject/insert":
 		return handlers.HandleSubjectInsert(request)
 	case "/v2/subject/delete":
 		return handlers.HandleSubjectDelete(request)
+	case "/v2/subject/rename":
+		return handlers.HandleSubjectRename(request)
 	case "/v2/subject/fetch":
 		return handlers.HandleSubjectFetch(request)
 	case "/v2/topic/insert":
 		return handlers.HandleTopicInsert(request)
 	case "/v2/topic/delete":
 		return handlers.HandleTopicDelete(request)
+	case "/v2/topic/rename":
+		return handlers.HandleTopicRename(request)
 	case "/v2/topic/fetch":
 		return handlers.HandleTopicFetch(request)
+	case "/v2/taxonomy/tree":
+		return handlers.HandleTaxonomyTree(request)
+	case "/v2/taxonomy/update":
+		return handlers.HandleTaxonomyUpdate(request)
 	case "/v2/students/lookup":
 		return handlers.HandleStudentLookup(request)
+	case "/v2/users/role":
+		return handlers.HandleUserRoleSet(request)
+	case "/v2/plans/upsert":
+		return handlers.HandlePlanUpsert(request)
+	case "/v2/plans/fetch":
+		return handlers.HandlePlanFetch(request)
+	case "/v2/students/payments":
+		return handlers.HandlePaymentHistory(request)
+	case "/v2/payments/order":
+		return handlers.HandlePaymentOrderCreate(request)
+	case "/v2/payments/webhook":
+		return handlers.HandlePaymentWebhook(request)
+	case "/v2/payments/fake-capture":
+		return handlers.HandleFakePaymentCapture(request)
+	case "/v2/coupons/upsert":
+		return handlers.HandleCouponUpsert(request)
+	case "/v2/coupons/fetch":
+		return handlers.HandleCouponFetch(request)
+	case "/v2/coupons/validate":
+		return handlers.HandleCouponValidate(request)
+	case "/v2/tenants/upsert":
+		return handlers.HandleTenantUpsert(request)
+	case "/v2/tenants/fetch":
+		return handlers.HandleTenantFetch(request)
+	case "/v2/batches/upsert":
+		return handlers.HandleBatchUpsert(request)
+	case "/v2/batches/fetch":
+		return handlers.HandleBatchFetch(request)
+	case "/v2/batches/members":
+		return handlers.HandleBatchMembers(request)
+	case "/v2/assignments/create":
+		return handlers.HandleAssignmentCreate(request)
+	case "/v2/assignments/delete":
+		return handlers.HandleAssignmentDelete(request)
+	case "/v2/assignments/report":
+		return handlers.HandleAssignmentReport(request)
+	case "/v2/students/assignments":
+		return handlers.HandleStudentAssignments(request)
+	case "/v2/quiz/item-analysis":
+		return handlers.HandleQuizItemAnalysis(request)
+	case "/v2/leaderboard":
+		return handlers.HandleLeaderboard(request)
+	case "/v2/students/leaderboard-opt-out":
+		return handlers.HandleLeaderboardOptOut(request)
+	case "/v2/students/trends":
+		return handlers.HandleStudentTrends(request)
+	case "/v2/reviews/due":
+		return handlers.HandleDueReviews(request)
+	case "/v2/reviews/answer":
+		return handlers.HandleReviewAnswer(request)
+	case "/v2/quiz/practice/create":
+		return handlers.HandlePracticeQuizCreate(request)
+	case "/v2/questions/upsert":
+		return handlers.HandleBankQuestionUpsert(request)
+	case "/v2/questions/get":
+		return handlers.HandleBankQuestionGet(request)
+	case "/v2/questions/search":
+		return handlers.HandleBankQuestionSearch(request)
+	case "/v2/questions/delete":
+		return handlers.HandleBankQuestionDelete(request)
+	case "/v2/adaptive/start":
+		return handlers.HandleAdaptiveStart(request)
+	case "/v2/adaptive/next":
+		return handlers.HandleAdaptiveNext(request)
+	case "/v2/adaptive/answer":
+		return handlers.HandleAdaptiveAnswer(request)
+	// v1 routes still called by old app versions
+	case "/quiz/get-by-name":
+		return handlers.HandleV1QuizGetByName(request)
+	case "/quiz/submit":
+		return handlers.HandleV1QuizSubmit(request)
+	case "/quiz/unattempted-quizzes":
+		return handlers.HandleV1UnattemptedQuizzes(request)
+	case "/students/progress":
+		return handlers.HandleV1StudentProgress(request)
 	default:
 		log.Printf("❌ Invalid API Path: %s", request.Path)
 		return events.APIGatewayProxyResponse{
@@ -80,6 +183,10 @@ func lambdaHandler(request events.APIGatewayProxyRequest) (events.APIGatewayProx
 }
 
 func main() {
+	if addr := os.Getenv("LOCAL_ADDR"); addr != "" {
+		serveLocal(addr)
+		return
+	}
 	log.Printf("🚀 Starting Lambda function...")
 	lambda.Start(lambdaHandler)
 }
@@ -63,7 +63,20 @@ export class ApiLambdaStack extends cdk.Stack {
           ec2.Subnet.fromSubnetId(this, 'PrivateSubnet2V2', 'subnet-0fc698411d47497d8')
         ]
       },
-      securityGroups: props?.lambdaSecurityGroup ? [props.lambdaSecurityGroup] : undefined
+      securityGroups: props?.lambdaSecurityGroup ? [props.lambdaSecurityGroup] : undefined,
+      environment: {
+        SUBSCRIPTION_GRACE_DAYS: '3',
+        MASTERY_HALF_LIFE_DAYS: '30',
+        PAYMENT_PROVIDER: 'razorpay',
+        RAZORPAY_KEY_ID: '',
+        RAZORPAY_KEY_SECRET: '',
+        PAYMENT_WEBHOOK_SECRET: '',
+        ROLE_CACHE_TTL_SECONDS: '60',
+        // Service account used to keep the role custom claims in sync
+        FIREBASE_PROJECT_ID: 'gothinkersteach',
+        FIREBASE_PRIVATE_KEY: '',
+        FIREBASE_CLIENT_EMAIL: ''
+      }
     });
 
     // Migration Lambda removed
@@ -77,7 +90,8 @@ export class ApiLambdaStack extends cdk.Stack {
         'dynamodb:UpdateItem',
         'dynamodb:DeleteItem',
         'dynamodb:Query',
-        'dynamodb:Scan'
+        'dynamodb:Scan',
+        'dynamodb:BatchGetItem'
       ],
       resources: [
         'arn:aws:dynamodb:*:*:table/quiz_questions',
@@ -87,7 +101,28 @@ export class ApiLambdaStack extends cdk.Stack {
         'arn:aws:dynamodb:*:*:table/student_quiz_attempts_v2',
         'arn:aws:dynamodb:*:*:table/student_quiz_attempts_v2/index/*',
         'arn:aws:dynamodb:*:*:table/student_quizzes_v2',
-        'arn:aws:dynamodb:*:*:table/class_subjects'
+        'arn:aws:dynamodb:*:*:table/class_subjects',
+        'arn:aws:dynamodb:*:*:table/subscription_plans',
+        'arn:aws:dynamodb:*:*:table/student_payments',
+        'arn:aws:dynamodb:*:*:table/payment_orders',
+        'arn:aws:dynamodb:*:*:table/coupons',
+        'arn:aws:dynamodb:*:*:table/coupon_redemptions',
+        'arn:aws:dynamodb:*:*:table/tenants',
+        'arn:aws:dynamodb:*:*:table/batches',
+        'arn:aws:dynamodb:*:*:table/assignments',
+        'arn:aws:dynamodb:*:*:table/quiz_item_stats',
+        'arn:aws:dynamodb:*:*:table/leaderboards',
+        'arn:aws:dynamodb:*:*:table/leaderboards/index/*',
+        'arn:aws:dynamodb:*:*:table/review_queue',
+        'arn:aws:dynamodb:*:*:table/review_queue/index/*',
+        'arn:aws:dynamodb:*:*:table/question_bank',
+        'arn:aws:dynamodb:*:*:table/question_bank/index/*',
+        'arn:aws:dynamodb:*:*:table/adaptive_sessions',
+        'arn:aws:dynamodb:*:*:table/taxonomy_nodes',
+        'arn:aws:dynamodb:*:*:table/attempt_history',
+        'arn:aws:dynamodb:*:*:table/class_upgrades',
+        'arn:aws:dynamodb:*:*:table/attempt_log',
+        'arn:aws:dynamodb:*:*:table/attempt_log/index/*'
       ]
     }));
 
@@ -152,6 +187,28 @@ export class ApiLambdaStack extends cdk.Stack {
       apiKeyRequired: false
     });
 
+    // v1 routes still called by old app versions, served from v2 storage.
+    // The v1 lambda routed on path only, so any method is accepted.
+    const v1Routes: [apigateway.Resource, string][] = [
+      [quizResource, 'get-by-name'],
+      [quizResource, 'submit'],
+      [quizResource, 'unattempted-quizzes'],
+      [studentsResource, 'progress']
+    ];
+    for (const [parent, path] of v1Routes) {
+      parent.addResource(path).addMethod('ANY', goV2Integration, {
+        authorizer: authorizer,
+        apiKeyRequired: false
+      });
+    }
+
+    // Payment provider webhook without authorization (HMAC signature verified in handler)
+    const v2PaymentsResource = v2Resource.addResource('payments');
+    const v2PaymentsWebhookResource = v2PaymentsResource.addResource('webhook');
+    v2PaymentsWebhookResource.addMethod('POST', goV2Integration, {
+      apiKeyRequired: false
+    });
+
     // Root proxy removed
 
     // Restrict Lambda access to API Gateway only
@@ -9,6 +9,23 @@ export class DynamoDbStack extends cdk.Stack {
   public readonly attemptsTable: dynamodb.Table;
   public readonly studentQuizzesTable: dynamodb.Table;
   public readonly classSubjectsTable: dynamodb.Table;
+  public readonly subscriptionPlansTable: dynamodb.Table;
+  public readonly studentPaymentsTable: dynamodb.Table;
+  public readonly paymentOrdersTable: dynamodb.Table;
+  public readonly couponsTable: dynamodb.Table;
+  public readonly couponRedemptionsTable: dynamodb.Table;
+  public readonly tenantsTable: dynamodb.Table;
+  public readonly batchesTable: dynamodb.Table;
+  public readonly assignmentsTable: dynamodb.Table;
+  public readonly quizItemStatsTable: dynamodb.Table;
+  public readonly leaderboardsTable: dynamodb.Table;
+  public readonly reviewQueueTable: dynamodb.Table;
+  public readonly questionBankTable: dynamodb.Table;
+  public readonly adaptiveSessionsTable: dynamodb.Table;
+  public readonly taxonomyNodesTable: dynamodb.Table;
+  public readonly attemptHistoryTable: dynamodb.Table;
+  public readonly classUpgradesTable: dynamodb.Table;
+  public readonly attemptLogTable: dynamodb.Table;
 
   constructor(scope: Construct, id: string, props?: cdk.StackProps) {
     super(scope, id, props);
@@ -18,6 +35,8 @@ export class DynamoDbStack extends cdk.Stack {
       tableName: 'quiz_questions',
       partitionKey: { name: 'quiz_name', type: dynamodb.AttributeType.STRING },
       billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      // Expires practice quizzes; regular quizzes have no expires_at
+      timeToLiveAttribute: 'expires_at',
       removalPolicy: cdk.RemovalPolicy.RETAIN
     });
 
@@ -67,7 +86,7 @@ export class DynamoDbStack extends cdk.Stack {
       sortKey: { name: 'attempted_at', type: dynamodb.AttributeType.STRING }
     });
 
-    // Class Subjects Table
+    // Class Subjects Table (superseded by taxonomy_nodes, kept for migrate-taxonomy)
     this.classSubjectsTable = new dynamodb.Table(this, 'ClassSubjectsTable', {
       tableName: 'class_subjects',
       partitionKey: { name: 'class_name', type: dynamodb.AttributeType.STRING },
@@ -75,5 +94,181 @@ export class DynamoDbStack extends cdk.Stack {
       billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
       removalPolicy: cdk.RemovalPolicy.RETAIN
     });
+
+    // Subscription Plans Table
+    this.subscriptionPlansTable = new dynamodb.Table(this, 'SubscriptionPlansTable', {
+      tableName: 'subscription_plans',
+      partitionKey: { name: 'plan_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Student Payments Ledger Table (one row per payment)
+    this.studentPaymentsTable = new dynamodb.Table(this, 'StudentPaymentsTable', {
+      tableName: 'student_payments',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'payment_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Payment Orders Table (checkout orders settled by the payment webhook)
+    this.paymentOrdersTable = new dynamodb.Table(this, 'PaymentOrdersTable', {
+      tableName: 'payment_orders',
+      partitionKey: { name: 'order_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Coupons Table
+    this.couponsTable = new dynamodb.Table(this, 'CouponsTable', {
+      tableName: 'coupons',
+      partitionKey: { name: 'code', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Coupon Redemptions Table (one row per coupon and student)
+    this.couponRedemptionsTable = new dynamodb.Table(this, 'CouponRedemptionsTable', {
+      tableName: 'coupon_redemptions',
+      partitionKey: { name: 'code', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Tenants Table (institutes)
+    this.tenantsTable = new dynamodb.Table(this, 'TenantsTable', {
+      tableName: 'tenants',
+      partitionKey: { name: 'tenant_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Batches Table (sections of a class)
+    this.batchesTable = new dynamodb.Table(this, 'BatchesTable', {
+      tableName: 'batches',
+      partitionKey: { name: 'batch_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Assignments Table (quizzes assigned to a batch)
+    this.assignmentsTable = new dynamodb.Table(this, 'AssignmentsTable', {
+      tableName: 'assignments',
+      partitionKey: { name: 'batch_id', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'assignment_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Quiz Item Stats Table (per-question counters, qno 0 is the quiz summary)
+    this.quizItemStatsTable = new dynamodb.Table(this, 'QuizItemStatsTable', {
+      tableName: 'quiz_item_stats',
+      partitionKey: { name: 'quiz_name', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'qno', type: dynamodb.AttributeType.NUMBER },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Leaderboards Table (one row per board and student)
+    this.leaderboardsTable = new dynamodb.Table(this, 'LeaderboardsTable', {
+      tableName: 'leaderboards',
+      partitionKey: { name: 'board_id', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      timeToLiveAttribute: 'expires_at',
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // GSI for ranking within a board
+    this.leaderboardsTable.addGlobalSecondaryIndex({
+      indexName: 'board-score-index',
+      partitionKey: { name: 'board_id', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'score', type: dynamodb.AttributeType.NUMBER }
+    });
+
+    // Review Queue Table (spaced repetition cards per student)
+    this.reviewQueueTable = new dynamodb.Table(this, 'ReviewQueueTable', {
+      tableName: 'review_queue',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'card_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // GSI for due cards
+    this.reviewQueueTable.addGlobalSecondaryIndex({
+      indexName: 'uid-due-index',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'due_at', type: dynamodb.AttributeType.STRING }
+    });
+
+    // Question Bank Table
+    this.questionBankTable = new dynamodb.Table(this, 'QuestionBankTable', {
+      tableName: 'question_bank',
+      partitionKey: { name: 'question_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // GSI for finding duplicates by content
+    this.questionBankTable.addGlobalSecondaryIndex({
+      indexName: 'content-hash-index',
+      partitionKey: { name: 'content_hash', type: dynamodb.AttributeType.STRING }
+    });
+
+    // Adaptive Sessions Table (one question at a time, expires after a day)
+    this.adaptiveSessionsTable = new dynamodb.Table(this, 'AdaptiveSessionsTable', {
+      tableName: 'adaptive_sessions',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'session_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      timeToLiveAttribute: 'expires_at',
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Taxonomy Nodes Table (classes, subjects and topics of each tenant)
+    this.taxonomyNodesTable = new dynamodb.Table(this, 'TaxonomyNodesTable', {
+      tableName: 'taxonomy_nodes',
+      partitionKey: { name: 'tenant_id', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'node_id', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Attempt History Table (attempts of previous classes, archived on upgrade)
+    this.attemptHistoryTable = new dynamodb.Table(this, 'AttemptHistoryTable', {
+      tableName: 'attempt_history',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'archive_key', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // Class Upgrades Table (one row per student class upgrade)
+    this.classUpgradesTable = new dynamodb.Table(this, 'ClassUpgradesTable', {
+      tableName: 'class_upgrades',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'upgraded_at', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+  
+    // Attempt Log Table (every attempt, for trends and mastery)
+    this.attemptLogTable = new dynamodb.Table(this, 'AttemptLogTable', {
+      tableName: 'attempt_log',
+      partitionKey: { name: 'uid', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'attempt_key', type: dynamodb.AttributeType.STRING },
+      billingMode: dynamodb.BillingMode.PAY_PER_REQUEST,
+      removalPolicy: cdk.RemovalPolicy.RETAIN
+    });
+
+    // GSI for class averages in trends
+    this.attemptLogTable.addGlobalSecondaryIndex({
+      indexName: 'category-index',
+      partitionKey: { name: 'category', type: dynamodb.AttributeType.STRING },
+      sortKey: { name: 'attempted_at', type: dynamodb.AttributeType.STRING }
+    });
   }
 }
\ No newline at end of file